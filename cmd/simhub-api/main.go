@@ -11,6 +11,7 @@ import (
 	"github.com/liny/sim-hub/internal/core/module"
 	"github.com/liny/sim-hub/internal/data"
 	"github.com/liny/sim-hub/internal/modules/resource"
+	"github.com/liny/sim-hub/internal/modules/resource/core"
 	"github.com/liny/sim-hub/pkg/logger"
 	"github.com/liny/sim-hub/pkg/storage"
 	"github.com/liny/sim-hub/pkg/storage/minio"
@@ -22,6 +23,8 @@ func main() {
 	viper.SetConfigName("config-api")
 	viper.SetConfigType("yaml")
 	viper.AddConfigPath(".")
+	// 回调密钥不宜写入配置文件，可由环境变量提供 (优先于配置文件)
+	_ = viper.BindEnv("worker.callback_secret", "SIMHUB_CALLBACK_SECRET")
 	if err := viper.ReadInConfig(); err != nil {
 		slog.Error("读取 API 配置文件出错 (config-api.yaml)", "error", err)
 		os.Exit(1)
@@ -36,6 +39,11 @@ func main() {
 	// 1.5 初始化日志系统
 	logger.InitLogger(&cfg.Log)
 
+	// Worker 回调接口 (处理结果与进度) 以共享密钥签名校验；未配置时仍可启动管理 API，但拒绝所有 Worker 回调
+	if err := core.ValidateCallbackSecret(cfg.Worker.CallbackSecret); err != nil {
+		slog.Warn("未配置 worker.callback_secret (或环境变量 SIMHUB_CALLBACK_SECRET)，远程 Worker 的回调将被拒绝 (401)", "error", err)
+	}
+
 	// 2. 初始化核心数据组件 (数据库与 MinIO)
 	dbConn, cleanup, err := data.NewData(&cfg)
 	if err != nil {
@@ -73,7 +81,7 @@ func main() {
 
 	// 5. 业务模块注册
 	registry := module.NewRegistry()
-	registry.Register(resource.NewModule(dbConn, blobStore, stsProvider, cfg.MinIO.Bucket, natsClient, "api", "", nil))
+	registry.Register(resource.NewModule(dbConn, blobStore, stsProvider, cfg.MinIO.Bucket, natsClient, "api", cfg.Worker))
 
 	// 6. 配置 HTTP 路由
 	r := gin.Default()
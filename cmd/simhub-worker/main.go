@@ -9,16 +9,22 @@ import (
 	"github.com/liny/sim-hub/internal/conf"
 	"github.com/liny/sim-hub/internal/data"
 	"github.com/liny/sim-hub/internal/modules/resource/core"
+	_ "github.com/liny/sim-hub/internal/modules/resource/processors" // 注册内置的进程内处理器
 	"github.com/liny/sim-hub/pkg/logger"
 	"github.com/liny/sim-hub/pkg/storage/minio"
 	"github.com/spf13/viper"
 )
 
 func main() {
+	// 以处理器启动垫片方式重新执行时设置资源上限后 exec 处理器，不再返回
+	core.MaybeRunRlimitShim()
+
 	// 1. 加载配置 (Worker 专用)
 	viper.SetConfigName("config-worker")
 	viper.SetConfigType("yaml")
 	viper.AddConfigPath(".")
+	// 回调密钥不宜写入配置文件，可由环境变量提供 (优先于配置文件)
+	_ = viper.BindEnv("worker.callback_secret", "SIMHUB_CALLBACK_SECRET")
 	if err := viper.ReadInConfig(); err != nil {
 		slog.Error("读取 Worker 配置文件出错 (config-worker.yaml)", "error", err)
 		os.Exit(1)
@@ -38,6 +44,14 @@ func main() {
 	// 2. 初始化日志
 	logger.InitLogger(&cfg.Log)
 
+	// 经 HTTP 回调上报结果时需要与 API 节点一致的签名密钥
+	if cfg.NATS.ResultMode != core.ResultModeNATS {
+		if err := core.ValidateCallbackSecret(cfg.Worker.CallbackSecret); err != nil {
+			slog.Error("请设置环境变量 SIMHUB_CALLBACK_SECRET 或在 config-worker.yaml 中配置 worker.callback_secret (与 API 节点一致)", "error", err)
+			os.Exit(1)
+		}
+	}
+
 	// 3. Worker 现在不需要直接操作数据库
 	// 它通过 API Callback 上报结果
 
@@ -59,7 +73,7 @@ func main() {
 	defer natsClient.Close()
 
 	// 6. 启动 UseCase (Worker 模式)
-	_ = core.NewUseCase(nil, store, store, cfg.MinIO.Bucket, natsClient, "worker", cfg.Worker.ApiBaseURL, cfg.Worker.Handlers)
+	uc := core.NewUseCase(nil, store, store, cfg.MinIO.Bucket, natsClient, "worker", cfg.Worker)
 
 	slog.Info("SimHub 计算 Worker 已启动", "subject", cfg.NATS.Subject)
 
@@ -69,4 +83,5 @@ func main() {
 	<-quit
 
 	slog.Info("Worker 正在关闭...")
+	uc.Shutdown()
 }
@@ -1,67 +1,80 @@
 package main
 
 import (
-	"archive/zip"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
-	"path/filepath"
+
+	"github.com/liny/sim-hub/internal/modules/resource/processors"
 )
 
+// driverVersion 处理器版本，Worker 启动时通过 --version 握手读取并记录到资源版本上
+const driverVersion = processors.ScenarioInspectorVersion
+
+// Request v2 协议下 Worker 通过 stdin 传入的处理请求
+type Request struct {
+	Protocol    int            `json:"protocol"`
+	FilePath    string         `json:"file_path"`
+	TypeKey     string         `json:"type_key"`
+	ResourceID  string         `json:"resource_id"`
+	VersionID   string         `json:"version_id"`
+	ProcessConf map[string]any `json:"process_conf"`
+	MetaData    map[string]any `json:"meta_data"`
+}
+
 type Output struct {
 	Status   string         `json:"status"`
 	Metadata map[string]any `json:"metadata"`
 	Error    string         `json:"error,omitempty"`
+	Warnings []string       `json:"warnings,omitempty"`
 }
 
 func main() {
 	filePath := flag.String("file", "", "Path to the file to process")
+	showVersion := flag.Bool("version", false, "Print processor version and exit")
 	flag.Parse()
 
-	if *filePath == "" {
-		sendError("No file provided")
+	if *showVersion {
+		fmt.Println(driverVersion)
 		return
 	}
 
-	// 模拟解压缩并提取元数据
-	r, err := zip.OpenReader(*filePath)
-	if err != nil {
-		// 如果不是 ZIP，也返回成功但元数据为空，或者根据业务报错
-		sendError(fmt.Sprintf("Failed to open zip: %v", err))
-		return
+	// 文件路径来源：-file 参数、v1 协议的位置参数、或 v2 协议的 stdin 请求
+	path := *filePath
+	if path == "" && flag.NArg() > 0 {
+		path = flag.Arg(0)
 	}
-	defer r.Close()
-
-	fileList := []string{}
-	hasScenarioConfig := false
-	for _, f := range r.File {
-		fileList = append(fileList, f.Name)
-		if filepath.Base(f.Name) == "scenario.json" {
-			hasScenarioConfig = true
+	if path == "" {
+		var req Request
+		if err := json.NewDecoder(os.Stdin).Decode(&req); err != nil {
+			sendError(fmt.Sprintf("No file provided: %v", err))
+			return
 		}
+		path = req.FilePath
 	}
-
-	// 构造并输出结果
-	out := Output{
-		Status: "success",
-		Metadata: map[string]any{
-			"files_count": len(fileList),
-			"has_config":  hasScenarioConfig,
-			"driver":      "generic-zip-inspector-v1",
-		},
+	if path == "" {
+		sendError("No file provided")
+		return
 	}
 
-	// 模拟针对想定的特定提取（业务逻辑落在这里，而不是后端核心代码）
-	if hasScenarioConfig {
-		out.Metadata["scenario_type"] = "standard_mission"
-		out.Metadata["estimated_duration"] = 3600 // 模拟解析出的时长
+	// 提取逻辑与 Worker 内置的进程内处理器共用
+	meta, err := processors.InspectScenario(path, progress)
+	if err != nil {
+		sendError(err.Error())
+		return
 	}
 
-	data, _ := json.Marshal(out)
+	data, _ := json.Marshal(Output{Status: "success", Metadata: meta})
 	fmt.Println(string(data))
 }
 
+// progress 以 v2 协议的进度事件格式写入 stderr (v1 下 Worker 仅将其视为日志)
+func progress(percent float64, msg string) {
+	data, _ := json.Marshal(map[string]any{"event": "progress", "percent": percent, "message": msg})
+	fmt.Fprintln(os.Stderr, string(data))
+}
+
 func sendError(msg string) {
 	out := Output{
 		Status: "failed",
@@ -1,5 +1,7 @@
 package conf
 
+import "time"
+
 type Data struct {
 	Database      Database       `mapstructure:"database" json:"database"`
 	MinIO         MinIO          `mapstructure:"minio" json:"minio"`
@@ -10,14 +12,38 @@ type Data struct {
 }
 
 type Worker struct {
-	ApiBaseURL string            `mapstructure:"api_base_url" json:"api_base_url"`
-	Handlers   map[string]string `mapstructure:"handlers" json:"handlers"` // 资源类型与本地处理器路径的映射
+	ApiBaseURL      string                   `mapstructure:"api_base_url" json:"api_base_url"`
+	Handlers        map[string]string        `mapstructure:"handlers" json:"handlers"`                 // 资源类型与本地处理器路径的映射
+	HandlerVersions map[string]string        `mapstructure:"handler_versions" json:"handler_versions"` // 显式声明的处理器版本，未声明时通过 --version 握手获取
+	HandlerOptions  map[string]HandlerOption `mapstructure:"handler_options" json:"handler_options"`   // 各处理器的执行选项
+	Types           []string                 `mapstructure:"types" json:"types"`                       // 额外接收的资源类型 (如只配置了流水线阶段处理器的类型)，handlers 与内置处理器的键默认接收
+	Concurrency     int                      `mapstructure:"concurrency" json:"concurrency"`           // 同时执行的任务数上限，默认 4
+	TypeConcurrency map[string]int           `mapstructure:"type_concurrency" json:"type_concurrency"` // 各资源类型同时执行的任务数上限，例如 map_terrain: 1
+	CallbackSecret  string                   `mapstructure:"callback_secret" json:"-"`                 // Worker 回调 API 的 HMAC 共享密钥，API 与 Worker 需配置相同的值
+	SpoolDir        string                   `mapstructure:"spool_dir" json:"spool_dir"`               // 结果上报失败时的本地暂存目录，API 恢复后重新投递
+	CacheDir        string                   `mapstructure:"cache_dir" json:"cache_dir"`               // 输入文件缓存目录，默认系统临时目录下的 simhub-worker-cache
+	CacheMaxMB      int                      `mapstructure:"cache_max_mb" json:"cache_max_mb"`         // 输入文件缓存容量上限，0 表示不缓存 (每个任务重新下载)
+}
+
+// HandlerOption 单个处理器的执行选项
+type HandlerOption struct {
+	Protocol       int           `mapstructure:"protocol" json:"protocol"`                 // 处理器协议版本：1 (默认) 文件路径作为参数；2 stdin JSON 请求 + stderr 进度事件
+	Timeout        time.Duration `mapstructure:"timeout" json:"timeout"`                   // 单次执行的墙钟超时，例如 "10m"，默认 30m
+	MaxMemoryMB    int           `mapstructure:"max_memory_mb" json:"max_memory_mb"`       // 地址空间上限 (RLIMIT_AS)，0 表示不限制
+	MaxCPUSeconds  int           `mapstructure:"max_cpu_seconds" json:"max_cpu_seconds"`   // CPU 时间上限 (RLIMIT_CPU)，0 表示不限制
+	MaxOpenFiles   int           `mapstructure:"max_open_files" json:"max_open_files"`     // 打开文件数上限 (RLIMIT_NOFILE)，默认 1024
+	MaxOutputBytes int           `mapstructure:"max_output_bytes" json:"max_output_bytes"` // stdout 大小上限，默认 16MB
+	PassEnv        []string      `mapstructure:"pass_env" json:"pass_env"`                 // 透传给处理器的 Worker 环境变量名，其余变量不可见
 }
 
 type NATS struct {
-	Enabled bool   `mapstructure:"enabled" json:"enabled"`
-	URL     string `mapstructure:"url" json:"url"`
-	Subject string `mapstructure:"subject" json:"subject"` // 消息主题，例如 simhub.jobs
+	Enabled       bool   `mapstructure:"enabled" json:"enabled"`
+	URL           string `mapstructure:"url" json:"url"`
+	Subject       string `mapstructure:"subject" json:"subject"`               // 任务主题前缀，例如 simhub.jobs，任务发布到 simhub.jobs.<type_key>.<priority>
+	WorkerSubject string `mapstructure:"worker_subject" json:"worker_subject"` // Worker 心跳主题前缀，默认 simhub.workers
+	ResultMode    string `mapstructure:"result_mode" json:"result_mode"`       // Worker 上报结果的方式：http (默认，回调 API) 或 nats (经 JetStream 持久投递)
+	ResultSubject string `mapstructure:"result_subject" json:"result_subject"` // result_mode 为 nats 时的结果主题，默认 simhub.results
+	ResultStream  string `mapstructure:"result_stream" json:"result_stream"`   // 保存结果消息的 JetStream 流，默认 SIMHUB_RESULTS
 }
 
 type Log struct {
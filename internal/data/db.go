@@ -50,6 +50,12 @@ func NewData(c *conf.Data) (*Data, func(), error) {
 		&model.Category{},
 		&model.Resource{},
 		&model.ResourceVersion{},
+		&model.Job{},
+		&model.Rendition{},
+		&model.Worker{},
+		&model.OutboxEntry{},
+		&model.ResourceFootprint{},
+		&model.ResourceFootprintCell{},
 	); err != nil {
 		return nil, nil, fmt.Errorf("数据库迁移失败: %w", err)
 	}
@@ -11,6 +11,7 @@ import (
 type NATSClient struct {
 	Conn    *nats.Conn
 	Encoded *nats.EncodedConn
+	JS      nats.JetStreamContext // 需要持久投递的消息 (如处理结果) 使用
 	Config  conf.NATS
 }
 
@@ -45,11 +46,18 @@ func NewNATS(c *conf.NATS) (*NATSClient, error) {
 		return nil, err
 	}
 
+	js, err := nc.JetStream()
+	if err != nil {
+		ec.Close()
+		return nil, err
+	}
+
 	slog.Info("NATS 连接成功", "url", c.URL, "subject", c.Subject)
 
 	return &NATSClient{
 		Conn:    nc,
 		Encoded: ec,
+		JS:      js,
 		Config:  *c,
 	}, nil
 }
@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// ResourceFootprint 资源的地理范围 (WGS84 经纬度)，取自最新版本元数据中的 bbox_wgs84
+type ResourceFootprint struct {
+	ResourceID string    `gorm:"primaryKey;type:varchar(36)" json:"resource_id"`
+	MinLon     float64   `gorm:"index" json:"min_lon"`
+	MinLat     float64   `json:"min_lat"`
+	MaxLon     float64   `json:"max_lon"`
+	MaxLat     float64   `json:"max_lat"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// ResourceFootprintCell 地理范围覆盖的网格单元，按单元检索候选资源 (SQLite 与 Postgres 通用的网格索引)
+type ResourceFootprintCell struct {
+	ResourceID string `gorm:"primaryKey;type:varchar(36)" json:"resource_id"`
+	Cell       int    `gorm:"primaryKey;autoIncrement:false;index" json:"cell"`
+}
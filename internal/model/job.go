@@ -0,0 +1,57 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// 处理任务状态
+const (
+	JobStateQueued    = "QUEUED"
+	JobStateRunning   = "RUNNING"
+	JobStateSucceeded = "SUCCEEDED"
+	JobStateFailed    = "FAILED"
+	JobStateCanceled  = "CANCELED"
+
+	// 流水线阶段额外使用的状态
+	StageStatePending = "PENDING"
+	StageStateSkipped = "SKIPPED"
+)
+
+// JobStage 处理流水线中单个阶段的执行状态
+type JobStage struct {
+	Name       string `json:"name"`
+	Optional   bool   `json:"optional,omitempty"`
+	State      string `json:"state"` // PENDING, RUNNING, SUCCEEDED, FAILED, SKIPPED
+	Message    string `json:"message,omitempty"`
+	DurationMs int64  `json:"duration_ms,omitempty"`
+}
+
+// Job 资源处理任务记录，每次派发 ActionProcess 生成一条
+type Job struct {
+	ID          string     `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	ResourceID  string     `gorm:"type:varchar(36);index" json:"resource_id"`
+	VersionID   string     `gorm:"type:varchar(36);index" json:"version_id"`
+	TypeKey     string     `gorm:"type:varchar(50);index" json:"type_key"`
+	Action      string     `gorm:"type:varchar(20)" json:"action"`
+	Priority    string     `gorm:"type:varchar(20);default:'interactive'" json:"priority"` // interactive, bulk, maintenance
+	State       string     `gorm:"type:varchar(20);default:'QUEUED';index" json:"state"`   // QUEUED, RUNNING, SUCCEEDED, FAILED, CANCELED
+	Progress    float64    `json:"progress"`                                               // 0-100，由处理器进度事件上报
+	ProgressMsg string     `gorm:"type:varchar(500)" json:"progress_msg,omitempty"`
+	Message     string     `gorm:"type:text" json:"message,omitempty"`           // 失败原因
+	PrevState   string     `gorm:"type:varchar(20)" json:"prev_state,omitempty"` // 创建任务前版本的状态 (重处理时)，取消任务时恢复
+	Stages      []JobStage `gorm:"serializer:json" json:"stages,omitempty"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+func (j *Job) BeforeCreate(tx *gorm.DB) (err error) {
+	if j.ID == "" {
+		j.ID = uuid.New().String()
+	}
+	return
+}
@@ -0,0 +1,27 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// OutboxEntry 待发布的任务消息，与业务数据在同一事务中写入，
+// 事务提交后由转发器发布并删除，回滚时随事务一起消失
+type OutboxEntry struct {
+	ID          string    `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	JobID       string    `gorm:"type:varchar(36);index" json:"job_id"`
+	Payload     string    `gorm:"type:text" json:"payload"` // JSON 编码的任务消息
+	Attempts    int       `json:"attempts"`                 // 已尝试发布的次数，同时用于多个 API 节点间的占用
+	LastError   string    `gorm:"type:text" json:"last_error,omitempty"`
+	AvailableAt time.Time `gorm:"index" json:"available_at"` // 早于该时间不发布 (失败退避或被其他节点占用)
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (e *OutboxEntry) BeforeCreate(tx *gorm.DB) (err error) {
+	if e.ID == "" {
+		e.ID = uuid.New().String()
+	}
+	return
+}
@@ -9,14 +9,15 @@ import (
 
 // ResourceType 资源类型定义
 type ResourceType struct {
-	TypeKey      string         `gorm:"primaryKey;type:varchar(50)" json:"type_key"`
-	TypeName     string         `gorm:"type:varchar(100);not null" json:"type_name"`
-	SchemaDef    map[string]any `gorm:"serializer:json" json:"schema_def"`                    // 前端表单定义的 JSON Schema
-	ViewerConf   map[string]any `gorm:"serializer:json" json:"viewer_conf"`                   // 前端预览组件配置
-	ProcessConf  map[string]any `gorm:"serializer:json" json:"process_conf"`                  // 后端处理管线配置 (JSON)
-	CategoryMode string         `gorm:"type:varchar(20);default:'flat'" json:"category_mode"` // "flat" 或 "tree"
-	CreatedAt    time.Time      `json:"created_at"`
-	UpdatedAt    time.Time      `json:"updated_at"`
+	TypeKey          string         `gorm:"primaryKey;type:varchar(50)" json:"type_key"`
+	TypeName         string         `gorm:"type:varchar(100);not null" json:"type_name"`
+	SchemaDef        map[string]any `gorm:"serializer:json" json:"schema_def"`                    // 前端表单定义的 JSON Schema
+	ViewerConf       map[string]any `gorm:"serializer:json" json:"viewer_conf"`                   // 前端预览组件配置
+	ProcessConf      map[string]any `gorm:"serializer:json" json:"process_conf"`                  // 后端处理管线配置 (JSON)
+	CategoryMode     string         `gorm:"type:varchar(20);default:'flat'" json:"category_mode"` // "flat" 或 "tree"
+	ProcessorVersion string         `gorm:"type:text" json:"processor_version"`                   // 已观测到的最新处理器版本，低于该版本产出的元数据视为过期；流水线为 "阶段@版本" 组合，长度不定
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
 }
 
 // Category 资源分类（虚拟文件夹）
@@ -60,16 +61,19 @@ func (r *Resource) BeforeCreate(tx *gorm.DB) (err error) {
 
 // ResourceVersion 资源版本表
 type ResourceVersion struct {
-	ID         string         `gorm:"primaryKey;type:varchar(36)" json:"id"`
-	ResourceID string         `gorm:"type:varchar(36);not null;index:idx_res_ver,unique" json:"resource_id"`
-	Resource   Resource       `gorm:"foreignKey:ResourceID" json:"resource,omitempty"`
-	VersionNum int            `gorm:"not null;index:idx_res_ver,unique" json:"version_num"`
-	FilePath   string         `gorm:"type:varchar(500);not null" json:"file_path"`
-	FileHash   string         `gorm:"type:varchar(64)" json:"file_hash"`
-	FileSize   int64          `json:"file_size"`
-	MetaData   map[string]any `gorm:"serializer:json" json:"meta_data"`                // 动态扩展属性
-	State      string         `gorm:"type:varchar(20);default:'PENDING'" json:"state"` // PENDING, ACTIVE, ARCHIVED
-	CreatedAt  time.Time      `json:"created_at"`
+	ID               string         `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	ResourceID       string         `gorm:"type:varchar(36);not null;index:idx_res_ver,unique" json:"resource_id"`
+	Resource         Resource       `gorm:"foreignKey:ResourceID" json:"resource,omitempty"`
+	VersionNum       int            `gorm:"not null;index:idx_res_ver,unique" json:"version_num"`
+	FilePath         string         `gorm:"type:varchar(500);not null" json:"file_path"`
+	FileHash         string         `gorm:"type:varchar(64)" json:"file_hash"`
+	FileSize         int64          `json:"file_size"`
+	MetaData         map[string]any `gorm:"serializer:json" json:"meta_data"`                // 动态扩展属性
+	ExtraMeta        map[string]any `gorm:"serializer:json" json:"extra_meta"`               // 用户上传时提供的元数据 (重处理时保留)
+	State            string         `gorm:"type:varchar(20);default:'PENDING'" json:"state"` // PENDING, ACTIVE, ARCHIVED
+	ProcessorVersion string         `gorm:"type:text" json:"processor_version"`              // 产出当前元数据的处理器版本 (流水线为 "阶段@版本" 组合)
+	ErrorMessage     string         `gorm:"type:text" json:"error_message,omitempty"`        // 处理失败时的错误信息
+	CreatedAt        time.Time      `json:"created_at"`
 }
 
 func (rv *ResourceVersion) BeforeCreate(tx *gorm.DB) (err error) {
@@ -78,3 +82,21 @@ func (rv *ResourceVersion) BeforeCreate(tx *gorm.DB) (err error) {
 	}
 	return
 }
+
+// Rendition 处理器产出的派生文件 (缩略图、预览、LOD 等)
+type Rendition struct {
+	ID          string    `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	VersionID   string    `gorm:"type:varchar(36);not null;index" json:"version_id"`
+	Role        string    `gorm:"type:varchar(50);not null;index" json:"role"` // thumbnail, preview, lod1...
+	ObjectKey   string    `gorm:"type:varchar(500);not null" json:"object_key"`
+	Size        int64     `json:"size"`
+	ContentType string    `gorm:"type:varchar(100)" json:"content_type"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (r *Rendition) BeforeCreate(tx *gorm.DB) (err error) {
+	if r.ID == "" {
+		r.ID = uuid.New().String()
+	}
+	return
+}
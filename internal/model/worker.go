@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// Worker 状态：ONLINE 由心跳维持，OFFLINE 为 Worker 主动下线；
+// 超时未收到心跳的 Worker 在查询时标记为 DEAD
+const (
+	WorkerStateOnline  = "ONLINE"
+	WorkerStateOffline = "OFFLINE"
+	WorkerStateDead    = "DEAD"
+)
+
+// Worker 计算节点注册信息，由 Worker 的周期心跳维护
+type Worker struct {
+	ID                string            `gorm:"primaryKey;type:varchar(64)" json:"id"`
+	Hostname          string            `gorm:"type:varchar(255)" json:"hostname"`
+	Version           string            `gorm:"type:varchar(50)" json:"version"`
+	Types             []string          `gorm:"serializer:json" json:"types"`              // 接收的资源类型
+	ProcessorVersions map[string]string `gorm:"serializer:json" json:"processor_versions"` // 处理器键 -> 版本
+	Concurrency       int               `json:"concurrency"`
+	RunningJobs       []string          `gorm:"serializer:json" json:"running_jobs"` // 正在执行的任务 ID
+	Succeeded         int64             `json:"succeeded"`                           // 启动以来成功处理的任务数
+	Failed            int64             `json:"failed"`
+	ThroughputPerMin  float64           `json:"throughput_per_min"` // 最近 5 分钟平均每分钟完成的任务数
+	State             string            `gorm:"type:varchar(20)" json:"state"`
+	StartedAt         time.Time         `json:"started_at"`
+	LastSeenAt        time.Time         `gorm:"index" json:"last_seen_at"`
+	CreatedAt         time.Time         `json:"created_at"`
+}
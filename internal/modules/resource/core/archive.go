@@ -0,0 +1,353 @@
+package core
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/liny/sim-hub/internal/model"
+	"github.com/liny/sim-hub/pkg/storage"
+)
+
+// 归档浏览：不下载整个 ZIP，按范围读取对象尾部的中央目录列出条目，按需流式读取单个成员。
+// 版本的文件内容不可变，解析结果按版本缓存在 API 节点内存中，按条目总数 LRU 淘汰。
+const (
+	archiveBlockSize       = 1 << 20     // 解析中央目录时每次范围读取的块大小，减少请求次数
+	archiveReadTimeout     = time.Minute // 单次范围读取的超时
+	archiveCacheMaxEntries = 200000      // 缓存的条目总数上限
+)
+
+var (
+	// ErrNotArchive 版本文件不是 ZIP 归档
+	ErrNotArchive = errors.New("version file is not a zip archive")
+	// ErrEntryNotFound 归档中没有该文件
+	ErrEntryNotFound = errors.New("archive entry not found")
+	// ErrUnsupportedEntry 条目已加密或使用了不支持的压缩方式
+	ErrUnsupportedEntry = errors.New("archive entry is encrypted or uses an unsupported compression method")
+)
+
+// ArchiveEntry 归档中的一个条目，路径以 / 分隔并去掉了开头的 / 与 ..
+type ArchiveEntry struct {
+	Path           string    `json:"path"`
+	IsDir          bool      `json:"is_dir,omitempty"`
+	Size           uint64    `json:"size"`
+	CompressedSize uint64    `json:"compressed_size"`
+	CRC32          uint32    `json:"crc32"`
+	Modified       time.Time `json:"modified"`
+}
+
+// blobReaderAt 以范围读取实现 io.ReaderAt。解析中央目录期间按块缓存以合并小读取，
+// 解析完成后只保留直接读取 (此后只用于读取成员的本地文件头)，可并发使用
+type blobReaderAt struct {
+	store  storage.BlobStore
+	bucket string
+	key    string
+	size   int64
+
+	mu     sync.Mutex
+	blocks map[int64][]byte // 块起始偏移 -> 内容，为 nil 时不缓存
+}
+
+func (r *blobReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	want := p
+	if rest := r.size - off; int64(len(want)) > rest {
+		want = want[:rest]
+	}
+
+	var n int
+	var err error
+	r.mu.Lock()
+	if r.blocks != nil {
+		n, err = r.readBlocksLocked(want, off)
+		r.mu.Unlock()
+	} else {
+		r.mu.Unlock()
+		if err = r.readRange(off, want); err == nil {
+			n = len(want)
+		}
+	}
+	if err != nil {
+		return n, err
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// readBlocksLocked 经块缓存读取，调用方持有 r.mu
+func (r *blobReaderAt) readBlocksLocked(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		start := pos - pos%archiveBlockSize
+		block, ok := r.blocks[start]
+		if !ok {
+			block = make([]byte, min(archiveBlockSize, r.size-start))
+			if err := r.readRange(start, block); err != nil {
+				return n, err
+			}
+			r.blocks[start] = block
+		}
+		n += copy(p[n:], block[pos-start:])
+	}
+	return n, nil
+}
+
+func (r *blobReaderAt) readRange(off int64, p []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), archiveReadTimeout)
+	defer cancel()
+	body, err := r.store.GetRange(ctx, r.bucket, r.key, off, int64(len(p)))
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	_, err = io.ReadFull(body, p)
+	return err
+}
+
+// dropBlocks 释放解析期间缓存的块
+func (r *blobReaderAt) dropBlocks() {
+	r.mu.Lock()
+	r.blocks = nil
+	r.mu.Unlock()
+}
+
+// archiveListing 一个版本的归档目录
+type archiveListing struct {
+	objectKey string
+	entries   []ArchiveEntry       // 按路径排序
+	files     map[string]*zip.File // 路径 -> 普通文件
+	elem      *list.Element
+}
+
+// archiveCache 归档目录的内存缓存，按条目总数淘汰；同一版本并发请求时只解析一次
+type archiveCache struct {
+	maxEntries int
+
+	mu       sync.Mutex
+	items    map[string]*archiveListing
+	lru      *list.List // 队首为最近使用
+	total    int
+	inflight map[string]chan struct{}
+}
+
+func newArchiveCache(maxEntries int) *archiveCache {
+	return &archiveCache{
+		maxEntries: maxEntries,
+		items:      make(map[string]*archiveListing),
+		lru:        list.New(),
+		inflight:   make(map[string]chan struct{}),
+	}
+}
+
+// get 返回缓存的目录，未缓存时调用 load 解析；解析失败不缓存
+func (c *archiveCache) get(ctx context.Context, key string, load func() (*archiveListing, error)) (*archiveListing, error) {
+	for {
+		c.mu.Lock()
+		if item, ok := c.items[key]; ok {
+			c.lru.MoveToFront(item.elem)
+			c.mu.Unlock()
+			return item, nil
+		}
+		if done, ok := c.inflight[key]; ok {
+			c.mu.Unlock()
+			select {
+			case <-done:
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		done := make(chan struct{})
+		c.inflight[key] = done
+		c.mu.Unlock()
+
+		item, err := load()
+
+		c.mu.Lock()
+		delete(c.inflight, key)
+		close(done)
+		if err == nil && len(item.entries) <= c.maxEntries {
+			item.elem = c.lru.PushFront(key)
+			c.items[key] = item
+			c.total += len(item.entries)
+			for c.total > c.maxEntries {
+				oldest := c.lru.Back()
+				evicted := c.items[oldest.Value.(string)]
+				c.lru.Remove(oldest)
+				delete(c.items, oldest.Value.(string))
+				c.total -= len(evicted.entries)
+			}
+		}
+		c.mu.Unlock()
+		return item, err
+	}
+}
+
+// entryPath 规范化条目名：统一为 / 分隔，去掉开头的 / 与越出根目录的 ..
+func entryPath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(name, `\`, "/")), "/")
+}
+
+// openArchive 返回版本文件的归档目录，优先使用缓存
+func (uc *UseCase) openArchive(ctx context.Context, resourceID string, versionNum int) (*archiveListing, error) {
+	var ver model.ResourceVersion
+	if err := uc.data.DB.First(&ver, "resource_id = ? AND version_num = ?", resourceID, versionNum).Error; err != nil {
+		return nil, err
+	}
+	return uc.archives.get(ctx, ver.ID, func() (*archiveListing, error) {
+		return uc.readArchive(ctx, ver.FilePath)
+	})
+}
+
+// readArchive 按范围读取 ZIP 的中央目录
+func (uc *UseCase) readArchive(ctx context.Context, objectKey string) (*archiveListing, error) {
+	info, err := uc.store.Stat(ctx, uc.minioConfig, objectKey)
+	if err != nil {
+		return nil, err
+	}
+	ra := &blobReaderAt{store: uc.store, bucket: uc.minioConfig, key: objectKey, size: info.Size, blocks: make(map[int64][]byte)}
+	zr, err := zip.NewReader(ra, info.Size)
+	if err != nil && !errors.Is(err, zip.ErrInsecurePath) {
+		if errors.Is(err, zip.ErrFormat) || errors.Is(err, zip.ErrAlgorithm) {
+			return nil, ErrNotArchive
+		}
+		return nil, fmt.Errorf("read zip directory: %w", err)
+	}
+	ra.dropBlocks()
+
+	listing := &archiveListing{objectKey: objectKey, files: make(map[string]*zip.File, len(zr.File))}
+	for _, f := range zr.File {
+		p := entryPath(f.Name)
+		if p == "" {
+			continue
+		}
+		isDir := f.Mode().IsDir()
+		listing.entries = append(listing.entries, ArchiveEntry{
+			Path:           p,
+			IsDir:          isDir,
+			Size:           f.UncompressedSize64,
+			CompressedSize: f.CompressedSize64,
+			CRC32:          f.CRC32,
+			Modified:       f.Modified,
+		})
+		if !isDir {
+			listing.files[p] = f
+		}
+	}
+	sort.Slice(listing.entries, func(i, j int) bool { return listing.entries[i].Path < listing.entries[j].Path })
+	slog.Info("已读取归档目录", "key", objectKey, "entries", len(listing.entries))
+	return listing, nil
+}
+
+// ListArchiveEntries 分页列出版本归档中路径以 prefix 开头的条目
+func (uc *UseCase) ListArchiveEntries(ctx context.Context, resourceID string, versionNum int, prefix string, page, size int) ([]ArchiveEntry, int, error) {
+	listing, err := uc.openArchive(ctx, resourceID, versionNum)
+	if err != nil {
+		return nil, 0, err
+	}
+	entries := listing.entries
+	if prefix = strings.TrimPrefix(prefix, "/"); prefix != "" {
+		lo := sort.Search(len(entries), func(i int) bool { return entries[i].Path >= prefix })
+		hi := lo
+		for hi < len(entries) && strings.HasPrefix(entries[hi].Path, prefix) {
+			hi++
+		}
+		entries = entries[lo:hi]
+	}
+	// 先比较页号再相乘，超大页号不会溢出成负数下标
+	start := len(entries)
+	if page >= 1 && size >= 1 && page-1 <= len(entries)/size {
+		start = min((page-1)*size, len(entries))
+	}
+	end := start + min(max(size, 0), len(entries)-start)
+	return entries[start:end], len(entries), nil
+}
+
+// OpenArchiveEntry 流式读取归档中的单个文件：一次范围读取该成员的压缩数据并在读取时解压，
+// 读到末尾时校验 CRC32，内容损坏时返回错误
+func (uc *UseCase) OpenArchiveEntry(ctx context.Context, resourceID string, versionNum int, name string) (*ArchiveEntry, io.ReadCloser, error) {
+	listing, err := uc.openArchive(ctx, resourceID, versionNum)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, ok := listing.files[entryPath(name)]
+	if !ok {
+		return nil, nil, ErrEntryNotFound
+	}
+	if f.Flags&0x1 != 0 || (f.Method != zip.Store && f.Method != zip.Deflate) {
+		return nil, nil, ErrUnsupportedEntry
+	}
+
+	offset, err := f.DataOffset()
+	if err != nil {
+		return nil, nil, fmt.Errorf("read local header: %w", err)
+	}
+	body, err := uc.store.GetRange(ctx, uc.minioConfig, listing.objectKey, offset, int64(f.CompressedSize64))
+	if err != nil {
+		return nil, nil, err
+	}
+	reader := &checkedEntryReader{r: body, body: body, hash: crc32.NewIEEE(), size: f.UncompressedSize64, crc: f.CRC32}
+	if f.Method == zip.Deflate {
+		reader.inflate = flate.NewReader(body)
+		reader.r = reader.inflate
+	}
+	entry := &ArchiveEntry{
+		Path:           entryPath(f.Name),
+		Size:           f.UncompressedSize64,
+		CompressedSize: f.CompressedSize64,
+		CRC32:          f.CRC32,
+		Modified:       f.Modified,
+	}
+	return entry, reader, nil
+}
+
+// checkedEntryReader 读到末尾时校验长度与 CRC32
+type checkedEntryReader struct {
+	r       io.Reader
+	body    io.ReadCloser
+	inflate io.ReadCloser // Deflate 解压器，Store 时为 nil
+	hash    hash.Hash32
+	n       uint64
+	size    uint64
+	crc     uint32
+}
+
+func (c *checkedEntryReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.hash.Write(p[:n])
+	c.n += uint64(n)
+	if c.n > c.size {
+		return n, zip.ErrFormat
+	}
+	if err == io.EOF && (c.n != c.size || (c.crc != 0 && c.hash.Sum32() != c.crc)) {
+		return n, zip.ErrChecksum
+	}
+	return n, err
+}
+
+func (c *checkedEntryReader) Close() error {
+	if c.inflate != nil {
+		c.inflate.Close()
+	}
+	return c.body.Close()
+}
@@ -0,0 +1,240 @@
+package core
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// defaultCacheDirName 未配置 cache_dir 时使用的缓存目录名 (位于系统临时目录下)
+const defaultCacheDirName = "simhub-worker-cache"
+
+// contentCache Worker 本地的输入文件缓存：按内容标识 (对象 ETag 与大小) 寻址，总大小有上限，按 LRU 淘汰。
+// 正在被任务使用的文件不会被淘汰；同一内容并发请求时只下载一次。
+// 缓存文件权限为 0444，只能防止处理器误写：原生处理器与 Worker 以同一用户运行，可以先改权限再改写，
+// 被改写的内容会被之后命中缓存的任务读到。不可信的处理器应使用 WASM (输入目录只读挂载) 或关闭缓存
+type contentCache struct {
+	dir      string
+	maxBytes int64
+
+	mu       sync.Mutex
+	entries  map[string]*cacheEntry
+	lru      *list.List // 队首为最近使用
+	size     int64
+	inflight map[string]chan struct{} // 正在下载的键，下载结束后关闭
+}
+
+type cacheEntry struct {
+	key   string
+	path  string
+	size  int64
+	refs  int
+	elem  *list.Element
+	stale bool // 超出缓存容量的文件，不再被使用后删除
+}
+
+// newContentCache 创建缓存并载入目录中已有的文件 (按修改时间恢复 LRU 顺序)
+func newContentCache(dir string, maxBytes int64) (*contentCache, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	c := &contentCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		entries:  make(map[string]*cacheEntry),
+		lru:      list.New(),
+		inflight: make(map[string]chan struct{}),
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	type existing struct {
+		name string
+		info os.FileInfo
+	}
+	var found []existing
+	for _, f := range files {
+		info, err := f.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if strings.HasPrefix(f.Name(), ".") {
+			// 上次未完成的下载
+			os.Remove(filepath.Join(dir, f.Name()))
+			continue
+		}
+		found = append(found, existing{f.Name(), info})
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].info.ModTime().After(found[j].info.ModTime()) })
+	for _, f := range found {
+		e := &cacheEntry{key: f.name, path: filepath.Join(dir, f.name), size: f.info.Size()}
+		e.elem = c.lru.PushBack(e)
+		c.entries[e.key] = e
+		c.size += e.size
+	}
+	c.mu.Lock()
+	c.evictLocked()
+	c.mu.Unlock()
+	return c, nil
+}
+
+// cacheFileName 由内容标识与扩展名生成文件名，保留扩展名供按后缀识别格式的处理器使用
+func cacheFileName(contentKey, ext string) string {
+	sum := sha256.Sum256([]byte(contentKey))
+	return hex.EncodeToString(sum[:16]) + ext
+}
+
+// Acquire 返回内容对应的本地文件路径，未缓存时调用 fetch 下载到给定路径；
+// 使用结束后必须调用 release，之后文件才可能被淘汰
+func (c *contentCache) Acquire(ctx context.Context, contentKey, ext string, fetch func(path string) error) (string, func(), error) {
+	key := cacheFileName(contentKey, ext)
+	for {
+		c.mu.Lock()
+		if e, ok := c.entries[key]; ok {
+			e.refs++
+			c.lru.MoveToFront(e.elem)
+			c.mu.Unlock()
+			slog.Debug("输入文件命中缓存", "key", contentKey, "path", e.path)
+			return e.path, c.releaser(e), nil
+		}
+		if done, ok := c.inflight[key]; ok {
+			c.mu.Unlock()
+			select {
+			case <-done:
+				continue
+			case <-ctx.Done():
+				return "", nil, ctx.Err()
+			}
+		}
+		done := make(chan struct{})
+		c.inflight[key] = done
+		c.mu.Unlock()
+
+		e, err := c.fetch(key, fetch)
+
+		c.mu.Lock()
+		delete(c.inflight, key)
+		close(done)
+		if err != nil {
+			c.mu.Unlock()
+			return "", nil, err
+		}
+		e.refs = 1
+		if e.stale {
+			// 单个文件超过缓存容量：不进入缓存，本次使用后删除
+			c.mu.Unlock()
+			return e.path, c.releaser(e), nil
+		}
+		e.elem = c.lru.PushFront(e)
+		c.entries[key] = e
+		c.size += e.size
+		c.evictLocked()
+		c.mu.Unlock()
+		return e.path, c.releaser(e), nil
+	}
+}
+
+// fetch 下载到临时文件后原子重命名，避免其他任务看到不完整的文件。
+// 超过缓存容量的文件保留在本次独占的临时路径上，同一内容的其他任务各自下载，互不删除对方的文件
+func (c *contentCache) fetch(key string, fetch func(path string) error) (*cacheEntry, error) {
+	f, err := os.CreateTemp(c.dir, "."+key+".*.part")
+	if err != nil {
+		return nil, err
+	}
+	tmp := f.Name()
+	f.Close()
+	if err := fetch(tmp); err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	info, err := os.Stat(tmp)
+	if err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	if err := os.Chmod(tmp, 0o444); err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	if info.Size() > c.maxBytes {
+		return &cacheEntry{key: key, path: tmp, size: info.Size(), stale: true}, nil
+	}
+	path := filepath.Join(c.dir, key)
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	return &cacheEntry{key: key, path: path, size: info.Size()}, nil
+}
+
+func (c *contentCache) releaser(e *cacheEntry) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			e.refs--
+			if e.stale && e.refs == 0 {
+				os.Remove(e.path)
+				return
+			}
+			c.evictLocked()
+		})
+	}
+}
+
+// evictLocked 从最久未使用的一端淘汰未被使用的文件，直到总大小不超过上限
+func (c *contentCache) evictLocked() {
+	for elem := c.lru.Back(); elem != nil && c.size > c.maxBytes; {
+		e := elem.Value.(*cacheEntry)
+		prev := elem.Prev()
+		if e.refs == 0 {
+			c.lru.Remove(elem)
+			delete(c.entries, e.key)
+			c.size -= e.size
+			if err := os.Remove(e.path); err != nil && !os.IsNotExist(err) {
+				slog.Warn("删除缓存文件失败", "path", e.path, "error", err)
+			}
+			slog.Debug("淘汰缓存文件", "path", e.path, "size", e.size)
+		}
+		elem = prev
+	}
+}
+
+// fetchInput 准备任务的输入文件：启用缓存时按内容标识复用本地文件，否则下载到临时文件；
+// 返回的 release 在处理结束后调用
+func (uc *UseCase) fetchInput(ctx context.Context, job processJob) (string, func(), error) {
+	ext := filepath.Ext(job.ObjectKey)
+	if uc.cache == nil {
+		tempFile, err := os.CreateTemp("", "simhub-resource-*"+ext)
+		if err != nil {
+			return "", nil, err
+		}
+		tempFile.Close()
+		if err := uc.store.DownloadFile(ctx, uc.minioConfig, job.ObjectKey, tempFile.Name()); err != nil {
+			os.Remove(tempFile.Name())
+			return "", nil, err
+		}
+		return tempFile.Name(), func() { os.Remove(tempFile.Name()) }, nil
+	}
+
+	// 以对象的 ETag 与大小标识内容：版本对象写入后不再修改，重处理同一版本时命中缓存
+	info, err := uc.store.Stat(ctx, uc.minioConfig, job.ObjectKey)
+	if err != nil {
+		return "", nil, err
+	}
+	contentKey := fmt.Sprintf("etag:%s:%d", strings.Trim(info.ETag, `"`), info.Size)
+	return uc.cache.Acquire(ctx, contentKey, ext, func(path string) error {
+		return uc.store.DownloadFile(ctx, uc.minioConfig, job.ObjectKey, path)
+	})
+}
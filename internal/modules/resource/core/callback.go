@@ -0,0 +1,354 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Worker 回调 API 时携带的请求头
+const (
+	HeaderCallbackTimestamp = "X-SimHub-Timestamp"
+	HeaderCallbackSignature = "X-SimHub-Signature" // hex(HMAC-SHA256(secret, method\npath\ntimestamp\nbody))
+	HeaderCallbackWorker    = "X-SimHub-Worker"
+	HeaderIdempotencyKey    = "Idempotency-Key"
+)
+
+const (
+	callbackTimeout      = 30 * time.Second
+	callbackMaxSkew      = 5 * time.Minute // 签名时间戳允许的时钟偏差，超出视为重放
+	callbackMaxAttempts  = 5
+	callbackMaxBackoff   = 30 * time.Second
+	spoolFlushInterval   = 30 * time.Second
+	spoolMaxAge          = 7 * 24 * time.Hour // 超过该时间仍无法投递的结果被丢弃
+	defaultSpoolDirName  = "simhub-worker-spool"
+	maxCallbackBodyBytes = 32 << 20
+)
+
+// callbackRetryBase 首次重试前的等待时间，之后按指数退避
+var callbackRetryBase = time.Second
+
+// placeholderCallbackSecret 示例配置曾使用的占位密钥，已公开，不能作为真实密钥
+const placeholderCallbackSecret = "change-me"
+
+var (
+	// ErrCallbackUnauthorized 回调请求未通过签名校验
+	ErrCallbackUnauthorized = errors.New("invalid callback signature")
+	// ErrCallbackSecretUnset 未配置回调密钥或仍为占位值
+	ErrCallbackSecretUnset = errors.New("worker.callback_secret is not set")
+	// ErrIdempotencyKeyMismatch 回调的幂等键与请求体中的任务不一致
+	ErrIdempotencyKeyMismatch = errors.New("idempotency key does not match the reported job")
+)
+
+// ValidateCallbackSecret 检查回调密钥已配置且不是示例配置中的占位值；
+// 不通过时 API 节点拒绝所有回调，以 HTTP 回调上报结果的 Worker 拒绝启动
+func ValidateCallbackSecret(secret string) error {
+	if secret == "" || secret == placeholderCallbackSecret {
+		return ErrCallbackSecretUnset
+	}
+	return nil
+}
+
+// ResultIdempotencyKey 处理结果的幂等键：同一任务的结果无论重试、暂存后重新投递还是经 NATS 上报都使用相同的键
+func ResultIdempotencyKey(versionID, jobID string) string {
+	if jobID == "" {
+		return "result:" + versionID
+	}
+	return "result:" + jobID
+}
+
+// CheckResultIdempotencyKey API 节点校验回调携带的幂等键与请求体中的任务一致，
+// ReportProcessResult 按该任务去重；未携带幂等键时直接按请求体中的任务去重
+func CheckResultIdempotencyKey(key, versionID string, req ProcessResultRequest) error {
+	if key != "" && key != ResultIdempotencyKey(versionID, req.JobID) {
+		return ErrIdempotencyKeyMismatch
+	}
+	return nil
+}
+
+// callbackError API 返回的非 200 响应
+type callbackError struct {
+	Status int
+}
+
+func (e *callbackError) Error() string {
+	return fmt.Sprintf("callback failed with status: %d", e.Status)
+}
+
+// retryable 网络错误、5xx、408 与 429 可能在重试后成功
+func retryable(err error) bool {
+	var ce *callbackError
+	if !errors.As(err, &ce) {
+		return true
+	}
+	return ce.Status >= 500 || ce.Status == http.StatusRequestTimeout || ce.Status == http.StatusTooManyRequests
+}
+
+// spoolable 值得暂存后重新投递的失败：除可重试的错误外，还包括密钥配置错误导致的 401/403
+func spoolable(err error) bool {
+	var ce *callbackError
+	if errors.As(err, &ce) && (ce.Status == http.StatusUnauthorized || ce.Status == http.StatusForbidden) {
+		return true
+	}
+	return retryable(err)
+}
+
+// signCallback 计算回调请求的签名
+func signCallback(secret, method, path, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(method + "\n" + path + "\n" + timestamp + "\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyCallback API 节点校验 Worker 回调的签名与时间戳，body 为完整的请求体；
+// 未配置有效的 callback_secret 时拒绝所有回调
+func (uc *UseCase) VerifyCallback(r *http.Request, body []byte) error {
+	if ValidateCallbackSecret(uc.callbackSecret) != nil {
+		return ErrCallbackUnauthorized
+	}
+	ts := r.Header.Get(HeaderCallbackTimestamp)
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrCallbackUnauthorized
+	}
+	if skew := time.Since(time.Unix(unix, 0)); skew > callbackMaxSkew || skew < -callbackMaxSkew {
+		return ErrCallbackUnauthorized
+	}
+	expected := signCallback(uc.callbackSecret, r.Method, r.URL.Path, ts, body)
+	if !hmac.Equal([]byte(expected), []byte(r.Header.Get(HeaderCallbackSignature))) {
+		return ErrCallbackUnauthorized
+	}
+	return nil
+}
+
+// callAPI 远程 Worker 调用 API 节点的回调接口 (单次尝试)
+func (uc *UseCase) callAPI(ctx context.Context, method, path string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return uc.sendCallback(ctx, method, path, "", body)
+}
+
+// sendCallback 发送一次签名的回调请求
+func (uc *UseCase) sendCallback(ctx context.Context, method, path, idempotencyKey string, body []byte) error {
+	httpReq, err := http.NewRequestWithContext(ctx, method, uc.apiBaseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if idempotencyKey != "" {
+		httpReq.Header.Set(HeaderIdempotencyKey, idempotencyKey)
+	}
+	if uc.stats != nil {
+		httpReq.Header.Set(HeaderCallbackWorker, uc.stats.id)
+	}
+	if uc.callbackSecret != "" {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		httpReq.Header.Set(HeaderCallbackTimestamp, ts)
+		httpReq.Header.Set(HeaderCallbackSignature, signCallback(uc.callbackSecret, method, httpReq.URL.Path, ts, body))
+	}
+
+	resp, err := uc.httpClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode != http.StatusOK {
+		return &callbackError{Status: resp.StatusCode}
+	}
+	return nil
+}
+
+// resultPath 处理结果回调接口的路径
+func resultPath(versionID string) string {
+	return "/api/v1/resources/" + versionID + "/process-result"
+}
+
+// sendResult 投递一次处理结果：result_mode 为 nats 时发布到 JetStream，否则回调 API
+func (uc *UseCase) sendResult(ctx context.Context, versionID, idempotencyKey string, body []byte) error {
+	if uc.resultsOverNATS() {
+		return uc.publishResult(ctx, versionID, idempotencyKey, body)
+	}
+	return uc.sendCallback(ctx, http.MethodPatch, resultPath(versionID), idempotencyKey, body)
+}
+
+// sendWithRetry 失败时按指数退避 (带抖动) 重试可重试的错误
+func (uc *UseCase) sendWithRetry(ctx context.Context, versionID, idempotencyKey string, body []byte) error {
+	backoff := callbackRetryBase
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = uc.sendResult(ctx, versionID, idempotencyKey, body); err == nil || !retryable(err) || attempt == callbackMaxAttempts {
+			return err
+		}
+		wait := backoff/2 + rand.N(backoff/2+1)
+		slog.Warn("处理结果上报失败，稍后重试", "version_id", versionID, "attempt", attempt, "wait", wait, "error", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		backoff = min(backoff*2, callbackMaxBackoff)
+	}
+}
+
+// deliverResult 上报处理结果：重试后仍失败时写入本地暂存目录，由后台定期重新投递，
+// API 以任务 ID 作为幂等键，重复投递不会重复生效
+func (uc *UseCase) deliverResult(ctx context.Context, versionID, idempotencyKey string, req ProcessResultRequest) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	err = uc.sendWithRetry(ctx, versionID, idempotencyKey, body)
+	if err == nil || !spoolable(err) {
+		return err
+	}
+	if spoolErr := uc.spoolResult(spooledResult{
+		VersionID:      versionID,
+		IdempotencyKey: idempotencyKey,
+		Body:           body,
+		CreatedAt:      time.Now(),
+	}); spoolErr != nil {
+		return fmt.Errorf("%w (spool failed: %v)", err, spoolErr)
+	}
+	slog.Warn("处理结果暂存到本地，恢复后重新投递", "version_id", versionID, "error", err)
+	return nil
+}
+
+// spooledResult 暂存的处理结果，重新投递时按当前的 result_mode 发送
+type spooledResult struct {
+	VersionID      string          `json:"version_id"`
+	IdempotencyKey string          `json:"idempotency_key"`
+	Body           json.RawMessage `json:"body"` // ProcessResultRequest
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+// spoolFileName 由幂等键生成文件名，同一结果重复暂存时覆盖
+func spoolFileName(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' || r == '.' {
+			return '_'
+		}
+		return r
+	}, key) + ".json"
+}
+
+// spoolResult 原子写入暂存文件 (先写临时文件再重命名)
+func (uc *UseCase) spoolResult(cb spooledResult) error {
+	if err := os.MkdirAll(uc.spoolDir, 0o700); err != nil {
+		return err
+	}
+	key := cb.IdempotencyKey
+	if key == "" {
+		key = strconv.FormatInt(time.Now().UnixNano(), 10)
+	}
+	data, err := json.Marshal(cb)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(uc.spoolDir, ".spool-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(uc.spoolDir, spoolFileName(key)))
+}
+
+// startSpoolFlusher 启动时及之后定期重新投递暂存的结果，直到 Shutdown
+func (uc *UseCase) startSpoolFlusher() {
+	uc.flushSpool(context.Background())
+	ticker := time.NewTicker(spoolFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			uc.flushSpool(context.Background())
+		case <-uc.stopCh:
+			return
+		}
+	}
+}
+
+// flushSpool 逐个重新投递暂存的结果，返回成功投递的数量；仍无法投递时停止本轮投递
+func (uc *UseCase) flushSpool(ctx context.Context) int {
+	entries, err := os.ReadDir(uc.spoolDir)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			slog.Error("读取结果暂存目录失败", "dir", uc.spoolDir, "error", err)
+		}
+		return 0
+	}
+
+	delivered := 0
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		file := filepath.Join(uc.spoolDir, e.Name())
+		data, err := os.ReadFile(file)
+		if err != nil {
+			slog.Error("读取暂存结果失败", "file", file, "error", err)
+			continue
+		}
+		var cb spooledResult
+		if err := json.Unmarshal(data, &cb); err != nil {
+			slog.Error("暂存结果已损坏，丢弃", "file", file, "error", err)
+			os.Remove(file)
+			continue
+		}
+		if time.Since(cb.CreatedAt) > spoolMaxAge {
+			slog.Error("暂存结果超过保留期限仍未投递，丢弃", "version_id", cb.VersionID, "created_at", cb.CreatedAt)
+			os.Remove(file)
+			continue
+		}
+
+		err = uc.sendResult(ctx, cb.VersionID, cb.IdempotencyKey, cb.Body)
+		if err != nil && spoolable(err) {
+			slog.Debug("仍无法投递，暂缓重新投递暂存结果", "version_id", cb.VersionID, "error", err)
+			return delivered
+		}
+		if err != nil {
+			slog.Error("暂存结果被 API 拒绝，丢弃", "version_id", cb.VersionID, "error", err)
+		} else {
+			delivered++
+			slog.Info("暂存结果已重新投递", "version_id", cb.VersionID)
+		}
+		os.Remove(file)
+	}
+	return delivered
+}
+
+// ReadCallbackBody 读取回调请求体 (有大小上限)，供签名校验后重新绑定
+func ReadCallbackBody(r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxCallbackBodyBytes))
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
@@ -0,0 +1,183 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/liny/sim-hub/internal/model"
+	"gorm.io/gorm"
+)
+
+// manifestRole 文件清单派生文件的角色，由 manifest 处理阶段生成
+const manifestRole = "manifest"
+
+// ErrNoManifest 版本既没有文件清单，也不是可按范围读取目录的 ZIP
+var ErrNoManifest = errors.New("version has no file manifest")
+
+// ManifestFile 文件清单中的一项，路径以 / 分隔
+type ManifestFile struct {
+	Path  string `json:"path"`
+	Size  uint64 `json:"size"`
+	CRC32 uint32 `json:"crc32"`
+}
+
+// FileManifest 版本包含的文件清单 (manifest.json)，按路径排序
+type FileManifest struct {
+	FilesCount int            `json:"files_count"`
+	TotalSize  uint64         `json:"total_size"`
+	Files      []ManifestFile `json:"files"`
+}
+
+// FileChange 两个版本间内容发生变化的文件
+type FileChange struct {
+	Path string       `json:"path"`
+	From ManifestFile `json:"from"`
+	To   ManifestFile `json:"to"`
+}
+
+// FileDiff 文件层面的差异
+type FileDiff struct {
+	Added     []ManifestFile `json:"added"`
+	Removed   []ManifestFile `json:"removed"`
+	Modified  []FileChange   `json:"modified"`
+	Unchanged int            `json:"unchanged"`
+}
+
+// MetaChange 取值发生变化的元数据字段
+type MetaChange struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+// MetaDiff 元数据层面的差异
+type MetaDiff struct {
+	Added    map[string]any        `json:"added"`
+	Removed  map[string]any        `json:"removed"`
+	Modified map[string]MetaChange `json:"modified"`
+}
+
+// VersionDiff 两个版本的差异
+type VersionDiff struct {
+	From     int      `json:"from"`
+	To       int      `json:"to"`
+	Files    FileDiff `json:"files"`
+	Metadata MetaDiff `json:"metadata"`
+}
+
+// DiffVersions 比较资源两个版本的文件清单与元数据
+func (uc *UseCase) DiffVersions(ctx context.Context, resourceID string, from, to int) (*VersionDiff, error) {
+	var versions [2]model.ResourceVersion
+	for i, num := range []int{from, to} {
+		if err := uc.data.DB.First(&versions[i], "resource_id = ? AND version_num = ?", resourceID, num).Error; err != nil {
+			return nil, err
+		}
+	}
+	var manifests [2]*FileManifest
+	for i, ver := range versions {
+		m, err := uc.loadManifest(ctx, ver)
+		if err != nil {
+			return nil, fmt.Errorf("version %d: %w", ver.VersionNum, err)
+		}
+		manifests[i] = m
+	}
+	return &VersionDiff{
+		From:     from,
+		To:       to,
+		Files:    diffManifests(manifests[0], manifests[1]),
+		Metadata: diffMetadata(versions[0].MetaData, versions[1].MetaData),
+	}, nil
+}
+
+// loadManifest 读取版本的文件清单；处理时没有生成清单的 ZIP 版本 (如升级前处理的版本)
+// 退化为按范围读取中央目录
+func (uc *UseCase) loadManifest(ctx context.Context, ver model.ResourceVersion) (*FileManifest, error) {
+	var r model.Rendition
+	err := uc.data.DB.Where("version_id = ? AND role = ?", ver.ID, manifestRole).First(&r).Error
+	if err == nil {
+		body, err := uc.OpenRendition(ctx, &r)
+		if err != nil {
+			return nil, err
+		}
+		defer body.Close()
+		var m FileManifest
+		if err := json.NewDecoder(body).Decode(&m); err != nil {
+			return nil, fmt.Errorf("decode manifest: %w", err)
+		}
+		return &m, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	listing, err := uc.archives.get(ctx, ver.ID, func() (*archiveListing, error) {
+		return uc.readArchive(ctx, ver.FilePath)
+	})
+	if errors.Is(err, ErrNotArchive) {
+		return nil, ErrNoManifest
+	}
+	if err != nil {
+		return nil, err
+	}
+	m := &FileManifest{}
+	for _, e := range listing.entries {
+		if !e.IsDir {
+			m.Files = append(m.Files, ManifestFile{Path: e.Path, Size: e.Size, CRC32: e.CRC32})
+			m.TotalSize += e.Size
+		}
+	}
+	m.FilesCount = len(m.Files)
+	return m, nil
+}
+
+// diffManifests 按路径比较两个清单，大小或 CRC32 不同视为修改
+func diffManifests(from, to *FileManifest) FileDiff {
+	diff := FileDiff{Added: []ManifestFile{}, Removed: []ManifestFile{}, Modified: []FileChange{}}
+	old := make(map[string]ManifestFile, len(from.Files))
+	for _, f := range from.Files {
+		old[f.Path] = f
+	}
+	for _, f := range to.Files {
+		prev, ok := old[f.Path]
+		if !ok {
+			diff.Added = append(diff.Added, f)
+			continue
+		}
+		delete(old, f.Path)
+		if prev.Size != f.Size || prev.CRC32 != f.CRC32 {
+			diff.Modified = append(diff.Modified, FileChange{Path: f.Path, From: prev, To: f})
+		} else {
+			diff.Unchanged++
+		}
+	}
+	for _, f := range old {
+		diff.Removed = append(diff.Removed, f)
+	}
+	sort.Slice(diff.Added, func(i, j int) bool { return diff.Added[i].Path < diff.Added[j].Path })
+	sort.Slice(diff.Removed, func(i, j int) bool { return diff.Removed[i].Path < diff.Removed[j].Path })
+	sort.Slice(diff.Modified, func(i, j int) bool { return diff.Modified[i].Path < diff.Modified[j].Path })
+	return diff
+}
+
+// diffMetadata 按键比较两个版本的元数据
+func diffMetadata(from, to map[string]any) MetaDiff {
+	diff := MetaDiff{Added: map[string]any{}, Removed: map[string]any{}, Modified: map[string]MetaChange{}}
+	for k, v := range to {
+		prev, ok := from[k]
+		switch {
+		case !ok:
+			diff.Added[k] = v
+		case !reflect.DeepEqual(prev, v):
+			diff.Modified[k] = MetaChange{From: prev, To: v}
+		}
+	}
+	for k, v := range from {
+		if _, ok := to[k]; !ok {
+			diff.Removed[k] = v
+		}
+	}
+	return diff
+}
@@ -0,0 +1,302 @@
+package core
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// 归档解压：资源类型的 ProcessConf 声明 extract 时，Worker 先把输入归档解压到独立的临时目录，
+// 处理器拿到的 file_path 为解压后的目录。支持 zip、tar 与 tar.gz：
+//
+//	extract: true
+//	extract: {max_size_mb: 8192, max_entries: 100000}
+//
+// 条目路径不能是绝对路径或越出目标目录 (zip-slip)，符号链接、硬链接与设备文件不会被创建；
+// 解压总大小按实际写入的字节数计算，不信任归档头中声明的大小。
+const (
+	defaultExtractMaxBytes   = 4 << 30
+	defaultExtractMaxEntries = 50000
+)
+
+// 归档格式
+const (
+	archiveZip   = "zip"
+	archiveTar   = "tar"
+	archiveTarGz = "tar.gz"
+)
+
+var (
+	errUnsupportedArchive = errors.New("unsupported archive format")
+	errExtractLimit       = errors.New("archive exceeds extraction limits")
+	errUnsafeEntry        = errors.New("unsafe archive entry")
+)
+
+// extractOptions 解压限制
+type extractOptions struct {
+	MaxBytes   int64
+	MaxEntries int
+}
+
+// parseExtractOptions 从 ProcessConf 中解析解压配置，未启用时返回 false
+func parseExtractOptions(processConf map[string]any) (extractOptions, bool) {
+	opts := extractOptions{MaxBytes: defaultExtractMaxBytes, MaxEntries: defaultExtractMaxEntries}
+	switch v := processConf["extract"].(type) {
+	case bool:
+		return opts, v
+	case map[string]any:
+		if n, ok := confNumber(v["max_size_mb"]); ok && n > 0 {
+			opts.MaxBytes = int64(n) << 20
+		}
+		if n, ok := confNumber(v["max_entries"]); ok && n > 0 {
+			opts.MaxEntries = int(n)
+		}
+		return opts, true
+	}
+	return opts, false
+}
+
+// confNumber 读取配置中的数值：来自 YAML 时为整数，经 JSON (数据库、任务消息) 后为浮点数
+func confNumber(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// detectArchive 按文件头识别归档格式，不依赖扩展名
+func detectArchive(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	head = head[:n]
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return archiveZip, nil
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return archiveTarGz, nil
+	case len(head) >= 262 && string(head[257:262]) == "ustar":
+		return archiveTar, nil
+	}
+	return "", errUnsupportedArchive
+}
+
+// extractInput 把输入归档解压到新建的临时目录并返回目录路径，失败时不留下残余文件
+func extractInput(ctx context.Context, archivePath string, opts extractOptions) (string, error) {
+	format, err := detectArchive(archivePath)
+	if err != nil {
+		return "", err
+	}
+	dir, err := os.MkdirTemp("", "simhub-extract-*")
+	if err != nil {
+		return "", err
+	}
+	x := &extractor{ctx: ctx, dst: dir, opts: opts}
+	switch format {
+	case archiveZip:
+		err = x.extractZip(archivePath)
+	default:
+		err = x.extractTar(archivePath, format == archiveTarGz)
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	slog.Debug("归档已解压", "format", format, "dir", dir, "entries", x.entries, "bytes", x.written)
+	return dir, nil
+}
+
+// extractor 单次解压的状态，累计条目数与写入字节数
+type extractor struct {
+	ctx     context.Context
+	dst     string
+	opts    extractOptions
+	entries int
+	written int64
+}
+
+// target 把条目名映射为目标目录内的路径；名称为空或指向根目录时返回空
+func (x *extractor) target(name string) (string, error) {
+	name = strings.ReplaceAll(name, `\`, "/")
+	if path.IsAbs(name) || (len(name) >= 2 && name[1] == ':') {
+		return "", fmt.Errorf("%w: absolute path %q", errUnsafeEntry, name)
+	}
+	clean := path.Clean(name)
+	if clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("%w: path %q escapes extraction dir", errUnsafeEntry, name)
+	}
+	if clean == "." {
+		return "", nil
+	}
+	return filepath.Join(x.dst, filepath.FromSlash(clean)), nil
+}
+
+// next 登记一个条目，超出条目数限制或任务已取消时返回错误
+func (x *extractor) next() error {
+	if err := x.ctx.Err(); err != nil {
+		return err
+	}
+	x.entries++
+	if x.entries > x.opts.MaxEntries {
+		return fmt.Errorf("%w: more than %d entries", errExtractLimit, x.opts.MaxEntries)
+	}
+	return nil
+}
+
+// writeFile 写入普通文件，按实际写入的字节数计入总大小限制；同名条目重复出现视为非法归档
+func (x *extractor) writeFile(target string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("%w: duplicate entry %q", errUnsafeEntry, strings.TrimPrefix(target, x.dst+string(filepath.Separator)))
+		}
+		return err
+	}
+	remaining := x.opts.MaxBytes - x.written
+	n, err := io.Copy(f, io.LimitReader(&ctxReader{ctx: x.ctx, r: r}, remaining+1))
+	x.written += n
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if n > remaining {
+		return fmt.Errorf("%w: more than %d bytes uncompressed", errExtractLimit, x.opts.MaxBytes)
+	}
+	return nil
+}
+
+func (x *extractor) extractZip(archivePath string) error {
+	r, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		if err := x.next(); err != nil {
+			return err
+		}
+		target, err := x.target(f.Name)
+		if err != nil {
+			return err
+		}
+		mode := f.Mode()
+		switch {
+		case target == "":
+		case mode.IsDir():
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+		case mode.IsRegular():
+			// 声明的大小已超出限制时提前失败，实际写入时仍会再次检查
+			if f.UncompressedSize64 > uint64(x.opts.MaxBytes-x.written) {
+				return fmt.Errorf("%w: more than %d bytes uncompressed", errExtractLimit, x.opts.MaxBytes)
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return err
+			}
+			err = x.writeFile(target, rc)
+			rc.Close()
+			if err != nil {
+				return fmt.Errorf("extract %s: %w", f.Name, err)
+			}
+		default:
+			slog.Warn("跳过归档中的非普通文件", "name", f.Name, "mode", mode)
+		}
+	}
+	return nil
+}
+
+func (x *extractor) extractTar(archivePath string, gzipped bool) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var src io.Reader = bufio.NewReader(f)
+	if gzipped {
+		gz, err := gzip.NewReader(src)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		src = gz
+	}
+
+	tr := tar.NewReader(src)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		if err := x.next(); err != nil {
+			return err
+		}
+		target, err := x.target(hdr.Name)
+		if err != nil {
+			return err
+		}
+		switch {
+		case target == "":
+		case hdr.Typeflag == tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+		case hdr.Typeflag == tar.TypeReg:
+			if err := x.writeFile(target, tr); err != nil {
+				return fmt.Errorf("extract %s: %w", hdr.Name, err)
+			}
+		default:
+			slog.Warn("跳过归档中的非普通文件", "name", hdr.Name, "type", string(hdr.Typeflag))
+		}
+	}
+}
+
+// ctxReader 读取前检查上下文，使大文件解压能及时响应任务取消
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
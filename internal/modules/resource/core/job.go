@@ -0,0 +1,308 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/liny/sim-hub/internal/model"
+	"gorm.io/gorm"
+)
+
+// maxProgressMsgLen 进度描述的最大长度，与 jobs.progress_msg 列宽一致
+const maxProgressMsgLen = 500
+
+// 排队任务的重新投递：发布时没有可处理该类型的 Worker 时任务保持 QUEUED，定期重新投递。
+// Worker 已接收、在本地队列中等待的任务由其心跳刷新更新时间 (见 RecordHeartbeat)，不会被重复投递
+const (
+	jobRedispatchInterval = 30 * time.Second
+	jobRedispatchAfter    = 2 * time.Minute // 超过该时间仍未被领取且没有 Worker 确认接收的任务才重新投递
+	jobRedispatchBatch    = 100
+)
+
+var (
+	// ErrJobFinished 任务已结束，无法取消
+	ErrJobFinished = errors.New("job already finished")
+	// ErrInvalidPriority 未知的任务优先级
+	ErrInvalidPriority = errors.New("invalid job priority")
+)
+
+// JobProgressRequest 处理进度上报
+type JobProgressRequest struct {
+	Percent float64          `json:"percent"`
+	Message string           `json:"message,omitempty"`
+	Stages  []model.JobStage `json:"stages,omitempty"` // 流水线各阶段状态快照
+}
+
+// enqueueProcessJob 为版本创建处理任务记录，并把携带处理上下文的任务消息写入发件箱，二者在同一事务中提交；
+// Worker 节点不访问数据库，处理器所需的 ProcessConf 与现有元数据随消息下发。
+// 调用方在事务提交后调用 kickOutbox 以尽快发布
+func (uc *UseCase) enqueueProcessJob(db *gorm.DB, ver model.ResourceVersion, typeKey, priority string) error {
+	// 未登记的类型没有 ProcessConf，按空配置处理
+	var rt model.ResourceType
+	if err := db.Where("type_key = ?", typeKey).Limit(1).Find(&rt).Error; err != nil {
+		return err
+	}
+
+	record := model.Job{
+		ResourceID: ver.ResourceID,
+		VersionID:  ver.ID,
+		TypeKey:    typeKey,
+		Action:     ActionProcess,
+		Priority:   normalizePriority(priority),
+		State:      model.JobStateQueued,
+	}
+	// 重处理时记录版本原有状态 (ver 为重置为 PENDING 之前读取的记录)，首次处理时为空
+	if ver.State != "PENDING" {
+		record.PrevState = ver.State
+	}
+	// 已在事务中时使用保存点
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&record).Error; err != nil {
+			return err
+		}
+		return enqueueJob(tx, buildProcessJob(record, ver, rt.ProcessConf))
+	})
+}
+
+// buildProcessJob 由任务记录组装任务消息
+func buildProcessJob(record model.Job, ver model.ResourceVersion, processConf map[string]any) processJob {
+	return processJob{
+		Action:      ActionProcess,
+		TypeKey:     record.TypeKey,
+		Priority:    record.Priority,
+		ObjectKey:   ver.FilePath,
+		VersionID:   ver.ID,
+		JobID:       record.ID,
+		ResourceID:  ver.ResourceID,
+		ProcessConf: processConf,
+		MetaData:    ver.MetaData,
+	}
+}
+
+// requeueJob 以最新的版本记录与类型配置重新组装任务消息并写入发件箱，由转发器发布；
+// 版本已被删除时任务置为失败，返回 false
+func (uc *UseCase) requeueJob(tx *gorm.DB, record model.Job) (bool, error) {
+	var ver model.ResourceVersion
+	if err := tx.First(&ver, "id = ?", record.VersionID).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, err
+		}
+		return false, tx.Model(&model.Job{}).Where("id = ?", record.ID).Updates(map[string]any{
+			"state":       model.JobStateFailed,
+			"message":     "version no longer exists",
+			"finished_at": time.Now(),
+		}).Error
+	}
+	var rt model.ResourceType
+	if err := tx.Where("type_key = ?", record.TypeKey).Limit(1).Find(&rt).Error; err != nil {
+		return false, err
+	}
+	return true, enqueueJob(tx, buildProcessJob(record, ver, rt.ProcessConf))
+}
+
+func (uc *UseCase) startJobRedispatcher() {
+	ticker := time.NewTicker(jobRedispatchInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		n, err := uc.redispatchQueuedJobs(time.Now().Add(-jobRedispatchAfter))
+		if err != nil {
+			slog.Error("重新投递排队任务失败", "error", err)
+		} else if n > 0 {
+			slog.Info("已重新投递排队任务", "count", n)
+		}
+	}
+}
+
+// redispatchQueuedJobs 重新投递 before 之前仍未被领取的处理任务，返回投递数量。
+// 任务消息重新写入发件箱，由转发器统一发布；发件箱中仍有待发布消息的任务 (如 NATS 不可用期间) 不重复写入
+func (uc *UseCase) redispatchQueuedJobs(before time.Time) (int, error) {
+	var jobs []model.Job
+	if err := uc.data.DB.Where("state = ? AND action = ? AND updated_at < ?", model.JobStateQueued, ActionProcess, before).
+		Where("NOT EXISTS (SELECT 1 FROM outbox_entries WHERE outbox_entries.job_id = jobs.id)").
+		Order("created_at").Limit(jobRedispatchBatch).Find(&jobs).Error; err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, record := range jobs {
+		requeued := false
+		err := uc.data.DB.Transaction(func(tx *gorm.DB) error {
+			// 刷新更新时间，避免下一轮立即重复投递；期间已被领取的任务不再投递
+			result := tx.Model(&model.Job{}).Where("id = ? AND state = ?", record.ID, model.JobStateQueued).Update("updated_at", time.Now())
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
+			}
+			var err error
+			requeued, err = uc.requeueJob(tx, record)
+			return err
+		})
+		if err != nil {
+			return count, err
+		}
+		if requeued {
+			count++
+		}
+	}
+	if count > 0 {
+		uc.kickOutbox()
+	}
+	return count, nil
+}
+
+// reportProgress 根据节点角色上报任务进度 (直接写库、NATS 或 HTTP API)，失败仅记录日志
+func (uc *UseCase) reportProgress(ctx context.Context, jobID string, req JobProgressRequest) {
+	if jobID == "" {
+		return
+	}
+
+	var err error
+	switch {
+	case uc.role == "api" || uc.role == "combined":
+		err = uc.UpdateJobProgress(ctx, jobID, req)
+	case uc.resultsOverNATS():
+		err = uc.publishProgress(jobID, req)
+	default:
+		err = uc.callAPI(ctx, http.MethodPatch, "/api/v1/jobs/"+jobID+"/progress", req)
+	}
+	if err != nil {
+		slog.Warn("任务进度上报失败", "job_id", jobID, "error", err)
+	}
+}
+
+// UpdateJobProgress 更新任务进度，首次上报时任务进入 RUNNING 状态
+func (uc *UseCase) UpdateJobProgress(ctx context.Context, jobID string, req JobProgressRequest) error {
+	msg := req.Message
+	if len(msg) > maxProgressMsgLen {
+		msg = msg[:maxProgressMsgLen]
+	}
+
+	updates := map[string]any{
+		"state":        model.JobStateRunning,
+		"progress":     req.Percent,
+		"progress_msg": msg,
+		"started_at":   gorm.Expr("COALESCE(started_at, ?)", time.Now()),
+	}
+	if len(req.Stages) > 0 {
+		stages, err := json.Marshal(req.Stages)
+		if err != nil {
+			return err
+		}
+		// map 更新不经过字段序列化器，需手动编码
+		updates["stages"] = string(stages)
+	}
+
+	// 已结束的任务忽略迟到的进度
+	return uc.data.DB.Model(&model.Job{}).
+		Where("id = ? AND state IN ?", jobID, []string{model.JobStateQueued, model.JobStateRunning}).
+		Updates(updates).Error
+}
+
+// finishJob 根据处理结果结束排队或运行中的任务，返回任务是否由本次结果结束；
+// 条件更新保证同一任务的重复或并发投递中只有一个结果生效，已取消与已结束的任务保持不变
+func (uc *UseCase) finishJob(tx *gorm.DB, jobID string, req ProcessResultRequest) (bool, error) {
+	updates := map[string]any{
+		"message":     req.Message,
+		"finished_at": time.Now(),
+	}
+	if len(req.Stages) > 0 {
+		stages, err := json.Marshal(req.Stages)
+		if err != nil {
+			return false, err
+		}
+		updates["stages"] = string(stages)
+	}
+	if req.State == "ACTIVE" {
+		updates["state"] = model.JobStateSucceeded
+		updates["progress"] = 100
+	} else {
+		updates["state"] = model.JobStateFailed
+	}
+	result := tx.Model(&model.Job{}).
+		Where("id = ? AND state IN ?", jobID, []string{model.JobStateQueued, model.JobStateRunning}).
+		Updates(updates)
+	return result.RowsAffected > 0, result.Error
+}
+
+// CancelJob 取消排队或运行中的任务：Worker 本地队列中的任务被移除，正在执行的任务通过上下文终止处理器
+func (uc *UseCase) CancelJob(ctx context.Context, id string) (*model.Job, error) {
+	var job model.Job
+	err := uc.data.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&job, "id = ?", id).Error; err != nil {
+			return err
+		}
+		result := tx.Model(&model.Job{}).
+			Where("id = ? AND state IN ?", id, []string{model.JobStateQueued, model.JobStateRunning}).
+			Updates(map[string]any{
+				"state":       model.JobStateCanceled,
+				"message":     "canceled by user",
+				"finished_at": time.Now(),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrJobFinished
+		}
+		// 尚未发布的任务直接从发件箱移除
+		if err := tx.Delete(&model.OutboxEntry{}, "job_id = ?", id).Error; err != nil {
+			return err
+		}
+		// 版本仍在等待该任务的结果：重处理恢复版本原有的状态 (元数据在结果上报前未被改动)，
+		// 首次处理标记为失败，以免一直停留在 PENDING
+		updates := map[string]any{"state": "ERROR", "error_message": "Processing canceled"}
+		if job.PrevState != "" {
+			updates = map[string]any{"state": job.PrevState}
+		}
+		if err := tx.Model(&model.ResourceVersion{}).Where("id = ? AND state = ?", job.VersionID, "PENDING").
+			Updates(updates).Error; err != nil {
+			return err
+		}
+		return tx.First(&job, "id = ?", id).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 任务可能在任意 Worker 上排队或执行，通过 NATS 广播取消；单机模式直接取消本地任务
+	if uc.nats != nil && uc.nats.Config.Enabled {
+		if err := uc.nats.Encoded.Publish(uc.workerSubject()+".cancel", &jobCancel{JobID: id}); err != nil {
+			slog.Error("广播任务取消失败", "job_id", id, "error", err)
+		}
+	} else {
+		uc.cancelLocal(id)
+	}
+	slog.Info("任务已取消", "job_id", id, "type", job.TypeKey)
+	return &job, nil
+}
+
+// GetJob 获取任务详情
+func (uc *UseCase) GetJob(ctx context.Context, id string) (*model.Job, error) {
+	var job model.Job
+	if err := uc.data.DB.First(&job, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ListJobs 列出任务，按创建时间倒序
+func (uc *UseCase) ListJobs(ctx context.Context, versionID, state string, page, size int) ([]model.Job, int64, error) {
+	var jobs []model.Job
+	var total int64
+
+	query := uc.data.DB.Model(&model.Job{})
+	if versionID != "" {
+		query = query.Where("version_id = ?", versionID)
+	}
+	if state != "" {
+		query = query.Where("state = ?", state)
+	}
+
+	if err := query.Count(&total).Limit(size).Offset((page - 1) * size).Order("created_at desc").Find(&jobs).Error; err != nil {
+		return nil, 0, err
+	}
+	return jobs, total, nil
+}
@@ -0,0 +1,60 @@
+package core
+
+import "sync"
+
+// defaultWorkerConcurrency 未配置 worker.concurrency 时同时执行的任务数
+const defaultWorkerConcurrency = 4
+
+// jobLimiter 限制 Worker 同时执行的任务数 (全局及按资源类型)
+// 等待槽位由 jobQueue 负责：出队时 TryAcquire，释放后唤醒队列
+type jobLimiter struct {
+	mu         sync.Mutex
+	limit      int
+	typeLimits map[string]int
+	total      int
+	running    map[string]int
+}
+
+func newJobLimiter(limit int, typeLimits map[string]int) *jobLimiter {
+	if limit <= 0 {
+		limit = defaultWorkerConcurrency
+	}
+	return &jobLimiter{limit: limit, typeLimits: typeLimits, running: make(map[string]int)}
+}
+
+// available 判断是否还能为该类型分配执行槽位，调用方需持有锁
+func (l *jobLimiter) available(typeKey string) bool {
+	if l.total >= l.limit {
+		return false
+	}
+	if max := l.typeLimits[typeKey]; max > 0 && l.running[typeKey] >= max {
+		return false
+	}
+	return true
+}
+
+// Saturated 判断该类型当前是否已无可用槽位
+func (l *jobLimiter) Saturated(typeKey string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return !l.available(typeKey)
+}
+
+// TryAcquire 尝试为该类型占用一个槽位，无可用槽位时立即返回 false
+func (l *jobLimiter) TryAcquire(typeKey string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.available(typeKey) {
+		return false
+	}
+	l.total++
+	l.running[typeKey]++
+	return true
+}
+
+func (l *jobLimiter) Release(typeKey string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.total--
+	l.running[typeKey]--
+}
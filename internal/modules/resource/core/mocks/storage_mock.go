@@ -41,6 +41,18 @@ func (m *MockBlobStore) Get(ctx context.Context, bucket, key string) (io.ReadClo
 	return args.Get(0).(io.ReadCloser), args.Error(1)
 }
 
+// GetRange 返回值可以是 io.ReadCloser，或按范围生成内容的 func(offset, length int64) io.ReadCloser
+func (m *MockBlobStore) GetRange(ctx context.Context, bucket, key string, offset, length int64) (io.ReadCloser, error) {
+	args := m.Called(ctx, bucket, key, offset, length)
+	if fn, ok := args.Get(0).(func(offset, length int64) io.ReadCloser); ok {
+		return fn(offset, length), args.Error(1)
+	}
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(io.ReadCloser), args.Error(1)
+}
+
 func (m *MockBlobStore) DownloadFile(ctx context.Context, bucket, key, localPath string) error {
 	args := m.Called(ctx, bucket, key, localPath)
 	return args.Error(0)
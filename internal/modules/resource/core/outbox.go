@@ -0,0 +1,106 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/liny/sim-hub/internal/model"
+	"gorm.io/gorm"
+)
+
+// 任务发件箱：任务消息与任务记录在同一事务中写入 outbox_entries，事务提交后由转发器发布。
+// 回滚的事务不会发布任务；NATS 不可用时消息留在发件箱中退避重试，不会丢失。
+// 转发器在发布后、删除前崩溃会导致重复发布，结果回调以任务 ID 幂等，重复处理不会重复生效。
+const (
+	outboxRelayInterval = time.Second
+	outboxBatch         = 100
+	outboxLease         = 30 * time.Second // 占用后未完成发布的消息在租约到期后可被其他节点重新发布
+	outboxRetryBase     = time.Second
+	outboxMaxBackoff    = time.Minute
+)
+
+// errNoJobConsumer 未启用 NATS 的 API 节点没有任务的接收方
+var errNoJobConsumer = errors.New("nats is disabled and this api node does not execute jobs")
+
+// enqueueJob 在事务中写入待发布的任务消息
+func enqueueJob(tx *gorm.DB, job processJob) error {
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&model.OutboxEntry{
+		JobID:       job.JobID,
+		Payload:     string(payload),
+		AvailableAt: time.Now(),
+	}).Error
+}
+
+// kickOutbox 事务提交后唤醒转发器，尽快发布新写入的消息
+func (uc *UseCase) kickOutbox() {
+	select {
+	case uc.outboxKick <- struct{}{}:
+	default:
+	}
+}
+
+// startOutboxRelay 转发器：被唤醒或定期发布发件箱中的消息
+func (uc *UseCase) startOutboxRelay() {
+	ticker := time.NewTicker(outboxRelayInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-uc.outboxKick:
+		case <-ticker.C:
+		}
+		if _, err := uc.relayOutbox(time.Now()); err != nil {
+			slog.Error("发布发件箱消息失败", "error", err)
+		}
+	}
+}
+
+// relayOutbox 按写入顺序发布到期的消息，发布成功后删除，返回发布数量
+func (uc *UseCase) relayOutbox(now time.Time) (int, error) {
+	var entries []model.OutboxEntry
+	if err := uc.data.DB.Where("available_at <= ?", now).Order("created_at").Limit(outboxBatch).Find(&entries).Error; err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, e := range entries {
+		// 以尝试次数做乐观锁占用消息，多个 API 节点同时转发时只有一个成功
+		result := uc.data.DB.Model(&model.OutboxEntry{}).
+			Where("id = ? AND attempts = ?", e.ID, e.Attempts).
+			Updates(map[string]any{"attempts": e.Attempts + 1, "available_at": now.Add(outboxLease)})
+		if result.Error != nil {
+			return count, result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		var job processJob
+		if err := json.Unmarshal([]byte(e.Payload), &job); err != nil {
+			slog.Error("发件箱消息无法解析，丢弃", "id", e.ID, "job_id", e.JobID, "error", err)
+			uc.data.DB.Delete(&model.OutboxEntry{}, "id = ?", e.ID)
+			continue
+		}
+
+		if err := uc.publishJob(job); err != nil {
+			backoff := min(outboxRetryBase<<min(e.Attempts, 10), outboxMaxBackoff)
+			uc.data.DB.Model(&model.OutboxEntry{}).Where("id = ?", e.ID).Updates(map[string]any{
+				"last_error":   err.Error(),
+				"available_at": now.Add(backoff),
+			})
+			// 消息通道不可用时其余消息同样会失败，等待下一轮
+			slog.Warn("发布任务失败，稍后重试", "job_id", e.JobID, "attempts", e.Attempts+1, "retry_in", backoff, "error", err)
+			return count, nil
+		}
+		if err := uc.data.DB.Delete(&model.OutboxEntry{}, "id = ?", e.ID).Error; err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
@@ -0,0 +1,224 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/liny/sim-hub/internal/model"
+)
+
+// progressReportInterval 进度转发的最小间隔，避免处理器高频输出压垮 API
+const progressReportInterval = time.Second
+
+// PipelineStage ProcessConf.pipeline 中声明的处理阶段
+//
+// 支持两种写法：
+//
+//	pipeline: ["hash", "validate", "extract"]
+//	pipeline: [{name: "thumbnail", optional: true}]
+//
+// 每个阶段按名称映射到 Worker 的 handlers 配置，可选阶段失败或无处理器时不影响版本激活；
+// 缺少必需阶段处理器的 Worker 不接收该任务 (见 processResourceInternal)。
+type PipelineStage struct {
+	Name     string
+	Optional bool
+}
+
+// parsePipeline 从 ProcessConf 中解析流水线阶段，未配置时返回空
+func parsePipeline(processConf map[string]any) []PipelineStage {
+	raw, _ := processConf["pipeline"].([]any)
+	stages := make([]PipelineStage, 0, len(raw))
+	for _, item := range raw {
+		switch v := item.(type) {
+		case string:
+			if v != "" {
+				stages = append(stages, PipelineStage{Name: v})
+			}
+		case map[string]any:
+			name, _ := v["name"].(string)
+			optional, _ := v["optional"].(bool)
+			if name != "" {
+				stages = append(stages, PipelineStage{Name: name, Optional: optional})
+			}
+		}
+	}
+	return stages
+}
+
+// missingStages 本节点没有处理器的必需阶段
+func (uc *UseCase) missingStages(stages []PipelineStage) []string {
+	var missing []string
+	for _, st := range stages {
+		if !st.Optional && !uc.hasProcessor(st.Name) {
+			missing = append(missing, st.Name)
+		}
+	}
+	return missing
+}
+
+// pipelineResult 流水线执行结果
+type pipelineResult struct {
+	MetaData         map[string]any
+	Renditions       []RenditionDTO
+	Stages           []model.JobStage
+	ProcessorVersion string
+	Failure          string // 必需阶段失败时的错误信息
+}
+
+// progressReporter 汇总各阶段进度并节流转发
+type progressReporter struct {
+	uc         *UseCase
+	ctx        context.Context
+	jobID      string
+	mu         sync.Mutex
+	lastReport time.Time
+}
+
+func (r *progressReporter) report(percent float64, msg string, stages []model.JobStage, force bool) {
+	r.mu.Lock()
+	if !force && time.Since(r.lastReport) < progressReportInterval {
+		r.mu.Unlock()
+		return
+	}
+	r.lastReport = time.Now()
+	snapshot := append([]model.JobStage(nil), stages...)
+	r.mu.Unlock()
+
+	r.uc.reportProgress(r.ctx, r.jobID, JobProgressRequest{Percent: percent, Message: msg, Stages: snapshot})
+}
+
+// runPipeline 依次执行各阶段，阶段间串联累计元数据与输出目录
+func (uc *UseCase) runPipeline(ctx context.Context, job processJob, stages []PipelineStage, inputPath string) pipelineResult {
+	result := pipelineResult{
+		MetaData: make(map[string]any),
+		Stages:   make([]model.JobStage, len(stages)),
+	}
+	for i, st := range stages {
+		result.Stages[i] = model.JobStage{Name: st.Name, Optional: st.Optional, State: model.StageStatePending}
+	}
+
+	reporter := &progressReporter{uc: uc, ctx: ctx, jobID: job.JobID}
+	var warnings []string
+	prevOutputDir := ""
+
+	for i, st := range stages {
+		status := &result.Stages[i]
+		total := float64(len(stages))
+
+		if !uc.hasProcessor(st.Name) {
+			if st.Optional {
+				status.State = model.StageStateSkipped
+				status.Message = "no handler configured"
+				continue
+			}
+			status.State = model.JobStateFailed
+			status.Message = "no handler configured"
+			result.Failure = fmt.Sprintf("stage %s: no handler configured", st.Name)
+			break
+		}
+
+		status.State = model.JobStateRunning
+		reporter.report(float64(i)*100/total, "stage "+st.Name, result.Stages, true)
+
+		outputDir, err := os.MkdirTemp("", "simhub-output-*")
+		if err != nil {
+			status.State = model.JobStateFailed
+			status.Message = err.Error()
+			result.Failure = fmt.Sprintf("Failed to create output dir: %v", err)
+			break
+		}
+		defer os.RemoveAll(outputDir)
+
+		// 阶段输入的元数据：版本现有元数据叠加此前阶段的输出
+		stageMeta := make(map[string]any, len(job.MetaData)+len(result.MetaData))
+		for k, v := range job.MetaData {
+			stageMeta[k] = v
+		}
+		for k, v := range result.MetaData {
+			stageMeta[k] = v
+		}
+
+		startTime := time.Now()
+		out, err := uc.invokeProcessor(ctx, processorInvocation{
+			Job:           job,
+			Handler:       st.Name,
+			CmdLine:       uc.handlers[st.Name],
+			FilePath:      inputPath,
+			OutputDir:     outputDir,
+			PrevOutputDir: prevOutputDir,
+			MetaData:      stageMeta,
+			OnProgress: func(ev ProgressEvent) {
+				reporter.report((float64(i)*100+ev.Percent)/total, ev.Message, result.Stages, false)
+			},
+		})
+		status.DurationMs = time.Since(startTime).Milliseconds()
+		if err == nil && out.Status == ProcessorStatusFailed {
+			err = fmt.Errorf("%s", out.Error)
+		}
+		var renditions []RenditionDTO
+		if err == nil {
+			if renditions, err = uc.uploadRenditions(ctx, job, st.Name, outputDir, out.Renditions); err != nil {
+				err = fmt.Errorf("Failed to upload renditions: %w", err)
+			}
+		}
+		if err != nil {
+			status.State = model.JobStateFailed
+			status.Message = err.Error()
+			if st.Optional {
+				slog.Warn("可选处理阶段失败", "stage", st.Name, "key", job.ObjectKey, "error", err)
+				warnings = append(warnings, fmt.Sprintf("stage %s failed: %v", st.Name, err))
+				continue
+			}
+			slog.Error("处理阶段失败", "stage", st.Name, "key", job.ObjectKey, "error", err)
+			result.Failure = err.Error()
+			if len(stages) > 1 {
+				result.Failure = fmt.Sprintf("stage %s: %v", st.Name, err)
+			}
+			break
+		}
+
+		status.State = model.JobStateSucceeded
+		slog.Info("处理阶段完成", "stage", st.Name, "duration_ms", status.DurationMs)
+		for k, v := range out.Metadata {
+			result.MetaData[k] = v
+		}
+		warnings = append(warnings, out.Warnings...)
+		result.Renditions = append(result.Renditions, renditions...)
+		prevOutputDir = outputDir
+	}
+
+	// 必需阶段失败后，剩余阶段不再执行
+	if result.Failure != "" {
+		for i := range result.Stages {
+			if result.Stages[i].State == model.StageStatePending {
+				result.Stages[i].State = model.StageStateSkipped
+			}
+		}
+	}
+	if len(warnings) > 0 {
+		result.MetaData["processor_warnings"] = warnings
+	}
+
+	result.ProcessorVersion = pipelineVersion(stages, uc.processorVersions)
+	return result
+}
+
+// pipelineVersion 流水线的处理器版本：单阶段沿用处理器自身版本号，多阶段按配置顺序以必需阶段的
+// "阶段@版本" 组合标识。可选阶段不参与，版本号不随可选阶段的成败变化
+func pipelineVersion(stages []PipelineStage, versions map[string]string) string {
+	if len(stages) == 1 {
+		return versions[stages[0].Name]
+	}
+	var parts []string
+	for _, st := range stages {
+		if !st.Optional {
+			parts = append(parts, st.Name+"@"+versions[st.Name])
+		}
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,289 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// 处理器协议版本
+//
+//	v1: 以 argv `<cmd...> <file>` 调用，处理器只能拿到文件路径
+//	v2: 以 argv `<cmd...>` 调用，stdin 传入 ProcessorRequest；stderr 中的 ProgressEvent 行被识别为进度
+//
+// 处理器不经过 shell 执行，运行限制见 runSandboxed。
+//
+// 两个版本的 stdout 输出均遵循下方 ProcessorOutput 约定。
+const (
+	ProcessorProtocolV1 = 1
+	ProcessorProtocolV2 = 2
+)
+
+// 处理器输出约定 (stdout，单个 JSON 对象)：
+//
+//	{
+//	  "status":   "success" | "failed",   // 必填
+//	  "metadata": { ... },                // success 时合并到版本元数据
+//	  "error":    "...",                  // failed 时必填，作为版本的错误信息
+//	  "warnings": ["...", ...],           // 可选，记录在 metadata.processor_warnings
+//	  "renditions": [                     // 可选，声明输出目录中派生文件的角色
+//	    {"path": "thumb.png", "role": "thumbnail", "content_type": "image/png"}
+//	  ]
+//	}
+//
+// 处理器写入输出目录 (v2 请求中的 output_dir，或环境变量 SIMHUB_OUTPUT_DIR) 的文件
+// 会被上传为派生文件，未声明角色的文件记为 artifact。
+//
+// 进程退出码非 0 视为执行失败；退出码为 0 但 status 为 failed 视为业务失败，
+// 两者都会把版本置为 ERROR。无法按约定解析的输出同样按失败处理。
+const (
+	ProcessorStatusSuccess = "success"
+	ProcessorStatusFailed  = "failed"
+)
+
+// ProcessorOutput 处理器的标准输出结构
+type ProcessorOutput struct {
+	Status     string          `json:"status"`
+	Metadata   map[string]any  `json:"metadata,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Warnings   []string        `json:"warnings,omitempty"`
+	Renditions []RenditionSpec `json:"renditions,omitempty"`
+}
+
+// parseProcessorOutput 按输出约定严格解析处理器 stdout
+func parseProcessorOutput(stdout []byte) (*ProcessorOutput, error) {
+	if len(bytes.TrimSpace(stdout)) == 0 {
+		return nil, errors.New("processor produced no output")
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(stdout))
+	dec.DisallowUnknownFields()
+
+	var out ProcessorOutput
+	if err := dec.Decode(&out); err != nil {
+		return nil, fmt.Errorf("processor output is not a valid result object: %w", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("processor output contains trailing data")
+	}
+	if err := validateProcessorOutput(&out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// validateProcessorOutput 校验输出状态，failed 缺少错误信息时补充默认描述
+func validateProcessorOutput(out *ProcessorOutput) error {
+	switch out.Status {
+	case ProcessorStatusSuccess:
+	case ProcessorStatusFailed:
+		if out.Error == "" {
+			out.Error = "processor reported failure without message"
+		}
+	default:
+		return fmt.Errorf("unrecognised processor status %q", out.Status)
+	}
+	return nil
+}
+
+// ProcessorRequest v2 协议下通过 stdin 传给处理器的请求
+type ProcessorRequest struct {
+	Protocol      int            `json:"protocol"`
+	FilePath      string         `json:"file_path"`
+	TypeKey       string         `json:"type_key"`
+	Stage         string         `json:"stage,omitempty"` // 当前流水线阶段
+	ResourceID    string         `json:"resource_id"`
+	VersionID     string         `json:"version_id"`
+	JobID         string         `json:"job_id,omitempty"`
+	OutputDir     string         `json:"output_dir"`                // 派生文件输出目录
+	PrevOutputDir string         `json:"prev_output_dir,omitempty"` // 上一阶段的输出目录，用于串联阶段产物
+	ProcessConf   map[string]any `json:"process_conf,omitempty"`
+	MetaData      map[string]any `json:"meta_data,omitempty"` // 版本现有元数据叠加此前阶段的输出
+}
+
+// ProgressEvent v2 协议下处理器写入 stderr 的进度事件 (单行 JSON)，例如：
+//
+//	{"event":"progress","percent":40,"message":"extracting"}
+type ProgressEvent struct {
+	Event   string  `json:"event"`
+	Percent float64 `json:"percent"`
+	Message string  `json:"message,omitempty"`
+}
+
+// progressWriter 逐行扫描 stderr，识别进度事件并回调，其余内容保留用于错误诊断 (最多 maxStderrLogBytes)
+type progressWriter struct {
+	onProgress func(ProgressEvent)
+	pending    []byte
+	logs       bytes.Buffer
+	truncated  bool
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.pending = append(w.pending, p...)
+	for {
+		i := bytes.IndexByte(w.pending, '\n')
+		if i < 0 {
+			break
+		}
+		w.handleLine(w.pending[:i])
+		w.pending = w.pending[i+1:]
+	}
+	// 不换行的超长输出按一行处理，避免无限累积
+	if len(w.pending) > maxStderrLogBytes {
+		w.Flush()
+	}
+	return len(p), nil
+}
+
+// Flush 处理末尾不以换行结束的内容
+func (w *progressWriter) Flush() {
+	if len(w.pending) > 0 {
+		w.handleLine(w.pending)
+		w.pending = nil
+	}
+}
+
+func (w *progressWriter) handleLine(line []byte) {
+	trimmed := bytes.TrimSpace(line)
+	if w.onProgress != nil && len(trimmed) > 0 && trimmed[0] == '{' {
+		var ev ProgressEvent
+		if err := json.Unmarshal(trimmed, &ev); err == nil && ev.Event == "progress" {
+			w.onProgress(ev)
+			return
+		}
+	}
+	if w.logs.Len()+len(line) >= maxStderrLogBytes {
+		if !w.truncated {
+			w.logs.WriteString("...[truncated]\n")
+			w.truncated = true
+		}
+		return
+	}
+	w.logs.Write(line)
+	w.logs.WriteByte('\n')
+}
+
+func (w *progressWriter) String() string {
+	return w.logs.String()
+}
+
+// handlerProtocol 获取处理器的协议版本，未配置时为 v1
+func (uc *UseCase) handlerProtocol(handler string) int {
+	if opt, ok := uc.handlerOptions[handler]; ok && opt.Protocol > 0 {
+		return opt.Protocol
+	}
+	return ProcessorProtocolV1
+}
+
+// processorInvocation 一次处理器调用的输入
+type processorInvocation struct {
+	Job           processJob
+	Handler       string // 处理器键：流水线阶段名，或未配置流水线时的资源类型
+	CmdLine       string
+	FilePath      string
+	OutputDir     string
+	PrevOutputDir string                 // 上一阶段的输出目录，首个阶段为空
+	MetaData      map[string]any         // 截至当前阶段累计的元数据
+	OnProgress    func(ev ProgressEvent) // v2 协议下的进度回调
+}
+
+// runProcessor 执行外部处理器并解析其输出，返回的 error 表示执行失败 (消息已包含 stderr)
+func (uc *UseCase) runProcessor(ctx context.Context, inv processorInvocation) (*ProcessorOutput, error) {
+	protocol := uc.handlerProtocol(inv.Handler)
+	argv, err := splitCommand(inv.CmdLine)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid handler command: %w", err)
+	}
+
+	// WASM 处理器只能看到挂载进沙箱的目录，请求中的路径替换为沙箱内路径
+	filePath, outputDir, prevOutputDir := inv.FilePath, inv.OutputDir, inv.PrevOutputDir
+	wasm := isWasmModule(argv[0])
+	var mounts []wasmMount
+	if wasm {
+		inputDir := inv.FilePath
+		if info, err := os.Stat(inv.FilePath); err == nil && info.IsDir() {
+			// 解压后的目录本身就是独立的临时目录，直接挂载
+			filePath = wasmInputDir
+		} else {
+			if inputDir, err = stageWasmInput(inv.FilePath); err != nil {
+				return nil, fmt.Errorf("Failed to stage wasm input: %w", err)
+			}
+			defer os.RemoveAll(inputDir)
+			filePath = path.Join(wasmInputDir, filepath.Base(inv.FilePath))
+		}
+		outputDir = wasmOutputDir
+		mounts = []wasmMount{
+			{HostDir: inputDir, GuestPath: wasmInputDir, ReadOnly: true},
+			{HostDir: inv.OutputDir, GuestPath: wasmOutputDir},
+		}
+		if prevOutputDir != "" {
+			prevOutputDir = wasmPrevDir
+			mounts = append(mounts, wasmMount{HostDir: inv.PrevOutputDir, GuestPath: wasmPrevDir, ReadOnly: true})
+		}
+	}
+
+	limits := limitsFor(uc.handlerOptions[inv.Handler])
+	stdout := &limitedBuffer{limit: limits.OutputBytes}
+	stderr := &progressWriter{}
+	var stdin io.Reader
+	if protocol >= ProcessorProtocolV2 {
+		reqBody, err := json.Marshal(ProcessorRequest{
+			Protocol:      protocol,
+			FilePath:      filePath,
+			TypeKey:       inv.Job.TypeKey,
+			Stage:         inv.Handler,
+			ResourceID:    inv.Job.ResourceID,
+			VersionID:     inv.Job.VersionID,
+			JobID:         inv.Job.JobID,
+			OutputDir:     outputDir,
+			PrevOutputDir: prevOutputDir,
+			ProcessConf:   inv.Job.ProcessConf,
+			MetaData:      inv.MetaData,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("encode processor request: %w", err)
+		}
+		stdin = bytes.NewReader(reqBody)
+		stderr.onProgress = inv.OnProgress
+	} else {
+		// 文件路径作为独立参数传入，不会被解释
+		argv = append(argv, filePath)
+	}
+
+	run := sandboxedRun{
+		Argv:      argv,
+		Stdin:     stdin,
+		Stdout:    stdout,
+		Stderr:    stderr,
+		OutputDir: outputDir,
+		Limits:    limits,
+	}
+	if wasm {
+		err = runWasm(ctx, run, mounts)
+	} else {
+		err = runSandboxed(ctx, run)
+	}
+	stderr.Flush()
+	if stdout.exceeded {
+		slog.Error("处理器输出超出上限", "handler", inv.Handler, "limit", limits.OutputBytes)
+		return nil, fmt.Errorf("Processor failed: output exceeds %d bytes", limits.OutputBytes)
+	}
+	if err != nil {
+		slog.Error("外部处理器执行失败", "error", err, "stderr", stderr.String())
+		return nil, fmt.Errorf("Processor failed: %v, stderr: %s", err, stderr.String())
+	}
+
+	out, err := parseProcessorOutput(stdout.Bytes())
+	if err != nil {
+		slog.Error("处理器输出不符合约定", "error", err, "output", stdout.String())
+		return nil, fmt.Errorf("Invalid processor output: %w", err)
+	}
+	return out, nil
+}
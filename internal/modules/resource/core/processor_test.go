@@ -0,0 +1,405 @@
+package core
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/liny/sim-hub/internal/conf"
+	"github.com/liny/sim-hub/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestMain 测试二进制同样需要充当处理器的启动垫片
+func TestMain(m *testing.M) {
+	MaybeRunRlimitShim()
+	os.Exit(m.Run())
+}
+
+func TestParseProcessorOutput(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		out, err := parseProcessorOutput([]byte(`{"status":"success","metadata":{"files_count":3},"warnings":["no thumbnail"]}` + "\n"))
+		assert.NoError(t, err)
+		assert.Equal(t, ProcessorStatusSuccess, out.Status)
+		assert.EqualValues(t, 3, out.Metadata["files_count"])
+		assert.Equal(t, []string{"no thumbnail"}, out.Warnings)
+	})
+
+	t.Run("Business Failure", func(t *testing.T) {
+		out, err := parseProcessorOutput([]byte(`{"status":"failed","error":"Failed to open zip"}`))
+		assert.NoError(t, err)
+		assert.Equal(t, ProcessorStatusFailed, out.Status)
+		assert.Equal(t, "Failed to open zip", out.Error)
+	})
+
+	t.Run("Rejects Unrecognised Output", func(t *testing.T) {
+		for _, raw := range []string{
+			``,
+			`not json`,
+			`{"files_count":3}`,
+			`{"status":"done"}`,
+			`{"status":"success","extra":1}`,
+			`{"status":"success"} {"status":"success"}`,
+		} {
+			_, err := parseProcessorOutput([]byte(raw))
+			assert.Error(t, err, raw)
+		}
+	})
+}
+
+func TestProgressWriter(t *testing.T) {
+	var events []ProgressEvent
+	w := &progressWriter{onProgress: func(ev ProgressEvent) { events = append(events, ev) }}
+
+	w.Write([]byte("loading\n{\"event\":\"progress\",\"perc"))
+	w.Write([]byte("ent\":40,\"message\":\"extracting\"}\n{\"other\":1}\ntail"))
+	w.Flush()
+
+	assert.Equal(t, []ProgressEvent{{Event: "progress", Percent: 40, Message: "extracting"}}, events)
+	assert.Equal(t, "loading\n{\"other\":1}\ntail\n", w.String())
+}
+
+func TestRunProcessorProtocolV2(t *testing.T) {
+	uc, _, _ := setupDBUseCase(t)
+	uc.handlerOptions = map[string]conf.HandlerOption{"scenario": {Protocol: ProcessorProtocolV2}}
+
+	// 处理器回显 stdin 中的请求，并输出一条进度事件
+	cmdLine := writeScript(t, `read -r req; echo '{"event":"progress","percent":100,"message":"done"}' >&2; echo "{\"status\":\"success\",\"metadata\":{\"request\":$req}}"`)
+	var events []ProgressEvent
+	out, err := uc.runProcessor(context.Background(), processorInvocation{
+		Job:        processJob{TypeKey: "scenario", VersionID: "v1", ResourceID: "r1", ProcessConf: map[string]any{"engine": "x"}},
+		Handler:    "scenario",
+		CmdLine:    cmdLine,
+		FilePath:   "/tmp/demo.zip",
+		OutputDir:  t.TempDir(),
+		OnProgress: func(ev ProgressEvent) { events = append(events, ev) },
+	})
+	assert.NoError(t, err)
+
+	req := out.Metadata["request"].(map[string]any)
+	assert.Equal(t, "/tmp/demo.zip", req["file_path"])
+	assert.Equal(t, "r1", req["resource_id"])
+	assert.EqualValues(t, ProcessorProtocolV2, req["protocol"])
+	assert.NotNil(t, req["process_conf"])
+	assert.Equal(t, []ProgressEvent{{Event: "progress", Percent: 100, Message: "done"}}, events)
+}
+
+// writeScript 写入可执行的 shell 脚本作为测试处理器
+func writeScript(t *testing.T, body string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "processor.sh")
+	assert.NoError(t, os.WriteFile(p, []byte("#!/bin/sh\n"+body+"\n"), 0o755))
+	return p
+}
+
+func TestSplitCommand(t *testing.T) {
+	args, err := splitCommand(`./bin/proc --mode "fast scan" 'a b' c\ d`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"./bin/proc", "--mode", "fast scan", "a b", "c d"}, args)
+
+	_, err = splitCommand(`proc "unterminated`)
+	assert.Error(t, err)
+	_, err = splitCommand("  ")
+	assert.Error(t, err)
+}
+
+func TestRunProcessorSandbox(t *testing.T) {
+	uc, _, _ := setupDBUseCase(t)
+	ctx := context.Background()
+	invoke := func(cmdLine, filePath string) (*ProcessorOutput, error) {
+		return uc.runProcessor(ctx, processorInvocation{
+			Job:       processJob{TypeKey: "scenario"},
+			Handler:   "scenario",
+			CmdLine:   cmdLine,
+			FilePath:  filePath,
+			OutputDir: t.TempDir(),
+		})
+	}
+
+	t.Run("File Path Is Not Interpreted", func(t *testing.T) {
+		marker := filepath.Join(t.TempDir(), "pwned")
+		script := writeScript(t, `printf '{"status":"success","metadata":{"path":"%s"}}' "$1"`)
+		out, err := invoke(script, "x';touch "+marker+";'")
+		assert.NoError(t, err)
+		assert.Equal(t, "x';touch "+marker+";'", out.Metadata["path"])
+		assert.NoFileExists(t, marker)
+	})
+
+	t.Run("Scrubbed Env And Private Work Dir", func(t *testing.T) {
+		t.Setenv("SIMHUB_TEST_SECRET", "s3cr3t")
+		script := writeScript(t, `printf '{"status":"success","metadata":{"secret":"%s","home":"%s","pwd":"%s"}}' "$SIMHUB_TEST_SECRET" "$HOME" "$(pwd)"`)
+		out, err := invoke(script, "in.zip")
+		assert.NoError(t, err)
+		assert.Equal(t, "", out.Metadata["secret"])
+		assert.Equal(t, out.Metadata["home"], out.Metadata["pwd"])
+		assert.NoDirExists(t, out.Metadata["pwd"].(string))
+
+		uc.handlerOptions = map[string]conf.HandlerOption{"scenario": {PassEnv: []string{"SIMHUB_TEST_SECRET"}}}
+		defer func() { uc.handlerOptions = nil }()
+		out, err = invoke(script, "in.zip")
+		assert.NoError(t, err)
+		assert.Equal(t, "s3cr3t", out.Metadata["secret"])
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		uc.handlerOptions = map[string]conf.HandlerOption{"scenario": {Timeout: 200 * time.Millisecond}}
+		defer func() { uc.handlerOptions = nil }()
+		start := time.Now()
+		_, err := invoke(writeScript(t, `sleep 30 & sleep 30`), "in.zip")
+		assert.ErrorContains(t, err, "timed out after 200ms")
+		assert.Less(t, time.Since(start), 10*time.Second)
+	})
+
+	t.Run("Resource Limits", func(t *testing.T) {
+		if runtime.GOOS != "linux" {
+			t.Skip("resource limits are only applied on linux")
+		}
+		uc.handlerOptions = map[string]conf.HandlerOption{"scenario": {MaxOpenFiles: 100, MaxMemoryMB: 512}}
+		defer func() { uc.handlerOptions = nil }()
+		// 处理器启动时即受限制
+		out, err := invoke(writeScript(t, `printf '{"status":"success","metadata":{"nofile":"%s","as":"%s"}}' "$(ulimit -n)" "$(ulimit -v)"`), "in.zip")
+		assert.NoError(t, err)
+		assert.Equal(t, "100", out.Metadata["nofile"])
+		assert.Equal(t, "524288", out.Metadata["as"])
+	})
+
+	t.Run("Output Cap", func(t *testing.T) {
+		uc.handlerOptions = map[string]conf.HandlerOption{"scenario": {MaxOutputBytes: 64}}
+		defer func() { uc.handlerOptions = nil }()
+		_, err := invoke(writeScript(t, `head -c 100000 /dev/zero`), "in.zip")
+		assert.ErrorContains(t, err, "output exceeds 64 bytes")
+	})
+}
+
+func TestRunProcessorWasm(t *testing.T) {
+	if testing.Short() {
+		t.Skip("building the wasm test processor is slow")
+	}
+	module := filepath.Join(t.TempDir(), "processor.wasm")
+	build := exec.Command("go", "build", "-o", module, "./testdata/wasm-processor")
+	build.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Skipf("cannot build wasm processor: %v\n%s", err, out)
+	}
+
+	uc, _, _ := setupDBUseCase(t)
+	uc.handlerOptions = map[string]conf.HandlerOption{"scenario": {Protocol: ProcessorProtocolV2}}
+	input := filepath.Join(t.TempDir(), "demo.bin")
+	assert.NoError(t, os.WriteFile(input, []byte("hello"), 0o644))
+	outputDir := t.TempDir()
+
+	out, err := uc.runProcessor(context.Background(), processorInvocation{
+		Job:       processJob{TypeKey: "scenario"},
+		Handler:   "scenario",
+		CmdLine:   module,
+		FilePath:  input,
+		OutputDir: outputDir,
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 5, out.Metadata["size"])
+	assert.Equal(t, false, out.Metadata["input_writable"])
+	assert.Equal(t, false, out.Metadata["host_visible"])
+	assert.FileExists(t, filepath.Join(outputDir, "summary.txt"))
+
+	versions := detectProcessorVersions(map[string]string{"scenario": module}, nil, nil)
+	assert.Equal(t, "wasm-0.1.0", versions["scenario"])
+}
+
+func TestRunPipeline(t *testing.T) {
+	uc, _, db := setupDBUseCase(t)
+	v2 := conf.HandlerOption{Protocol: ProcessorProtocolV2}
+	uc.handlerOptions = map[string]conf.HandlerOption{"hash": v2, "extract": v2, "archive": v2}
+	uc.handlers = map[string]string{
+		"hash":    writeScript(t, `echo '{"status":"success","metadata":{"sha":"abc"}}'`),
+		"extract": writeScript(t, `read -r req; case "$req" in *'"sha":"abc"'*) echo '{"status":"success","metadata":{"chained":true}}';; *) echo '{"status":"failed","error":"missing hash"}';; esac`),
+		"archive": writeScript(t, `echo '{"status":"failed","error":"disk full"}'`),
+	}
+
+	uc.processorVersions = map[string]string{"hash": "1.0", "extract": "2.1", "archive": "3.0"}
+
+	record := model.Job{TypeKey: "scenario", State: model.JobStateQueued}
+	assert.NoError(t, db.Create(&record).Error)
+	job := processJob{TypeKey: "scenario", JobID: record.ID}
+
+	t.Run("Optional Stage Failure", func(t *testing.T) {
+		stages := parsePipeline(map[string]any{"pipeline": []any{"hash", "extract", map[string]any{"name": "archive", "optional": true}, map[string]any{"name": "thumbnail", "optional": true}}})
+		result := uc.runPipeline(context.Background(), job, stages, "/tmp/in.zip")
+
+		assert.Empty(t, result.Failure)
+		assert.Equal(t, "abc", result.MetaData["sha"])
+		assert.Equal(t, true, result.MetaData["chained"])
+		assert.Len(t, result.MetaData["processor_warnings"], 1)
+		assert.Equal(t, []string{model.JobStateSucceeded, model.JobStateSucceeded, model.JobStateFailed, model.StageStateSkipped}, stageStates(result.Stages))
+		// 可选阶段失败或跳过不影响组合版本号
+		assert.Equal(t, "hash@1.0,extract@2.1", result.ProcessorVersion)
+
+		assert.NoError(t, db.First(&record, "id = ?", record.ID).Error)
+		assert.Equal(t, model.JobStateRunning, record.State)
+		assert.Len(t, record.Stages, 4)
+	})
+
+	t.Run("Required Stage Failure", func(t *testing.T) {
+		stages := parsePipeline(map[string]any{"pipeline": []any{"archive", "hash"}})
+		result := uc.runPipeline(context.Background(), job, stages, "/tmp/in.zip")
+
+		assert.Equal(t, "stage archive: disk full", result.Failure)
+		assert.Equal(t, []string{model.JobStateFailed, model.StageStateSkipped}, stageStates(result.Stages))
+	})
+}
+
+// stubProcessor 测试用进程内处理器
+type stubProcessor struct {
+	process func(req ProcessorRequest) (*ProcessorOutput, error)
+}
+
+func (stubProcessor) Version() string { return "stub-1" }
+
+func (p stubProcessor) Process(ctx context.Context, req ProcessorRequest, progress func(ProgressEvent)) (*ProcessorOutput, error) {
+	progress(ProgressEvent{Percent: 50})
+	return p.process(req)
+}
+
+func TestInProcessProcessor(t *testing.T) {
+	uc, _, _ := setupDBUseCase(t)
+	uc.processorVersions = map[string]string{"hash": "stub-1"}
+	uc.handlers = map[string]string{"hash": writeScript(t, `echo '{"status":"failed","error":"external called"}'`)}
+	uc.processors = map[string]Processor{
+		"hash": stubProcessor{process: func(req ProcessorRequest) (*ProcessorOutput, error) {
+			return &ProcessorOutput{Status: ProcessorStatusSuccess, Metadata: map[string]any{"stage": req.Stage, "file": req.FilePath}}, nil
+		}},
+		"extract": stubProcessor{process: func(req ProcessorRequest) (*ProcessorOutput, error) {
+			panic("boom")
+		}},
+	}
+	job := processJob{TypeKey: "scenario"}
+
+	result := uc.runPipeline(context.Background(), job, []PipelineStage{{Name: "hash"}}, "/tmp/in.zip")
+	assert.Empty(t, result.Failure)
+	assert.Equal(t, "hash", result.MetaData["stage"])
+	assert.Equal(t, "/tmp/in.zip", result.MetaData["file"])
+	assert.Equal(t, "stub-1", result.ProcessorVersion)
+
+	result = uc.runPipeline(context.Background(), job, []PipelineStage{{Name: "extract"}}, "/tmp/in.zip")
+	assert.Contains(t, result.Failure, "panic: boom")
+}
+
+func stageStates(stages []model.JobStage) []string {
+	states := make([]string, 0, len(stages))
+	for _, st := range stages {
+		states = append(states, st.State)
+	}
+	return states
+}
+
+func TestRenditionsRoundTrip(t *testing.T) {
+	uc, mockStore, db := setupDBUseCase(t)
+	ctx := context.Background()
+	objectKey := "resources/map_terrain/abc/dem.tif"
+
+	outputDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(outputDir, "thumb.png"), []byte("png"), 0o644))
+	assert.NoError(t, os.MkdirAll(filepath.Join(outputDir, "tiles"), 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(outputDir, "tiles", "0.bin"), []byte("tile"), 0o644))
+
+	job := processJob{JobID: "job-1", ObjectKey: objectKey}
+	renditions, err := uc.uploadRenditions(ctx, job, "render", outputDir, []RenditionSpec{{Path: "thumb.png", Role: "thumbnail"}})
+	assert.NoError(t, err)
+	assert.Len(t, renditions, 2)
+	mockStore.AssertCalled(t, "Put", mock.Anything, "test-bucket", "resources/map_terrain/abc/renditions/job-1/render/thumb.png", mock.Anything, int64(3), "image/png")
+	mockStore.AssertCalled(t, "Put", mock.Anything, "test-bucket", "resources/map_terrain/abc/renditions/job-1/render/tiles/0.bin", mock.Anything, int64(4), "application/octet-stream")
+
+	_, err = uc.uploadRenditions(ctx, job, "render", outputDir, []RenditionSpec{{Path: "../escape.png", Role: "thumbnail"}})
+	assert.Error(t, err)
+
+	res := model.Resource{TypeKey: "map_terrain", Name: "dem"}
+	assert.NoError(t, db.Create(&res).Error)
+	ver := model.ResourceVersion{ResourceID: res.ID, VersionNum: 1, FilePath: objectKey}
+	assert.NoError(t, db.Create(&ver).Error)
+	assert.NoError(t, uc.ReportProcessResult(ctx, ver.ID, ProcessResultRequest{State: "ACTIVE", Renditions: renditions}))
+
+	mockStore.On("PresignGet", mock.Anything, "test-bucket", mock.Anything, time.Hour).Return("http://signed", nil)
+	list, err := uc.ListRenditions(ctx, res.ID, 1)
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+	assert.Equal(t, "artifact", list[0].Role)
+	assert.Equal(t, "thumbnail", list[1].Role)
+	assert.Equal(t, "http://signed", list[1].DownloadURL)
+
+	// 缩略图取自最新的 ACTIVE 版本，处理中的新版本不影响
+	thumb, err := uc.Thumbnail(ctx, res.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "resources/map_terrain/abc/renditions/job-1/render/thumb.png", thumb.ObjectKey)
+	v2 := model.ResourceVersion{ResourceID: res.ID, VersionNum: 2, FilePath: "resources/map_terrain/def/dem.tif", State: "PROCESSING"}
+	assert.NoError(t, db.Create(&v2).Error)
+	thumb2, err := uc.Thumbnail(ctx, res.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, thumb.ID, thumb2.ID)
+
+	mockStore.On("Get", mock.Anything, "test-bucket", thumb.ObjectKey).Return(io.NopCloser(strings.NewReader("png")), nil)
+	body, err := uc.OpenRendition(ctx, thumb)
+	assert.NoError(t, err)
+	data, _ := io.ReadAll(body)
+	assert.Equal(t, "png", string(data))
+
+	assert.NoError(t, uc.ReportProcessResult(ctx, v2.ID, ProcessResultRequest{State: "ACTIVE"}))
+	_, err = uc.Thumbnail(ctx, res.ID)
+	assert.ErrorIs(t, err, ErrThumbnailNotFound)
+	_, err = uc.Thumbnail(ctx, "missing")
+	assert.ErrorIs(t, err, ErrThumbnailNotFound)
+}
+
+func TestRenditionsReplacedOnlyWhenAccepted(t *testing.T) {
+	uc, mockStore, db := setupDBUseCase(t)
+	ctx := context.Background()
+	mockStore.On("Delete", mock.Anything, "test-bucket", mock.Anything).Return(nil)
+	objectKey := "resources/map_terrain/abc/dem.tif"
+
+	outputDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(outputDir, "thumb.png"), []byte("png"), 0o644))
+	upload := func(jobID, stage string) []RenditionDTO {
+		renditions, err := uc.uploadRenditions(ctx, processJob{JobID: jobID, ObjectKey: objectKey}, stage, outputDir, nil)
+		assert.NoError(t, err)
+		return renditions
+	}
+
+	// 同一任务中不同阶段产出的同名文件互不覆盖
+	first := upload("job-1", "render")
+	other := upload("job-1", "preview")
+	assert.NotEqual(t, first[0].ObjectKey, other[0].ObjectKey)
+
+	res := model.Resource{TypeKey: "map_terrain", Name: "dem"}
+	assert.NoError(t, db.Create(&res).Error)
+	ver := model.ResourceVersion{ResourceID: res.ID, VersionNum: 1, FilePath: objectKey}
+	assert.NoError(t, db.Create(&ver).Error)
+	assert.NoError(t, uc.ReportProcessResult(ctx, ver.ID, ProcessResultRequest{State: "ACTIVE", Renditions: first}))
+
+	keys := func() []string {
+		var keys []string
+		assert.NoError(t, db.Model(&model.Rendition{}).Where("version_id = ?", ver.ID).Pluck("object_key", &keys).Error)
+		return keys
+	}
+
+	// 失败的重处理写入独立的前缀：当前记录保持不变，未被接受的文件被删除
+	failed := upload("job-2", "render")
+	assert.NoError(t, uc.ReportProcessResult(ctx, ver.ID, ProcessResultRequest{State: "ERROR", Message: "boom", Renditions: failed}))
+	assert.Equal(t, []string{first[0].ObjectKey}, keys())
+	mockStore.AssertCalled(t, "Delete", mock.Anything, "test-bucket", failed[0].ObjectKey)
+	mockStore.AssertNotCalled(t, "Delete", mock.Anything, "test-bucket", first[0].ObjectKey)
+
+	// 被接受的结果切换记录后才删除被取代的文件
+	next := upload("job-3", "render")
+	assert.NoError(t, uc.ReportProcessResult(ctx, ver.ID, ProcessResultRequest{State: "ACTIVE", Renditions: next}))
+	assert.Equal(t, []string{next[0].ObjectKey}, keys())
+	mockStore.AssertCalled(t, "Delete", mock.Anything, "test-bucket", first[0].ObjectKey)
+
+	// 重复投递已被接受的结果不会删除仍被引用的文件
+	assert.NoError(t, uc.ReportProcessResult(ctx, ver.ID, ProcessResultRequest{State: "ACTIVE", Renditions: next}))
+	mockStore.AssertNotCalled(t, "Delete", mock.Anything, "test-bucket", next[0].ObjectKey)
+}
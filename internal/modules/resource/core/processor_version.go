@@ -0,0 +1,257 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/liny/sim-hub/internal/conf"
+	"github.com/liny/sim-hub/internal/model"
+	"gorm.io/gorm"
+)
+
+// processorVersionTimeout --version 握手的超时时间
+const processorVersionTimeout = 5 * time.Second
+
+// staleReportLimit 过期报告中列出的版本明细上限
+const staleReportLimit = 200
+
+// staleVersionCondition 版本元数据不是由类型当前处理器版本产出的条件；
+// 没有记录处理器版本 (NULL 或空，如引入版本跟踪之前处理的版本) 的同样视为过期
+const staleVersionCondition = "(resource_versions.processor_version IS NULL OR resource_versions.processor_version = '' OR resource_versions.processor_version <> ?)"
+
+// ErrNoProcessorVersion 资源类型尚未检测到处理器版本，无法判断哪些版本过期
+var ErrNoProcessorVersion = errors.New("no processor version has been detected for this resource type")
+
+type StaleVersionDTO struct {
+	ResourceID       string `json:"resource_id"`
+	VersionNum       int    `json:"version_num"`
+	ProcessorVersion string `json:"processor_version"`
+}
+
+// ProcessorReport 某资源类型的处理器版本分布与过期统计
+type ProcessorReport struct {
+	TypeKey        string            `json:"type_key"`
+	CurrentVersion string            `json:"current_version"`
+	VersionCounts  map[string]int64  `json:"version_counts"` // 处理器版本 -> 版本数量，空串表示未知
+	StaleTotal     int64             `json:"stale_total"`    // 仅统计 ACTIVE 版本，与自动重处理的范围一致
+	Stale          []StaleVersionDTO `json:"stale"`
+}
+
+// detectProcessorVersions 确定各处理器版本：优先使用配置声明，否则执行 `<cmd> --version` 握手
+func detectProcessorVersions(handlers, declared map[string]string, options map[string]conf.HandlerOption) map[string]string {
+	versions := make(map[string]string)
+	for typeKey, cmdLine := range handlers {
+		if cmdLine == "" {
+			continue
+		}
+		if v := declared[typeKey]; v != "" {
+			versions[typeKey] = v
+			continue
+		}
+
+		argv, err := splitCommand(cmdLine)
+		if err != nil {
+			slog.Warn("处理器命令无法解析", "type", typeKey, "error", err)
+			continue
+		}
+		limits := limitsFor(options[typeKey])
+		limits.Timeout = processorVersionTimeout
+		out := &limitedBuffer{limit: limits.OutputBytes}
+		run := sandboxedRun{
+			Argv:   append(argv, "--version"),
+			Stdout: out,
+			Limits: limits,
+		}
+		if isWasmModule(argv[0]) {
+			err = runWasm(context.Background(), run, nil)
+		} else {
+			err = runSandboxed(context.Background(), run)
+		}
+		if err != nil {
+			slog.Warn("处理器版本握手失败，产出的元数据将不带版本", "type", typeKey, "error", err)
+			continue
+		}
+		line, _, _ := strings.Cut(strings.TrimSpace(string(out.Bytes())), "\n")
+		versions[typeKey] = strings.TrimSpace(line)
+		slog.Info("已识别处理器版本", "type", typeKey, "version", versions[typeKey])
+	}
+	return versions
+}
+
+// compareVersions 比较两个版本号，支持 "v1.2.3" 形式的点分数字，无法按数字比较的段按字符串比较
+func compareVersions(a, b string) int {
+	as := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bs := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y string
+		if i < len(as) {
+			x = as[i]
+		}
+		if i < len(bs) {
+			y = bs[i]
+		}
+		xn, errX := strconv.Atoi(x)
+		yn, errY := strconv.Atoi(y)
+		if errX == nil && errY == nil {
+			if xn != yn {
+				if xn < yn {
+					return -1
+				}
+				return 1
+			}
+			continue
+		}
+		if c := strings.Compare(x, y); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// splitStageVersions 按流水线的必需阶段拆分 "阶段@版本" 组合版本 (见 pipelineVersion)，
+// 返回各阶段的版本号；阶段列表与配置不符时返回 nil
+func splitStageVersions(version string, stages []PipelineStage) []string {
+	if version == "" {
+		return nil
+	}
+	parts := strings.Split(version, ",")
+	var versions []string
+	for _, st := range stages {
+		if st.Optional {
+			continue
+		}
+		if len(versions) >= len(parts) {
+			return nil
+		}
+		name, v, ok := strings.Cut(parts[len(versions)], "@")
+		if !ok || name != st.Name {
+			return nil
+		}
+		versions = append(versions, v)
+	}
+	if len(versions) != len(parts) {
+		return nil
+	}
+	return versions
+}
+
+// compareStageVersions 逐阶段比较版本号：各阶段都不旧于对方且至少一个更新时返回 1，反之 -1；
+// 相同或各有新旧时返回 0
+func compareStageVersions(a, b []string) int {
+	result := 0
+	for i := range a {
+		c := compareVersions(a[i], b[i])
+		if c == 0 {
+			continue
+		}
+		if result != 0 && c != result {
+			return 0
+		}
+		result = c
+	}
+	return result
+}
+
+// observeProcessorVersion 记录某类型处理器最近上报的版本，版本升高且开启 auto_reprocess 时重处理过期版本。
+// 类型版本跟随 Worker 实际运行的处理器：回滚后以回滚到的版本为准，回滚后产出的结果不计为过期，
+// 回滚本身不触发重处理；新旧 Worker 混跑期间类型版本会随上报结果来回变化
+func (uc *UseCase) observeProcessorVersion(ctx context.Context, typeKey, version string) {
+	var rt model.ResourceType
+	if err := uc.data.DB.First(&rt, "type_key = ?", typeKey).Error; err != nil {
+		return
+	}
+	if version == rt.ProcessorVersion {
+		return
+	}
+	upgraded := rt.ProcessorVersion != ""
+	if stages := parsePipeline(rt.ProcessConf); len(stages) > 1 {
+		// 多阶段流水线逐阶段比较；阶段列表与当前配置不符的结果 (配置变更前排队的任务) 不改变类型版本，
+		// 类型现有版本与配置不符时直接采用新版本
+		current := splitStageVersions(version, stages)
+		if current == nil {
+			return
+		}
+		if prev := splitStageVersions(rt.ProcessorVersion, stages); prev != nil {
+			upgraded = compareStageVersions(current, prev) > 0
+		}
+	} else if upgraded {
+		upgraded = compareVersions(version, rt.ProcessorVersion) > 0
+	}
+
+	// 条件更新，多个结果并发上报同一新版本时只有一个会触发后续动作
+	result := uc.data.DB.Model(&model.ResourceType{}).
+		Where("type_key = ? AND COALESCE(processor_version, '') = ?", typeKey, rt.ProcessorVersion).
+		Update("processor_version", version)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return
+	}
+	slog.Info("处理器版本已变化", "type", typeKey, "old", rt.ProcessorVersion, "new", version, "upgraded", upgraded)
+
+	// 首次观测到版本时没有可比较的旧数据，回滚或各阶段有新有旧时也不触发重处理
+	if auto, _ := rt.ProcessConf["auto_reprocess"].(bool); auto && upgraded {
+		if _, err := uc.ReprocessResourceType(ctx, typeKey, ReprocessFilter{State: "ACTIVE", StaleOnly: true, AllVersions: true, Priority: PriorityMaintenance}); err != nil {
+			slog.Error("自动重处理过期版本失败", "type", typeKey, "error", err)
+		}
+	}
+}
+
+// GetProcessorReport 统计某资源类型各版本元数据的处理器版本分布及过期版本
+func (uc *UseCase) GetProcessorReport(ctx context.Context, typeKey string) (*ProcessorReport, error) {
+	var rt model.ResourceType
+	if err := uc.data.DB.First(&rt, "type_key = ?", typeKey).Error; err != nil {
+		return nil, err
+	}
+
+	report := &ProcessorReport{
+		TypeKey:        typeKey,
+		CurrentVersion: rt.ProcessorVersion,
+		VersionCounts:  make(map[string]int64),
+		Stale:          make([]StaleVersionDTO, 0),
+	}
+
+	var counts []struct {
+		ProcessorVersion string
+		Count            int64
+	}
+	if err := uc.typeVersionsQuery(typeKey).
+		Select("resource_versions.processor_version AS processor_version, COUNT(*) AS count").
+		Group("resource_versions.processor_version").
+		Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	for _, c := range counts {
+		report.VersionCounts[c.ProcessorVersion] = c.Count
+	}
+
+	// 尚未检测到处理器版本：current_version 为空，不统计过期版本
+	if rt.ProcessorVersion == "" {
+		return report, nil
+	}
+
+	// 处理中或失败的版本没有可用的元数据，不计为过期
+	staleQuery := func() *gorm.DB {
+		return uc.typeVersionsQuery(typeKey).
+			Where("resource_versions.state = ?", "ACTIVE").
+			Where(staleVersionCondition, rt.ProcessorVersion)
+	}
+	if err := staleQuery().Count(&report.StaleTotal).Error; err != nil {
+		return nil, err
+	}
+	var stale []model.ResourceVersion
+	if err := staleQuery().Select("resource_versions.resource_id", "resource_versions.version_num", "resource_versions.processor_version").
+		Order("resource_versions.created_at").Limit(staleReportLimit).Find(&stale).Error; err != nil {
+		return nil, err
+	}
+	for _, v := range stale {
+		report.Stale = append(report.Stale, StaleVersionDTO{
+			ResourceID:       v.ResourceID,
+			VersionNum:       v.VersionNum,
+			ProcessorVersion: v.ProcessorVersion,
+		})
+	}
+	return report, nil
+}
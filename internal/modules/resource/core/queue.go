@@ -0,0 +1,194 @@
+package core
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// 任务优先级，由高到低：交互式操作 (上传、单个版本重处理) > 批量操作 (存储同步、按类型重处理) > 维护任务 (处理器升级后的自动重处理)
+const (
+	PriorityInteractive = "interactive"
+	PriorityBulk        = "bulk"
+	PriorityMaintenance = "maintenance"
+)
+
+// jobPriorities 按出队顺序排列的优先级
+var jobPriorities = []string{PriorityInteractive, PriorityBulk, PriorityMaintenance}
+
+// validPriority 判断优先级是否合法
+func validPriority(p string) bool {
+	for _, v := range jobPriorities {
+		if v == p {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizePriority 未知或未设置的优先级按交互式处理 (兼容旧消息)
+func normalizePriority(p string) string {
+	if validPriority(p) {
+		return p
+	}
+	return PriorityInteractive
+}
+
+// jobQueue Worker 本地任务队列：按优先级出队，同一优先级先进先出
+type jobQueue struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	items map[string][]processJob
+}
+
+func newJobQueue() *jobQueue {
+	q := &jobQueue{items: make(map[string][]processJob)}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *jobQueue) Push(job processJob) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	p := normalizePriority(job.Priority)
+	q.items[p] = append(q.items[p], job)
+	q.cond.Broadcast()
+}
+
+// TryPop 取出优先级最高且 acquire 成功 (有执行槽位) 的任务，没有可执行的任务时返回 false
+func (q *jobQueue) TryPop(acquire func(typeKey string) bool) (processJob, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.popLocked(acquire)
+}
+
+// Pop 阻塞直到有可执行的任务；槽位释放后需调用 Notify 唤醒等待者
+func (q *jobQueue) Pop(acquire func(typeKey string) bool) processJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		if job, ok := q.popLocked(acquire); ok {
+			return job
+		}
+		q.cond.Wait()
+	}
+}
+
+func (q *jobQueue) popLocked(acquire func(typeKey string) bool) (processJob, bool) {
+	for _, p := range jobPriorities {
+		for i, job := range q.items[p] {
+			// 槽位已满的类型跳过，不阻塞其后其他类型的任务
+			if acquire(job.TypeKey) {
+				q.items[p] = append(q.items[p][:i:i], q.items[p][i+1:]...)
+				return job, true
+			}
+		}
+	}
+	return processJob{}, false
+}
+
+// Notify 唤醒等待出队的 Worker (执行槽位释放后调用)
+func (q *jobQueue) Notify() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.cond.Broadcast()
+}
+
+// Remove 移除尚未开始执行的任务
+func (q *jobQueue) Remove(jobID string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, p := range jobPriorities {
+		for i, job := range q.items[p] {
+			if job.JobID == jobID {
+				q.items[p] = append(q.items[p][:i:i], q.items[p][i+1:]...)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// JobIDs 排队中的处理任务 ID
+func (q *jobQueue) JobIDs() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var ids []string
+	for _, p := range jobPriorities {
+		for _, job := range q.items[p] {
+			if job.JobID != "" {
+				ids = append(ids, job.JobID)
+			}
+		}
+	}
+	return ids
+}
+
+// Pending 某资源类型排队中的任务数
+func (q *jobQueue) Pending(typeKey string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := 0
+	for _, p := range jobPriorities {
+		for _, job := range q.items[p] {
+			if job.TypeKey == typeKey {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// canceledJobTTL 记录尚未到达的已取消任务的时间，应对取消通知先于任务消息到达的情况
+const canceledJobTTL = 10 * time.Minute
+
+// jobControl 跟踪 Worker 上正在执行的任务，用于取消
+type jobControl struct {
+	mu       sync.Mutex
+	running  map[string]context.CancelFunc
+	canceled map[string]time.Time
+}
+
+func newJobControl() *jobControl {
+	return &jobControl{
+		running:  make(map[string]context.CancelFunc),
+		canceled: make(map[string]time.Time),
+	}
+}
+
+// start 登记任务并返回可取消的上下文；任务已被取消时返回 false
+func (c *jobControl) start(ctx context.Context, jobID string) (context.Context, context.CancelFunc, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.canceled[jobID]; ok {
+		delete(c.canceled, jobID)
+		return ctx, func() {}, false
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	c.running[jobID] = cancel
+	return ctx, cancel, true
+}
+
+func (c *jobControl) finish(jobID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.running, jobID)
+}
+
+// cancel 取消正在执行的任务，未在执行的任务记录下来以便到达时丢弃，返回任务是否正在执行
+func (c *jobControl) cancel(jobID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cancel, ok := c.running[jobID]; ok {
+		cancel()
+		return true
+	}
+	now := time.Now()
+	for id, at := range c.canceled {
+		if now.Sub(at) > canceledJobTTL {
+			delete(c.canceled, id)
+		}
+	}
+	c.canceled[jobID] = now
+	return false
+}
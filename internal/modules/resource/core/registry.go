@@ -0,0 +1,107 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+)
+
+// Processor 进程内处理器，与外部处理器遵循相同的请求与输出约定
+//
+// 内置处理器在 init 中通过 RegisterProcessor 按资源类型或流水线阶段名注册，
+// Worker 优先使用已注册的处理器，未注册时才回退到 handlers 配置的外部命令。
+type Processor interface {
+	// Version 处理器版本，记录到产出的元数据上用于过期检测
+	Version() string
+	// Process 处理 req.FilePath 指向的文件，派生文件写入 req.OutputDir；
+	// 返回的 error 表示执行失败，业务失败应以 status 为 failed 的输出报告
+	Process(ctx context.Context, req ProcessorRequest, progress func(ProgressEvent)) (*ProcessorOutput, error)
+}
+
+var (
+	processorsMu      sync.RWMutex
+	processorRegistry = make(map[string]Processor)
+)
+
+// RegisterProcessor 注册进程内处理器，同一键重复注册会 panic
+func RegisterProcessor(key string, p Processor) {
+	processorsMu.Lock()
+	defer processorsMu.Unlock()
+	if p == nil {
+		panic("core: RegisterProcessor processor is nil")
+	}
+	if _, dup := processorRegistry[key]; dup {
+		panic("core: RegisterProcessor called twice for " + key)
+	}
+	processorRegistry[key] = p
+}
+
+// registeredProcessors 返回当前已注册处理器的快照
+func registeredProcessors() map[string]Processor {
+	processorsMu.RLock()
+	defer processorsMu.RUnlock()
+	snapshot := make(map[string]Processor, len(processorRegistry))
+	for k, p := range processorRegistry {
+		snapshot[k] = p
+	}
+	return snapshot
+}
+
+// hasProcessor 判断 Worker 是否能处理该键 (进程内处理器或外部命令)
+func (uc *UseCase) hasProcessor(key string) bool {
+	return uc.processors[key] != nil || uc.handlers[key] != ""
+}
+
+// invokeProcessor 执行处理器：优先进程内处理器，否则执行外部命令
+func (uc *UseCase) invokeProcessor(ctx context.Context, inv processorInvocation) (*ProcessorOutput, error) {
+	p := uc.processors[inv.Handler]
+	if p == nil {
+		return uc.runProcessor(ctx, inv)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, limitsFor(uc.handlerOptions[inv.Handler]).Timeout)
+	defer cancel()
+	return runInProcess(ctx, p, ProcessorRequest{
+		Protocol:      ProcessorProtocolV2,
+		FilePath:      inv.FilePath,
+		TypeKey:       inv.Job.TypeKey,
+		Stage:         inv.Handler,
+		ResourceID:    inv.Job.ResourceID,
+		VersionID:     inv.Job.VersionID,
+		JobID:         inv.Job.JobID,
+		OutputDir:     inv.OutputDir,
+		PrevOutputDir: inv.PrevOutputDir,
+		ProcessConf:   inv.Job.ProcessConf,
+		MetaData:      inv.MetaData,
+	}, inv.OnProgress)
+}
+
+// runInProcess 调用进程内处理器，panic 与非法输出均按执行失败处理
+func runInProcess(ctx context.Context, p Processor, req ProcessorRequest, onProgress func(ProgressEvent)) (out *ProcessorOutput, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("进程内处理器 panic", "stage", req.Stage, "panic", r, "stack", string(debug.Stack()))
+			out, err = nil, fmt.Errorf("Processor failed: panic: %v", r)
+		}
+	}()
+
+	progress := func(ev ProgressEvent) {
+		if onProgress != nil {
+			ev.Event = "progress"
+			onProgress(ev)
+		}
+	}
+	out, err = p.Process(ctx, req, progress)
+	if err != nil {
+		return nil, fmt.Errorf("Processor failed: %w", err)
+	}
+	if out == nil {
+		return nil, fmt.Errorf("Invalid processor output: processor returned no result")
+	}
+	if err := validateProcessorOutput(out); err != nil {
+		return nil, fmt.Errorf("Invalid processor output: %w", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,261 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/liny/sim-hub/internal/model"
+	"gorm.io/gorm"
+)
+
+// renditionsDir 派生文件在存储中的目录名，位于版本主文件同级
+const renditionsDir = "renditions"
+
+// defaultRenditionRole 处理器未声明角色的产出文件使用的角色
+const defaultRenditionRole = "artifact"
+
+// thumbnailRole 列表页展示的缩略图角色
+const thumbnailRole = "thumbnail"
+
+// ErrThumbnailNotFound 资源没有可用版本，或最新可用版本没有缩略图
+var ErrThumbnailNotFound = errors.New("thumbnail not found")
+
+// RenditionSpec 处理器在输出中声明的派生文件
+type RenditionSpec struct {
+	Path        string `json:"path"` // 相对输出目录的路径
+	Role        string `json:"role"`
+	ContentType string `json:"content_type,omitempty"`
+}
+
+type RenditionDTO struct {
+	Role        string `json:"role"`
+	ObjectKey   string `json:"object_key"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type"`
+	DownloadURL string `json:"download_url,omitempty"`
+}
+
+// renditionKey 派生文件的存储路径: resources/{type}/{uuid}/renditions/{job_id}/{stage}/{rel}；
+// 每个任务写入独立的前缀，未被接受的结果 (失败、取消) 不会覆盖当前版本记录引用的文件，
+// 同一流水线中不同阶段产出的同名文件也互不覆盖
+func renditionKey(objectKey, jobID, stage, rel string) string {
+	return path.Join(path.Dir(objectKey), renditionsDir, jobID, stage, filepath.ToSlash(rel))
+}
+
+// uploadRenditions 将处理阶段输出目录中的文件上传到存储，角色按处理器声明确定
+func (uc *UseCase) uploadRenditions(ctx context.Context, job processJob, stage, outputDir string, specs []RenditionSpec) ([]RenditionDTO, error) {
+	jobID := job.JobID
+	if jobID == "" {
+		jobID = uuid.NewString()
+	}
+	declared := make(map[string]RenditionSpec, len(specs))
+	for _, spec := range specs {
+		if !filepath.IsLocal(spec.Path) {
+			return nil, fmt.Errorf("invalid rendition path %q", spec.Path)
+		}
+		declared[filepath.Clean(spec.Path)] = spec
+	}
+
+	var renditions []RenditionDTO
+	err := filepath.WalkDir(outputDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(outputDir, p)
+		if err != nil {
+			return err
+		}
+
+		spec, ok := declared[rel]
+		if !ok {
+			spec = RenditionSpec{Role: defaultRenditionRole}
+		}
+		if spec.Role == "" {
+			spec.Role = defaultRenditionRole
+		}
+		contentType := spec.ContentType
+		if contentType == "" {
+			contentType = mime.TypeByExtension(filepath.Ext(p))
+		}
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+
+		key := renditionKey(job.ObjectKey, jobID, stage, rel)
+		if err := uc.store.Put(ctx, uc.minioConfig, key, f, info.Size(), contentType); err != nil {
+			return fmt.Errorf("upload rendition %s: %w", rel, err)
+		}
+		renditions = append(renditions, RenditionDTO{
+			Role:        spec.Role,
+			ObjectKey:   key,
+			Size:        info.Size(),
+			ContentType: contentType,
+		})
+		return nil
+	})
+	if err != nil {
+		uc.discardRenditions(renditions)
+		return nil, err
+	}
+
+	for rel := range declared {
+		if _, err := os.Stat(filepath.Join(outputDir, rel)); err != nil {
+			uc.discardRenditions(renditions)
+			return nil, fmt.Errorf("declared rendition %q not found in output directory", rel)
+		}
+	}
+	if len(renditions) > 0 {
+		slog.Info("派生文件已上传", "key", job.ObjectKey, "stage", stage, "count", len(renditions))
+	}
+	return renditions, nil
+}
+
+// deleteRenditionObjects 删除不再被引用的派生文件，失败仅记录日志
+func (uc *UseCase) deleteRenditionObjects(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := uc.store.Delete(ctx, uc.minioConfig, key); err != nil {
+			slog.Warn("无法删除过期派生文件", "path", key, "error", err)
+		}
+	}
+}
+
+// discardRenditions Worker 丢弃未被接受的结果 (失败或取消) 已上传的派生文件
+func (uc *UseCase) discardRenditions(renditions []RenditionDTO) {
+	keys := make([]string, 0, len(renditions))
+	for _, r := range renditions {
+		keys = append(keys, r.ObjectKey)
+	}
+	uc.deleteRenditionObjects(context.Background(), keys)
+}
+
+// unreferencedRenditions 返回未被任何版本记录引用的派生文件路径：
+// 未被应用的结果 (失败、取消或重复投递) 携带的文件中，只有重复投递的文件已被记录，其余可以删除
+func unreferencedRenditions(db *gorm.DB, renditions []RenditionDTO) ([]string, error) {
+	if len(renditions) == 0 {
+		return nil, nil
+	}
+	keys := make([]string, 0, len(renditions))
+	for _, r := range renditions {
+		keys = append(keys, r.ObjectKey)
+	}
+	var referenced []string
+	if err := db.Model(&model.Rendition{}).Where("object_key IN ?", keys).Pluck("object_key", &referenced).Error; err != nil {
+		return nil, err
+	}
+	used := make(map[string]bool, len(referenced))
+	for _, k := range referenced {
+		used[k] = true
+	}
+	var stale []string
+	for _, k := range keys {
+		if !used[k] {
+			stale = append(stale, k)
+		}
+	}
+	return stale, nil
+}
+
+// replaceRenditions 用被接受的处理结果替换版本的派生文件记录，返回不再使用的存储路径，由调用方在提交后删除
+func replaceRenditions(tx *gorm.DB, versionID string, renditions []RenditionDTO) ([]string, error) {
+	var old []model.Rendition
+	if err := tx.Find(&old, "version_id = ?", versionID).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Delete(&model.Rendition{}, "version_id = ?", versionID).Error; err != nil {
+		return nil, err
+	}
+
+	current := make(map[string]bool, len(renditions))
+	for _, r := range renditions {
+		current[r.ObjectKey] = true
+		if err := tx.Create(&model.Rendition{
+			VersionID:   versionID,
+			Role:        r.Role,
+			ObjectKey:   r.ObjectKey,
+			Size:        r.Size,
+			ContentType: r.ContentType,
+		}).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	var orphaned []string
+	for _, r := range old {
+		if !current[r.ObjectKey] {
+			orphaned = append(orphaned, r.ObjectKey)
+		}
+	}
+	return orphaned, nil
+}
+
+// ListRenditions 列出指定版本的派生文件及下载地址
+func (uc *UseCase) ListRenditions(ctx context.Context, resourceID string, versionNum int) ([]RenditionDTO, error) {
+	var ver model.ResourceVersion
+	if err := uc.data.DB.First(&ver, "resource_id = ? AND version_num = ?", resourceID, versionNum).Error; err != nil {
+		return nil, err
+	}
+
+	var rows []model.Rendition
+	if err := uc.data.DB.Order("role").Find(&rows, "version_id = ?", ver.ID).Error; err != nil {
+		return nil, err
+	}
+
+	list := make([]RenditionDTO, 0, len(rows))
+	for _, r := range rows {
+		url, err := uc.store.PresignGet(ctx, uc.minioConfig, r.ObjectKey, time.Hour)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, RenditionDTO{
+			Role:        r.Role,
+			ObjectKey:   r.ObjectKey,
+			Size:        r.Size,
+			ContentType: r.ContentType,
+			DownloadURL: url,
+		})
+	}
+	return list, nil
+}
+
+// Thumbnail 返回资源最新 ACTIVE 版本的缩略图记录；重处理会重建记录，ID 可作为缓存校验标识
+func (uc *UseCase) Thumbnail(ctx context.Context, resourceID string) (*model.Rendition, error) {
+	var ver model.ResourceVersion
+	err := uc.data.DB.Where("resource_id = ? AND state = ?", resourceID, "ACTIVE").
+		Order("version_num desc").First(&ver).Error
+	if err == nil {
+		var r model.Rendition
+		err = uc.data.DB.Where("version_id = ? AND role = ?", ver.ID, thumbnailRole).Order("object_key").First(&r).Error
+		if err == nil {
+			return &r, nil
+		}
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrThumbnailNotFound
+	}
+	return nil, err
+}
+
+// OpenRendition 读取派生文件内容
+func (uc *UseCase) OpenRendition(ctx context.Context, r *model.Rendition) (io.ReadCloser, error) {
+	return uc.store.Get(ctx, uc.minioConfig, r.ObjectKey)
+}
@@ -0,0 +1,167 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/liny/sim-hub/internal/model"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultReprocessRate = 10   // 批量重处理默认的派发速率 (任务/秒)
+	maxReprocessRate     = 1000 // 派发速率上限
+)
+
+var (
+	// ErrInvalidRate 派发速率超出允许范围
+	ErrInvalidRate = errors.New("rate must be between 1 and 1000")
+	// ErrJobInProgress 版本已有排队或运行中的处理任务
+	ErrJobInProgress = errors.New("version already has an unfinished job")
+)
+
+// unfinishedJobExists 版本存在排队或运行中任务的子查询条件
+const unfinishedJobExists = "EXISTS (SELECT 1 FROM jobs WHERE jobs.version_id = resource_versions.id AND jobs.state IN ('QUEUED', 'RUNNING'))"
+
+// ReprocessFilter 批量重处理的筛选条件
+type ReprocessFilter struct {
+	CategoryID  string `json:"category_id"`
+	State       string `json:"state"`        // 仅重处理指定状态的版本，例如 ERROR
+	AllVersions bool   `json:"all_versions"` // 默认仅处理每个资源的最新版本
+	StaleOnly   bool   `json:"stale_only"`   // 仅处理由旧版本处理器产出元数据的版本
+	Rate        int    `json:"rate"`         // 每秒派发的任务数 (1~1000)，为 0 时使用默认值
+	Priority    string `json:"priority"`     // 任务优先级，默认 bulk
+}
+
+type ReprocessResponse struct {
+	Matched int `json:"matched"`
+}
+
+// ReprocessVersion 重新触发指定版本的处理流程
+func (uc *UseCase) ReprocessVersion(ctx context.Context, resourceID string, versionNum int) error {
+	var ver model.ResourceVersion
+	if err := uc.data.DB.Preload("Resource").First(&ver, "resource_id = ? AND version_num = ?", resourceID, versionNum).Error; err != nil {
+		return err
+	}
+
+	err := uc.data.DB.Transaction(func(tx *gorm.DB) error {
+		return uc.resetForReprocess(tx, ver, ver.Resource.TypeKey, PriorityInteractive)
+	})
+	if err != nil {
+		return err
+	}
+	uc.kickOutbox()
+	slog.Info("已触发版本重处理", "resource_id", resourceID, "version", versionNum)
+	return nil
+}
+
+// ReprocessResourceType 按资源类型与筛选条件批量重处理，任务按限定速率异步派发
+func (uc *UseCase) ReprocessResourceType(ctx context.Context, typeKey string, filter ReprocessFilter) (*ReprocessResponse, error) {
+	priority := filter.Priority
+	if priority == "" {
+		priority = PriorityBulk
+	}
+	if !validPriority(priority) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidPriority, priority)
+	}
+	rate := filter.Rate
+	if rate == 0 {
+		rate = defaultReprocessRate
+	}
+	if rate < 1 || rate > maxReprocessRate {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidRate, filter.Rate)
+	}
+
+	query := uc.typeVersionsQuery(typeKey)
+	if filter.CategoryID != "" {
+		query = query.Where("resources.category_id = ?", filter.CategoryID)
+	}
+	if filter.State != "" {
+		query = query.Where("resource_versions.state = ?", filter.State)
+	}
+	if filter.StaleOnly {
+		var rt model.ResourceType
+		if err := uc.data.DB.First(&rt, "type_key = ?", typeKey).Error; err != nil {
+			return nil, err
+		}
+		// 没有可比较的当前版本时，"过期" 无从判断，明确报错而不是匹配不到任何版本
+		if rt.ProcessorVersion == "" {
+			return nil, ErrNoProcessorVersion
+		}
+		query = query.Where(staleVersionCondition, rt.ProcessorVersion)
+	}
+	// 已有未结束任务的版本不重复创建任务
+	query = query.Where("NOT " + unfinishedJobExists)
+	if !filter.AllVersions {
+		query = query.Where("resource_versions.version_num = (SELECT MAX(v2.version_num) FROM resource_versions v2 WHERE v2.resource_id = resource_versions.resource_id)")
+	}
+
+	var versions []model.ResourceVersion
+	if err := query.Select("resource_versions.*").Find(&versions).Error; err != nil {
+		return nil, err
+	}
+
+	// 请求上下文会在响应后取消，派发在后台独立进行
+	go uc.dispatchThrottled(typeKey, versions, rate, priority)
+
+	slog.Info("已调度批量重处理", "type", typeKey, "matched", len(versions), "rate", rate, "priority", priority)
+	return &ReprocessResponse{Matched: len(versions)}, nil
+}
+
+// typeVersionsQuery 构造某资源类型下所有版本的查询
+func (uc *UseCase) typeVersionsQuery(typeKey string) *gorm.DB {
+	return uc.data.DB.Model(&model.ResourceVersion{}).
+		Joins("JOIN resources ON resources.id = resource_versions.resource_id").
+		Where("resources.type_key = ?", typeKey)
+}
+
+// dispatchThrottled 以固定速率派发任务，避免瞬间灌满队列
+func (uc *UseCase) dispatchThrottled(typeKey string, versions []model.ResourceVersion, rate int, priority string) {
+	ticker := time.NewTicker(time.Second / time.Duration(rate))
+	defer ticker.Stop()
+
+	for _, ver := range versions {
+		<-ticker.C
+		err := uc.data.DB.Transaction(func(tx *gorm.DB) error {
+			return uc.resetForReprocess(tx, ver, typeKey, priority)
+		})
+		if errors.Is(err, ErrJobInProgress) {
+			// 筛选之后由其他请求创建了任务
+			slog.Info("版本已有未结束的处理任务，跳过重处理", "version_id", ver.ID)
+			continue
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			slog.Info("版本已删除，跳过重处理", "version_id", ver.ID)
+			continue
+		}
+		if err != nil {
+			slog.Error("创建处理任务失败，跳过重处理", "version_id", ver.ID, "error", err)
+			continue
+		}
+		uc.kickOutbox()
+	}
+	slog.Info("批量重处理派发完成", "count", len(versions))
+}
+
+// resetForReprocess 把版本重置为 PENDING 并创建处理任务，二者在同一事务中，任务创建失败时版本保持原状态。
+// 版本已有排队或运行中的任务时返回 ErrJobInProgress：重复的任务会把 PENDING 记为原状态，取消时无法恢复。
+// 批量派发时 ver 可能是数分钟前的快照，任务记录的原状态与携带的元数据以事务内重新读取的记录为准
+func (uc *UseCase) resetForReprocess(tx *gorm.DB, ver model.ResourceVersion, typeKey, priority string) error {
+	if err := tx.First(&ver, "id = ?", ver.ID).Error; err != nil {
+		return err
+	}
+	// 读取之后状态被其他请求改变 (如创建了任务) 时不覆盖
+	result := tx.Model(&model.ResourceVersion{}).
+		Where("id = ? AND state = ? AND NOT "+unfinishedJobExists, ver.ID, ver.State).
+		Update("state", "PENDING")
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrJobInProgress
+	}
+	return uc.enqueueProcessJob(tx, ver, typeKey, priority)
+}
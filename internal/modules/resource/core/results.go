@@ -0,0 +1,160 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"gorm.io/gorm"
+)
+
+// result_mode 为 nats 时，Worker 把处理结果发布到 JetStream，API 节点以持久消费者应用结果，
+// Worker 与 API 之间只需要 NATS 连通；进度事件不要求可靠，走普通 NATS 主题
+const (
+	ResultModeHTTP = "http"
+	ResultModeNATS = "nats"
+
+	defaultResultSubject = "simhub.results"
+	defaultResultStream  = "SIMHUB_RESULTS"
+	resultConsumer       = "simhub-api-results" // API 节点共享的持久消费者 (同时作为队列组)
+	resultAckWait        = time.Minute
+	resultApplyTimeout   = 30 * time.Second
+	resultRetryDelay     = 5 * time.Second
+	resultDedupWindow    = 10 * time.Minute // 按幂等键去重的时间窗口
+)
+
+// resultMessage 经 NATS 上报的处理结果
+type resultMessage struct {
+	VersionID string          `json:"version_id"`
+	Result    json.RawMessage `json:"result"` // ProcessResultRequest
+}
+
+// progressMessage 经 NATS 上报的任务进度
+type progressMessage struct {
+	JobID    string             `json:"job_id"`
+	Progress JobProgressRequest `json:"progress"`
+}
+
+// resultsOverNATS 判断是否通过 NATS 上报处理结果与进度
+func (uc *UseCase) resultsOverNATS() bool {
+	return uc.nats != nil && uc.nats.Config.Enabled && uc.nats.Config.ResultMode == ResultModeNATS
+}
+
+func (uc *UseCase) resultSubject() string {
+	if uc.nats.Config.ResultSubject != "" {
+		return uc.nats.Config.ResultSubject
+	}
+	return defaultResultSubject
+}
+
+func (uc *UseCase) resultStream() string {
+	if uc.nats.Config.ResultStream != "" {
+		return uc.nats.Config.ResultStream
+	}
+	return defaultResultStream
+}
+
+// publishResult 发布处理结果并等待 JetStream 确认持久化，幂等键作为消息 ID 供服务端去重
+func (uc *UseCase) publishResult(ctx context.Context, versionID, idempotencyKey string, body []byte) error {
+	data, err := json.Marshal(resultMessage{VersionID: versionID, Result: body})
+	if err != nil {
+		return err
+	}
+	opts := []nats.PubOpt{nats.Context(ctx)}
+	if idempotencyKey != "" {
+		opts = append(opts, nats.MsgId(idempotencyKey))
+	}
+	_, err = uc.nats.JS.Publish(uc.resultSubject(), data, opts...)
+	return err
+}
+
+// publishProgress 通过 NATS 上报任务进度 (不保证送达)
+func (uc *UseCase) publishProgress(jobID string, req JobProgressRequest) error {
+	return uc.nats.Encoded.Publish(uc.workerSubject()+".progress", &progressMessage{JobID: jobID, Progress: req})
+}
+
+// startResultConsumer API 节点创建结果流 (如不存在) 并以持久消费者应用结果，
+// 消息在结果写库后才确认，API 重启或失败时由 JetStream 重新投递
+func (uc *UseCase) startResultConsumer() {
+	stream, subject := uc.resultStream(), uc.resultSubject()
+	if _, err := uc.nats.JS.StreamInfo(stream); errors.Is(err, nats.ErrStreamNotFound) {
+		_, err = uc.nats.JS.AddStream(&nats.StreamConfig{
+			Name:       stream,
+			Subjects:   []string{subject},
+			Retention:  nats.WorkQueuePolicy,
+			Storage:    nats.FileStorage,
+			MaxAge:     spoolMaxAge,
+			Duplicates: resultDedupWindow,
+		})
+		if err != nil {
+			slog.Error("创建结果流失败", "stream", stream, "error", err)
+			return
+		}
+		slog.Info("已创建结果流", "stream", stream, "subject", subject)
+	} else if err != nil {
+		slog.Error("查询结果流失败", "stream", stream, "error", err)
+		return
+	}
+
+	_, err := uc.nats.JS.QueueSubscribe(subject, resultConsumer, uc.onResultMessage,
+		nats.Durable(resultConsumer),
+		nats.BindStream(stream),
+		nats.ManualAck(),
+		nats.AckWait(resultAckWait),
+		nats.DeliverAll(),
+	)
+	if err != nil {
+		slog.Error("订阅处理结果失败", "subject", subject, "error", err)
+		return
+	}
+	slog.Info("处理结果订阅已启动", "subject", subject, "stream", stream)
+}
+
+// onResultMessage 应用一条结果消息并确认；暂时性失败稍后重新投递
+func (uc *UseCase) onResultMessage(msg *nats.Msg) {
+	ctx, cancel := context.WithTimeout(context.Background(), resultApplyTimeout)
+	defer cancel()
+
+	switch err := uc.applyResultMessage(ctx, msg.Data); {
+	case err == nil:
+		_ = msg.Ack()
+	case errors.Is(err, errMalformedResult), errors.Is(err, gorm.ErrRecordNotFound):
+		// 无法解析或版本已被删除：重试没有意义，终止投递
+		slog.Error("丢弃无法应用的处理结果", "error", err)
+		_ = msg.Term()
+	default:
+		slog.Error("应用处理结果失败，稍后重试", "error", err)
+		_ = msg.NakWithDelay(resultRetryDelay)
+	}
+}
+
+var errMalformedResult = errors.New("malformed result message")
+
+// applyResultMessage 解析结果消息并通过 ReportProcessResult 写库
+func (uc *UseCase) applyResultMessage(ctx context.Context, data []byte) error {
+	var msg resultMessage
+	if err := json.Unmarshal(data, &msg); err != nil || msg.VersionID == "" {
+		return errMalformedResult
+	}
+	var req ProcessResultRequest
+	if err := json.Unmarshal(msg.Result, &req); err != nil {
+		return errMalformedResult
+	}
+	return uc.ReportProcessResult(ctx, msg.VersionID, req)
+}
+
+// startProgressConsumer API 节点消费经 NATS 上报的任务进度
+func (uc *UseCase) startProgressConsumer() {
+	subject := uc.workerSubject() + ".progress"
+	_, err := uc.nats.Encoded.QueueSubscribe(subject, apiQueueGroup, func(msg *progressMessage) {
+		if err := uc.UpdateJobProgress(context.Background(), msg.JobID, msg.Progress); err != nil {
+			slog.Warn("记录任务进度失败", "job_id", msg.JobID, "error", err)
+		}
+	})
+	if err != nil {
+		slog.Error("订阅任务进度失败", "subject", subject, "error", err)
+	}
+}
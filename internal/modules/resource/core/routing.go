@@ -0,0 +1,45 @@
+package core
+
+import (
+	"slices"
+	"strings"
+)
+
+// workerQueueGroup Worker 订阅任务主题时使用的队列组，同一任务只投递给组内一个 Worker
+const workerQueueGroup = "simhub-workers"
+
+// jobMaxRejections 任务被无法处理的 Worker 转交的次数上限，超过后任务置为失败
+const jobMaxRejections = 10
+
+// jobSubject 资源类型与优先级对应的任务主题: <prefix>.<type_key>.<priority>
+// 类型键中的 NATS 保留字符 (分隔符、通配符、空白) 替换为下划线
+func jobSubject(prefix, typeKey, priority string) string {
+	token := strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '*', '>', ' ', '\t', '\r', '\n':
+			return '_'
+		}
+		return r
+	}, typeKey)
+	return prefix + "." + token + "." + normalizePriority(priority)
+}
+
+// acceptedTypes 本节点接收的资源类型：handlers 中声明的键 (含配置为空、无需计算的类型)、
+// 进程内处理器的键以及 worker.types 中额外声明的类型
+func (uc *UseCase) acceptedTypes() []string {
+	types := make([]string, 0, len(uc.handlers)+len(uc.processors)+len(uc.extraTypes))
+	for key := range uc.handlers {
+		types = append(types, key)
+	}
+	for key := range uc.processors {
+		types = append(types, key)
+	}
+	types = append(types, uc.extraTypes...)
+	slices.Sort(types)
+	return slices.Compact(types)
+}
+
+// acceptsType 判断本节点是否接收该资源类型的任务
+func (uc *UseCase) acceptsType(typeKey string) bool {
+	return slices.Contains(uc.acceptedTypes(), typeKey)
+}
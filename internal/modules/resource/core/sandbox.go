@@ -0,0 +1,219 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/liny/sim-hub/internal/conf"
+)
+
+// 处理器沙箱的默认限制
+const (
+	defaultProcessorTimeout = 30 * time.Minute
+	defaultMaxOpenFiles     = 1024
+	defaultMaxOutputBytes   = 16 << 20
+	maxStderrLogBytes       = 1 << 20         // 保留用于错误诊断的 stderr 上限
+	processorKillGrace      = 5 * time.Second // 超时终止后等待输出管道关闭的时间
+	defaultSandboxPath      = "/usr/local/bin:/usr/bin:/bin"
+)
+
+// sandboxLimits 单次处理器执行的限制
+type sandboxLimits struct {
+	Timeout     time.Duration
+	MemoryBytes uint64 // 0 表示不限制
+	CPUSeconds  uint64 // 0 表示不限制
+	OpenFiles   uint64
+	OutputBytes int
+	PassEnv     []string
+}
+
+// limitsFor 根据处理器选项确定执行限制，未配置的项使用默认值
+func limitsFor(opt conf.HandlerOption) sandboxLimits {
+	limits := sandboxLimits{
+		Timeout:     defaultProcessorTimeout,
+		OpenFiles:   defaultMaxOpenFiles,
+		OutputBytes: defaultMaxOutputBytes,
+		PassEnv:     opt.PassEnv,
+	}
+	if opt.Timeout > 0 {
+		limits.Timeout = opt.Timeout
+	}
+	if opt.MaxMemoryMB > 0 {
+		limits.MemoryBytes = uint64(opt.MaxMemoryMB) << 20
+	}
+	if opt.MaxCPUSeconds > 0 {
+		limits.CPUSeconds = uint64(opt.MaxCPUSeconds)
+	}
+	if opt.MaxOpenFiles > 0 {
+		limits.OpenFiles = uint64(opt.MaxOpenFiles)
+	}
+	if opt.MaxOutputBytes > 0 {
+		limits.OutputBytes = opt.MaxOutputBytes
+	}
+	return limits
+}
+
+// splitCommand 将处理器配置拆分为 argv，支持单双引号与反斜杠转义，不做变量展开等 shell 解释
+func splitCommand(cmdLine string) ([]string, error) {
+	var args []string
+	var cur strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+
+	for _, r := range cmdLine {
+		switch {
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '\\':
+			escaped, inArg = true, true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape in %q", cmdLine)
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	if len(args) == 0 {
+		return nil, errors.New("empty handler command")
+	}
+	return args, nil
+}
+
+// resolveExecutable 确定可执行文件的绝对路径；处理器在私有工作目录中运行，相对路径需按 Worker 的当前目录解析
+func resolveExecutable(name string) (string, error) {
+	if strings.ContainsRune(name, filepath.Separator) {
+		return filepath.Abs(name)
+	}
+	return exec.LookPath(name)
+}
+
+// sandboxEnv 构造处理器的精简环境变量，仅包含必要变量与显式透传的变量
+func sandboxEnv(workDir, outputDir string, passEnv []string) []string {
+	path := os.Getenv("PATH")
+	if path == "" {
+		path = defaultSandboxPath
+	}
+	env := []string{
+		"PATH=" + path,
+		"HOME=" + workDir,
+		"TMPDIR=" + workDir,
+		"LANG=C.UTF-8",
+	}
+	if outputDir != "" {
+		env = append(env, "SIMHUB_OUTPUT_DIR="+outputDir)
+	}
+	for _, name := range passEnv {
+		if v, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+v)
+		}
+	}
+	return env
+}
+
+// limitedBuffer 有上限的输出缓冲，超限后丢弃后续内容并标记 exceeded
+// (不返回错误：读取中断会使处理器阻塞在写管道上直到超时)
+type limitedBuffer struct {
+	buf      []byte
+	limit    int
+	exceeded bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.exceeded || len(b.buf)+len(p) > b.limit {
+		b.exceeded = true
+		return len(p), nil
+	}
+	b.buf = append(b.buf, p...)
+	return len(p), nil
+}
+
+func (b *limitedBuffer) Bytes() []byte {
+	return b.buf
+}
+
+func (b *limitedBuffer) String() string {
+	return string(b.buf)
+}
+
+// sandboxedRun 一次受限执行的输入输出
+type sandboxedRun struct {
+	Argv      []string
+	Stdin     io.Reader
+	Stdout    io.Writer
+	Stderr    io.Writer
+	OutputDir string // 通过 SIMHUB_OUTPUT_DIR 告知处理器，为空时不设置
+	Limits    sandboxLimits
+}
+
+// runSandboxed 在受限环境中执行处理器：直接 exec 不经过 shell，使用私有工作目录与精简环境变量，
+// 施加墙钟超时与资源上限 (Linux 上在 exec 处理器之前设置)，超时后终止整个进程组
+func runSandboxed(ctx context.Context, run sandboxedRun) error {
+	exe, err := resolveExecutable(run.Argv[0])
+	if err != nil {
+		return fmt.Errorf("resolve handler executable: %w", err)
+	}
+
+	workDir, err := os.MkdirTemp("", "simhub-work-*")
+	if err != nil {
+		return fmt.Errorf("create work dir: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	ctx, cancel := context.WithTimeout(ctx, run.Limits.Timeout)
+	defer cancel()
+
+	cmd, err := sandboxCommand(ctx, exe, run.Argv[1:], run.Limits)
+	if err != nil {
+		return err
+	}
+	cmd.Dir = workDir
+	cmd.Env = sandboxEnv(workDir, run.OutputDir, run.Limits.PassEnv)
+	cmd.Stdin = run.Stdin
+	cmd.Stdout = run.Stdout
+	cmd.Stderr = run.Stderr
+	cmd.WaitDelay = processorKillGrace
+	configureProcessGroup(cmd)
+
+	slog.Debug("执行外部处理器", "argv", run.Argv, "work_dir", workDir, "timeout", run.Limits.Timeout)
+	err = cmd.Run()
+	// 清理处理器遗留的后台子进程
+	killProcessGroup(cmd)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %s", run.Limits.Timeout)
+	}
+	return err
+}
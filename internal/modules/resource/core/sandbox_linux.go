@@ -0,0 +1,132 @@
+//go:build linux
+
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// rlimitShimArg 作为 argv[1] 时，当前进程是处理器的启动垫片 (见 sandboxCommand)
+const rlimitShimArg = "__simhub_rlimit_exec"
+
+// rlimitShimInstalled 宿主程序已调用 MaybeRunRlimitShim，可以重新执行自身作为启动垫片
+var rlimitShimInstalled atomic.Bool
+
+// errRlimitShimMissing 宿主程序未调用 MaybeRunRlimitShim，重新执行自身不会进入垫片
+var errRlimitShimMissing = errors.New("processor sandbox unavailable: the host program must call core.MaybeRunRlimitShim at the start of main")
+
+// MaybeRunRlimitShim 执行外部处理器的程序 (Worker) 在 main 开头调用：当前进程是启动垫片时
+// 设置资源上限并 exec 处理器，不再返回；否则登记垫片可用后返回。
+// 只有显式调用的程序会处理垫片参数，引用 core 包的其他程序 (包括测试) 的命令行不受影响
+func MaybeRunRlimitShim() {
+	if len(os.Args) > 1 && os.Args[1] == rlimitShimArg {
+		os.Exit(execWithRlimits(os.Args[2:]))
+	}
+	rlimitShimInstalled.Store(true)
+}
+
+// configureProcessGroup 让处理器运行在独立进程组中，取消时终止整个进程组
+func configureProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
+
+// killProcessGroup 终止进程组中的残留进程
+func killProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process != nil {
+		_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
+
+// sandboxCommand 构造处理器命令：先以启动垫片方式重新执行 Worker 自身，设置资源上限后再 exec 处理器，
+// 处理器及其派生的子进程从第一条指令起即受限制
+func sandboxCommand(ctx context.Context, exe string, args []string, limits sandboxLimits) (*exec.Cmd, error) {
+	if !rlimitShimInstalled.Load() {
+		return nil, errRlimitShimMissing
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("locate worker executable: %w", err)
+	}
+	shimArgs := append([]string{
+		rlimitShimArg,
+		strconv.FormatUint(limits.MemoryBytes, 10),
+		strconv.FormatUint(limits.CPUSeconds, 10),
+		strconv.FormatUint(limits.OpenFiles, 10),
+		exe,
+	}, args...)
+	return exec.CommandContext(ctx, self, shimArgs...), nil
+}
+
+// execWithRlimits 启动垫片：参数为 <内存> <CPU 秒> <文件数> <处理器> [参数...]，0 表示不限制。
+// 设置资源上限后以 execve 替换为处理器，只在失败时返回 (退出码 127)
+func execWithRlimits(args []string) int {
+	fail := func(err error) int {
+		fmt.Fprintf(os.Stderr, "simhub sandbox: %v\n", err)
+		return 127
+	}
+	if len(args) < 4 {
+		return fail(errors.New("missing arguments"))
+	}
+	var values [3]uint64
+	for i := range values {
+		v, err := strconv.ParseUint(args[i], 10, 64)
+		if err != nil {
+			return fail(err)
+		}
+		values[i] = v
+	}
+
+	// 设置内存上限之前准备好 execve 的参数，此后不再分配内存
+	path, err := unix.BytePtrFromString(args[3])
+	if err != nil {
+		return fail(err)
+	}
+	argv, err := cStrings(args[3:])
+	if err != nil {
+		return fail(err)
+	}
+	envv, err := cStrings(os.Environ())
+	if err != nil {
+		return fail(err)
+	}
+	// 内存上限最后设置，紧接着 exec
+	for _, l := range []struct {
+		resource int
+		value    uint64
+	}{{unix.RLIMIT_NOFILE, values[2]}, {unix.RLIMIT_CPU, values[1]}, {unix.RLIMIT_AS, values[0]}} {
+		if l.value == 0 {
+			continue
+		}
+		if err := unix.Setrlimit(l.resource, &unix.Rlimit{Cur: l.value, Max: l.value}); err != nil {
+			return fail(fmt.Errorf("setrlimit: %w", err))
+		}
+	}
+	_, _, errno := unix.RawSyscall(unix.SYS_EXECVE, uintptr(unsafe.Pointer(path)), uintptr(unsafe.Pointer(&argv[0])), uintptr(unsafe.Pointer(&envv[0])))
+	return fail(fmt.Errorf("exec %s: %w", args[3], errno))
+}
+
+// cStrings 转换为以 nil 结尾的 C 字符串指针数组
+func cStrings(ss []string) ([]*byte, error) {
+	ptrs := make([]*byte, len(ss)+1)
+	for i, s := range ss {
+		p, err := unix.BytePtrFromString(s)
+		if err != nil {
+			return nil, err
+		}
+		ptrs[i] = p
+	}
+	return ptrs, nil
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+
+package core
+
+import (
+	"context"
+	"os/exec"
+)
+
+// MaybeRunRlimitShim 非 Linux 平台没有启动垫片，调用无效果
+func MaybeRunRlimitShim() {}
+
+// configureProcessGroup 非 Linux 平台沿用默认的取消行为 (仅终止处理器进程本身)
+func configureProcessGroup(cmd *exec.Cmd) {}
+
+func killProcessGroup(cmd *exec.Cmd) {}
+
+// sandboxCommand 非 Linux 平台不支持为子进程设置资源上限，仅保留超时与输出上限
+func sandboxCommand(ctx context.Context, exe string, args []string, limits sandboxLimits) (*exec.Cmd, error) {
+	return exec.CommandContext(ctx, exe, args...), nil
+}
@@ -0,0 +1,174 @@
+package core
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/liny/sim-hub/internal/model"
+	"gorm.io/gorm"
+)
+
+// 空间检索：资源的地理范围取自最新版本元数据中的 bbox_wgs84 ([minLon, minLat, maxLon, maxLat])，
+// 由 GeoTIFF 提取器或 scenario.json 的 area 产出，也可由用户在 extra_meta 中提供。
+// 范围按 1°×1° 网格登记覆盖的单元，查询时先按单元取候选再精确比较边界，
+// 不依赖数据库的空间扩展，SQLite 与 Postgres 行为一致。
+const (
+	footprintMetaKey   = "bbox_wgs84"
+	gridCellDegrees    = 1
+	maxFootprintCells  = 4096 // 覆盖单元超过该数量的范围登记为大范围，任何查询都会作为候选
+	maxQueryCells      = 4096 // 查询范围覆盖的单元超过该数量时直接按边界过滤
+	largeFootprintCell = -1
+)
+
+// ErrInvalidBBox 查询参数 bbox 不合法
+var ErrInvalidBBox = errors.New("invalid bbox, expected minLon,minLat,maxLon,maxLat")
+
+// BBox WGS84 经纬度范围，不支持跨越 180° 经线
+type BBox struct {
+	MinLon, MinLat, MaxLon, MaxLat float64
+}
+
+func (b BBox) valid() bool {
+	for _, v := range []float64{b.MinLon, b.MinLat, b.MaxLon, b.MaxLat} {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return false
+		}
+	}
+	return b.MinLon >= -180 && b.MaxLon <= 180 && b.MinLat >= -90 && b.MaxLat <= 90 &&
+		b.MinLon <= b.MaxLon && b.MinLat <= b.MaxLat
+}
+
+// Slice 以 [minLon, minLat, maxLon, maxLat] 表示，与元数据和 Sidecar 中的格式一致
+func (b BBox) Slice() []float64 {
+	return []float64{b.MinLon, b.MinLat, b.MaxLon, b.MaxLat}
+}
+
+// ParseBBox 解析查询参数 "minLon,minLat,maxLon,maxLat"
+func ParseBBox(s string) (*BBox, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return nil, ErrInvalidBBox
+	}
+	var v [4]float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, ErrInvalidBBox
+		}
+		v[i] = f
+	}
+	b := BBox{v[0], v[1], v[2], v[3]}
+	if !b.valid() {
+		return nil, ErrInvalidBBox
+	}
+	return &b, nil
+}
+
+// bboxFromValue 从元数据或 Sidecar 中的值 ([]any 或 []float64) 解析范围
+func bboxFromValue(v any) (*BBox, bool) {
+	var nums []float64
+	switch arr := v.(type) {
+	case []float64:
+		nums = arr
+	case []any:
+		for _, item := range arr {
+			n, ok := confNumber(item)
+			if !ok {
+				return nil, false
+			}
+			nums = append(nums, n)
+		}
+	}
+	if len(nums) != 4 {
+		return nil, false
+	}
+	b := BBox{nums[0], nums[1], nums[2], nums[3]}
+	if !b.valid() {
+		return nil, false
+	}
+	return &b, true
+}
+
+// footprintFromMeta 版本元数据中的地理范围
+func footprintFromMeta(meta map[string]any) (*BBox, bool) {
+	return bboxFromValue(meta[footprintMetaKey])
+}
+
+// gridCells 范围覆盖的网格单元，超过 limit 时返回 false
+func gridCells(b BBox, limit int) ([]int, bool) {
+	idx := func(v, lo float64, n int) int {
+		return min(max(int(math.Floor((v-lo)/gridCellDegrees)), 0), n-1)
+	}
+	cols, rows := 360/gridCellDegrees, 180/gridCellDegrees
+	x0, x1 := idx(b.MinLon, -180, cols), idx(b.MaxLon, -180, cols)
+	y0, y1 := idx(b.MinLat, -90, rows), idx(b.MaxLat, -90, rows)
+	if (x1-x0+1)*(y1-y0+1) > limit {
+		return nil, false
+	}
+	cells := make([]int, 0, (x1-x0+1)*(y1-y0+1))
+	for y := y0; y <= y1; y++ {
+		for x := x0; x <= x1; x++ {
+			cells = append(cells, y*cols+x)
+		}
+	}
+	return cells, true
+}
+
+// setFootprint 在事务中替换资源的地理范围及其网格单元，fp 为空时清除
+func setFootprint(tx *gorm.DB, resourceID string, fp *BBox) error {
+	if err := tx.Delete(&model.ResourceFootprintCell{}, "resource_id = ?", resourceID).Error; err != nil {
+		return err
+	}
+	if err := tx.Delete(&model.ResourceFootprint{}, "resource_id = ?", resourceID).Error; err != nil {
+		return err
+	}
+	if fp == nil {
+		return nil
+	}
+	if err := tx.Create(&model.ResourceFootprint{
+		ResourceID: resourceID,
+		MinLon:     fp.MinLon,
+		MinLat:     fp.MinLat,
+		MaxLon:     fp.MaxLon,
+		MaxLat:     fp.MaxLat,
+	}).Error; err != nil {
+		return err
+	}
+	cells, ok := gridCells(*fp, maxFootprintCells)
+	if !ok {
+		cells = []int{largeFootprintCell}
+	}
+	rows := make([]model.ResourceFootprintCell, len(cells))
+	for i, c := range cells {
+		rows[i] = model.ResourceFootprintCell{ResourceID: resourceID, Cell: c}
+	}
+	return tx.CreateInBatches(rows, 500).Error
+}
+
+// updateFootprint 版本激活后同步资源的地理范围：只有最新版本决定资源的范围
+func updateFootprint(tx *gorm.DB, ver model.ResourceVersion) error {
+	var latest int
+	if err := tx.Model(&model.ResourceVersion{}).Where("resource_id = ?", ver.ResourceID).
+		Select("COALESCE(MAX(version_num), 0)").Scan(&latest).Error; err != nil {
+		return err
+	}
+	if ver.VersionNum < latest {
+		return nil
+	}
+	fp, _ := footprintFromMeta(ver.MetaData)
+	return setFootprint(tx, ver.ResourceID, fp)
+}
+
+// intersecting 限定查询为地理范围与 b 相交的资源
+func (uc *UseCase) intersecting(query *gorm.DB, b BBox) *gorm.DB {
+	candidates := uc.data.DB.Model(&model.ResourceFootprint{}).Select("resource_id").
+		Where("min_lon <= ? AND max_lon >= ? AND min_lat <= ? AND max_lat >= ?", b.MaxLon, b.MinLon, b.MaxLat, b.MinLat)
+	if cells, ok := gridCells(b, maxQueryCells); ok {
+		cells = append(cells, largeFootprintCell)
+		candidates = candidates.Where("resource_id IN (?)",
+			uc.data.DB.Model(&model.ResourceFootprintCell{}).Distinct("resource_id").Where("cell IN ?", cells))
+	}
+	return query.Where("id IN (?)", candidates)
+}
@@ -0,0 +1,49 @@
+// 测试用 WASM 处理器：读取输入文件大小，验证输入目录只读，并写出一个派生文件
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "--version" {
+		fmt.Println("wasm-0.1.0")
+		return
+	}
+
+	var req struct {
+		FilePath  string `json:"file_path"`
+		OutputDir string `json:"output_dir"`
+	}
+	if err := json.NewDecoder(os.Stdin).Decode(&req); err != nil {
+		fail(err)
+	}
+	data, err := os.ReadFile(req.FilePath)
+	if err != nil {
+		fail(err)
+	}
+	writeErr := os.WriteFile(filepath.Join(filepath.Dir(req.FilePath), "tamper"), nil, 0o644)
+	_, hostErr := os.Stat("/etc/passwd")
+	if err := os.WriteFile(filepath.Join(req.OutputDir, "summary.txt"), data, 0o644); err != nil {
+		fail(err)
+	}
+
+	out, _ := json.Marshal(map[string]any{
+		"status": "success",
+		"metadata": map[string]any{
+			"size":           len(data),
+			"input_writable": writeErr == nil,
+			"host_visible":   hostErr == nil,
+		},
+	})
+	fmt.Println(string(out))
+}
+
+func fail(err error) {
+	out, _ := json.Marshal(map[string]any{"status": "failed", "error": err.Error()})
+	fmt.Println(string(out))
+	os.Exit(0)
+}
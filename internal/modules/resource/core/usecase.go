@@ -4,32 +4,52 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log/slog"
 	"net/http"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/liny/sim-hub/internal/conf"
 	"github.com/liny/sim-hub/internal/data"
 	"github.com/liny/sim-hub/internal/model"
 	"github.com/liny/sim-hub/pkg/storage"
+	"github.com/nats-io/nats.go"
 	"gorm.io/gorm"
 )
 
 type UseCase struct {
-	data        *data.Data
-	store       storage.MultipartBlobStore
-	stsProvider storage.SecurityTokenProvider
-	minioConfig string
-	jobChan     chan processJob // 任务队列 (本地模式使用)
-	nats        *data.NATSClient
-	role        string // "api", "worker", "combined"
-	apiBaseURL  string
-	handlers    map[string]string // 资源类型与处理器的映射
+	data              *data.Data
+	store             storage.MultipartBlobStore
+	stsProvider       storage.SecurityTokenProvider
+	minioConfig       string
+	queue             *jobQueue   // Worker 本地任务队列，按优先级出队
+	control           *jobControl // 正在执行的任务，用于取消
+	nats              *data.NATSClient
+	role              string // "api", "worker", "combined"
+	apiBaseURL        string
+	callbackSecret    string            // Worker 回调 API 的 HMAC 共享密钥
+	spoolDir          string            // 结果上报失败时的本地暂存目录
+	httpClient        *http.Client      // Worker 回调 API 使用的客户端
+	handlers          map[string]string // 资源类型与处理器的映射
+	processorVersions map[string]string // 资源类型对应的处理器版本 (配置声明或 --version 握手获得)
+	handlerOptions    map[string]conf.HandlerOption
+	processors        map[string]Processor // 进程内处理器，优先于 handlers 中的外部命令
+	extraTypes        []string             // 额外接收的资源类型
+	limiter           *jobLimiter          // 并发限制，仅 worker/combined 角色
+	stats             *workerStats         // Worker 运行统计，仅 worker/combined 角色
+	stopCh            chan struct{}
+	stopOnce          sync.Once
+	subsMu            sync.Mutex
+	subs              map[string]*nats.Subscription // 各资源类型、优先级的任务订阅，饱和时暂停
+	outboxKick        chan struct{}                 // 唤醒发件箱转发器
+	cache             *contentCache                 // 输入文件缓存，未启用时为 nil
+	archives          *archiveCache                 // 归档目录缓存，用于浏览 ZIP 版本的内容
 }
 
 const (
@@ -40,41 +60,115 @@ const (
 type processJob struct {
 	Action    string
 	TypeKey   string
+	Priority  string // interactive, bulk, maintenance，为空按 interactive 处理
 	ObjectKey string
 	VersionID string
+
+	// 以下字段仅 ActionProcess 使用，为处理器提供上下文 (Worker 不访问数据库)
+	JobID       string
+	ResourceID  string
+	ProcessConf map[string]any
+	MetaData    map[string]any
+	Rejections  int // 被无法处理该任务的 Worker 转交的次数，见 rejectJob
 }
 
-func NewUseCase(d *data.Data, store storage.MultipartBlobStore, stsProvider storage.SecurityTokenProvider, bucket string, natsClient *data.NATSClient, role string, apiBaseURL string, handlers map[string]string) *UseCase {
+func NewUseCase(d *data.Data, store storage.MultipartBlobStore, stsProvider storage.SecurityTokenProvider, bucket string, natsClient *data.NATSClient, role string, workerConf conf.Worker) *UseCase {
 	uc := &UseCase{
-		data:        d,
-		store:       store,
-		stsProvider: stsProvider,
-		minioConfig: bucket,
-		jobChan:     make(chan processJob, 1000), // 缓冲区
-		nats:        natsClient,
-		role:        role,
-		apiBaseURL:  apiBaseURL,
-		handlers:    handlers,
+		data:           d,
+		store:          store,
+		stsProvider:    stsProvider,
+		minioConfig:    bucket,
+		queue:          newJobQueue(),
+		control:        newJobControl(),
+		nats:           natsClient,
+		role:           role,
+		apiBaseURL:     workerConf.ApiBaseURL,
+		callbackSecret: workerConf.CallbackSecret,
+		spoolDir:       workerConf.SpoolDir,
+		httpClient:     &http.Client{Timeout: callbackTimeout},
+		handlers:       workerConf.Handlers,
+		handlerOptions: workerConf.HandlerOptions,
+		extraTypes:     workerConf.Types,
+		stopCh:         make(chan struct{}),
+		outboxKick:     make(chan struct{}, 1),
+		archives:       newArchiveCache(archiveCacheMaxEntries),
+	}
+	if uc.spoolDir == "" {
+		uc.spoolDir = filepath.Join(os.TempDir(), defaultSpoolDirName)
 	}
 
 	// 任务消费者启动逻辑
 	if role == "worker" || role == "combined" {
-		if natsClient != nil && natsClient.Config.Enabled {
-			// 分布式模式：启动 NATS 订阅者
-			go uc.startNATSSubscriber()
-		} else {
-			// 本地模式：启动内部 Worker
-			for i := 0; i < 4; i++ {
-				go uc.startWorker(i)
+		uc.processors = registeredProcessors()
+		uc.processorVersions = detectProcessorVersions(workerConf.Handlers, workerConf.HandlerVersions, workerConf.HandlerOptions)
+		for key, p := range uc.processors {
+			uc.processorVersions[key] = p.Version()
+			slog.Info("已加载进程内处理器", "key", key, "version", p.Version())
+		}
+
+		if workerConf.CacheMaxMB > 0 {
+			dir := workerConf.CacheDir
+			if dir == "" {
+				dir = filepath.Join(os.TempDir(), defaultCacheDirName)
 			}
+			cache, err := newContentCache(dir, int64(workerConf.CacheMaxMB)<<20)
+			if err != nil {
+				slog.Error("初始化输入文件缓存失败，不使用缓存", "dir", dir, "error", err)
+			} else {
+				uc.cache = cache
+				slog.Info("输入文件缓存已启用", "dir", dir, "max_mb", workerConf.CacheMaxMB)
+			}
+		}
+
+		uc.stats = newWorkerStats()
+		uc.limiter = newJobLimiter(workerConf.Concurrency, workerConf.TypeConcurrency)
+		if natsClient != nil && natsClient.Config.Enabled {
+			// 分布式模式：NATS 订阅者把任务写入本地队列
+			uc.startNATSSubscriber()
+			uc.startCancelSubscriber()
+		}
+		for i := 0; i < uc.limiter.limit; i++ {
+			go uc.startWorker(i)
+		}
+		go uc.startHeartbeat()
+		if role == "worker" {
+			go uc.startSpoolFlusher()
 		}
 	} else {
 		slog.Info("当前节点为 API 模式，不启动本地任务执行器")
 	}
 
+	// 持有数据库的节点负责发布发件箱中的任务，并把失联 Worker 遗留的任务重新排队；未启用 NATS 的 API 节点没有任务的接收方，
+	// 不启动转发器，任务留在发件箱中，直到以启用 NATS 或 combined 角色运行的节点发布
+	if (role == "api" || role == "combined") && d != nil && d.DB != nil {
+		if role == "combined" || (natsClient != nil && natsClient.Config.Enabled) {
+			go uc.startOutboxRelay()
+			go uc.startWorkerReaper()
+		} else {
+			slog.Error("API 节点未启用 NATS，没有 Worker 能接收任务，处理任务将保留在发件箱中")
+		}
+	}
+
+	if role == "api" || role == "combined" {
+		if err := ValidateCallbackSecret(uc.callbackSecret); err != nil {
+			slog.Error("Worker 回调密钥无效，回调接口将拒绝所有请求", "error", err)
+		}
+	}
+
+	// 分布式模式下，没有 Worker 接收的任务保持排队，由 API 节点定期重新投递
+	if (role == "api" || role == "combined") && natsClient != nil && natsClient.Config.Enabled {
+		go uc.startJobRedispatcher()
+		go uc.startHeartbeatConsumer()
+		if uc.resultsOverNATS() {
+			go uc.startResultConsumer()
+			go uc.startProgressConsumer()
+		}
+	}
+
 	return uc
 }
 
+// dispatchJob 派发 Sidecar 刷新任务；调用方须在事务提交后调用，处理任务经发件箱发布 (见 enqueueProcessJob)
 func (uc *UseCase) dispatchJob(job processJob) {
 	// ActionRefresh 需要数据库访问，强制在本地执行 (API 节点有 DB)
 	if job.Action == ActionRefresh {
@@ -82,40 +176,179 @@ func (uc *UseCase) dispatchJob(job processJob) {
 		return
 	}
 
+	if err := uc.publishJob(job); err != nil {
+		// 任务记录保持 QUEUED，由重新投递机制在 NATS 恢复后补发
+		slog.Error("发送 NATS 消息失败，任务保持排队", "job_id", job.JobID, "error", err)
+	}
+}
+
+// publishJob 发布处理任务：分布式模式发布到 NATS 并等待服务端确认收到，本地模式写入本地队列；
+// 本节点不执行任务 (api 角色) 时本地队列无人消费，返回错误使任务留在发件箱中
+func (uc *UseCase) publishJob(job processJob) error {
 	if uc.nats != nil && uc.nats.Config.Enabled {
-		if err := uc.nats.Encoded.Publish(uc.nats.Config.Subject, &job); err != nil {
-			slog.Error("发送 NATS 消息失败，回退到本地队列", "error", err)
-			// 如果是 API 模式且未启动 Worker，这里写入 jobChan 可能会阻塞或死锁
-			// 但一般 fallback 意味着 NATS 挂了，系统降级
-			uc.jobChan <- job
+		if err := uc.nats.Encoded.Publish(jobSubject(uc.nats.Config.Subject, job.TypeKey, job.Priority), &job); err != nil {
+			return err
 		}
-		return
+		return uc.nats.Conn.FlushTimeout(5 * time.Second)
+	}
+	if uc.role == "api" {
+		return errNoJobConsumer
 	}
-	uc.jobChan <- job
+	uc.queue.Push(job)
+	return nil
 }
 
+// startNATSSubscriber 按本节点可处理的资源类型订阅任务主题，同类型的多个 Worker 组成队列组分摊任务
 func (uc *UseCase) startNATSSubscriber() {
-	slog.Info("NATS 订阅者已启动", "subject", uc.nats.Config.Subject)
-	_, err := uc.nats.Encoded.Subscribe(uc.nats.Config.Subject, func(job *processJob) {
-		slog.Debug("接收到 NATS 任务", "action", job.Action, "key", job.ObjectKey)
-		uc.handleJob(context.Background(), *job)
-	})
-	if err != nil {
-		slog.Error("NATS 订阅失败", "error", err)
+	if len(uc.acceptedTypes()) == 0 {
+		slog.Warn("Worker 未配置任何处理器，不会接收任务")
+		return
+	}
+	uc.subs = make(map[string]*nats.Subscription)
+	uc.refreshSubscriptions()
+}
+
+// refreshSubscriptions 按执行槽位调整订阅：类型饱和时退订 (Drain 会处理完已收到的消息)，
+// 使队列组把新任务投递给其他 Worker；有空闲槽位后重新订阅。
+// 本地已有该类型任务排队时同时暂停 bulk/maintenance 订阅，避免低优先级任务积压在单个 Worker 上
+func (uc *UseCase) refreshSubscriptions() {
+	uc.subsMu.Lock()
+	defer uc.subsMu.Unlock()
+	if uc.subs == nil {
+		return
+	}
+
+	for _, typeKey := range uc.acceptedTypes() {
+		saturated := uc.limiter.Saturated(typeKey)
+		backlog := uc.queue.Pending(typeKey) > 0
+		for _, priority := range jobPriorities {
+			subject := jobSubject(uc.nats.Config.Subject, typeKey, priority)
+			sub, active := uc.subs[subject]
+			if saturated || (backlog && priority != PriorityInteractive) {
+				if active {
+					if err := sub.Drain(); err != nil {
+						slog.Warn("暂停 NATS 订阅失败", "subject", subject, "error", err)
+					}
+					delete(uc.subs, subject)
+					slog.Debug("执行槽位已满，暂停接收任务", "subject", subject)
+				}
+				continue
+			}
+			if active {
+				continue
+			}
+
+			sub, err := uc.nats.Encoded.QueueSubscribe(subject, workerQueueGroup, uc.onNATSJob)
+			if err != nil {
+				slog.Error("NATS 订阅失败", "subject", subject, "error", err)
+				continue
+			}
+			uc.subs[subject] = sub
+			slog.Debug("NATS 订阅者已启动", "subject", subject)
+		}
 	}
 }
 
+// onNATSJob 将收到的任务写入本地队列，由执行器按优先级取出；已收到的任务不会丢弃，
+// 本节点无法处理的任务不占用队列，转交其他 Worker
+func (uc *UseCase) onNATSJob(job *processJob) {
+	slog.Debug("接收到 NATS 任务", "action", job.Action, "key", job.ObjectKey, "priority", job.Priority)
+	if reason := uc.unhandledReason(*job); reason != "" {
+		uc.rejectJob(context.Background(), *job, reason)
+		return
+	}
+	uc.queue.Push(*job)
+	uc.refreshSubscriptions()
+}
+
+// unhandledReason 本节点无法处理该任务的原因，可以处理时返回空。
+// 订阅只覆盖本节点接收的类型，但类型键中的保留字符替换后可能映射到同一主题 (见 jobSubject)；
+// 流水线任务还要求本节点具备全部必需阶段的处理器，同类型的 Worker 配置可能不同
+func (uc *UseCase) unhandledReason(job processJob) string {
+	stages := parsePipeline(job.ProcessConf)
+	if len(stages) == 0 {
+		if !uc.acceptsType(job.TypeKey) {
+			return fmt.Sprintf("no handler configured for type %s", job.TypeKey)
+		}
+		return ""
+	}
+	if missing := uc.missingStages(stages); len(missing) > 0 {
+		return fmt.Sprintf("no handler configured for required stages: %s", strings.Join(missing, ", "))
+	}
+	return ""
+}
+
+// rejectJob 本节点无法处理的任务重新发布，由队列组投递给其他 Worker；
+// 转交次数达到上限 (或无法发布) 时认为没有 Worker 能处理，任务与版本置为失败并记录原因，而不是无限排队
+func (uc *UseCase) rejectJob(ctx context.Context, job processJob, reason string) {
+	job.Rejections++
+	if job.Rejections < jobMaxRejections {
+		err := uc.publishJob(job)
+		if err == nil {
+			slog.Warn("本节点无法处理该任务，转交其他 Worker", "job_id", job.JobID, "type", job.TypeKey, "reason", reason, "rejections", job.Rejections)
+			return
+		}
+		slog.Warn("转交任务失败", "job_id", job.JobID, "error", err)
+	}
+	slog.Error("没有 Worker 能处理该任务", "job_id", job.JobID, "type", job.TypeKey, "reason", reason)
+	uc.reportFailure(ctx, job, reason, nil)
+}
+
+// jobCancel 任务取消通知，广播给所有 Worker
+type jobCancel struct {
+	JobID string `json:"job_id"`
+}
+
+// startCancelSubscriber 订阅任务取消通知 (非队列组，每个 Worker 都会收到)
+func (uc *UseCase) startCancelSubscriber() {
+	subject := uc.workerSubject() + ".cancel"
+	if _, err := uc.nats.Encoded.Subscribe(subject, func(msg *jobCancel) {
+		uc.cancelLocal(msg.JobID)
+	}); err != nil {
+		slog.Error("订阅任务取消通知失败", "subject", subject, "error", err)
+	}
+}
+
+// cancelLocal 取消本节点上的任务：排队中的直接移除，执行中的取消上下文终止处理器
+func (uc *UseCase) cancelLocal(jobID string) {
+	if uc.queue.Remove(jobID) {
+		slog.Info("已从本地队列移除取消的任务", "job_id", jobID)
+		uc.refreshSubscriptions()
+		return
+	}
+	if uc.control.cancel(jobID) {
+		slog.Info("已终止正在执行的任务", "job_id", jobID)
+	}
+}
+
+// startWorker 执行器：按优先级取出有空闲槽位的任务执行，类型槽位已满的任务留在队列中
 func (uc *UseCase) startWorker(id int) {
 	slog.Info("本地 Worker 启动", "worker_id", id)
-	for job := range uc.jobChan {
+	for {
+		job := uc.queue.Pop(uc.limiter.TryAcquire)
+		uc.refreshSubscriptions()
 		uc.handleJob(context.Background(), job)
+		uc.limiter.Release(job.TypeKey)
+		uc.queue.Notify()
+		uc.refreshSubscriptions()
 	}
 }
 
 func (uc *UseCase) handleJob(ctx context.Context, job processJob) {
 	switch job.Action {
 	case ActionProcess:
-		uc.processResourceInternal(ctx, job.TypeKey, job.ObjectKey, job.VersionID)
+		ctx, cancel, ok := uc.control.start(ctx, job.JobID)
+		if !ok {
+			slog.Info("任务已取消，跳过执行", "job_id", job.JobID)
+			return
+		}
+		defer func() {
+			cancel()
+			uc.control.finish(job.JobID)
+		}()
+		uc.stats.jobStarted(job.JobID)
+		defer uc.stats.jobStopped(job.JobID)
+		uc.processResourceInternal(ctx, job)
 	case ActionRefresh:
 		uc.syncSidecarInternal(ctx, job.ObjectKey, job.VersionID)
 	}
@@ -169,9 +402,13 @@ type GetPartURLResponse struct {
 }
 
 type ProcessResultRequest struct {
-	MetaData map[string]any `json:"meta_data"`
-	State    string         `json:"state"` // ACTIVE, ERROR
-	Message  string         `json:"message,omitempty"`
+	MetaData         map[string]any   `json:"meta_data"`
+	State            string           `json:"state"` // ACTIVE, ERROR
+	Message          string           `json:"message,omitempty"`
+	ProcessorVersion string           `json:"processor_version,omitempty"` // 产出元数据的处理器版本
+	JobID            string           `json:"job_id,omitempty"`            // 对应的处理任务，用于结束任务记录
+	Renditions       []RenditionDTO   `json:"renditions,omitempty"`        // 已上传的派生文件
+	Stages           []model.JobStage `json:"stages,omitempty"`            // 流水线各阶段的最终状态
 }
 
 type CompleteMultipartUploadRequest struct {
@@ -218,11 +455,13 @@ type ResourceDTO struct {
 }
 
 type ResourceVersionDTO struct {
-	VersionNum  int            `json:"version_num"`
-	FileSize    int64          `json:"file_size"`
-	MetaData    map[string]any `json:"meta_data"`
-	State       string         `json:"state"`
-	DownloadURL string         `json:"download_url,omitempty"`
+	VersionNum       int            `json:"version_num"`
+	FileSize         int64          `json:"file_size"`
+	MetaData         map[string]any `json:"meta_data"`
+	State            string         `json:"state"`
+	DownloadURL      string         `json:"download_url,omitempty"`
+	ProcessorVersion string         `json:"processor_version,omitempty"` // 产出元数据的处理器版本
+	ErrorMessage     string         `json:"error_message,omitempty"`     // 处理失败原因
 }
 
 // Logic Methods 业务逻辑方法
@@ -318,9 +557,13 @@ func (uc *UseCase) CompleteMultipartUpload(ctx context.Context, req CompleteMult
 	}
 
 	// 3. 注册到数据库
-	return uc.data.DB.Transaction(func(tx *gorm.DB) error {
+	err = uc.data.DB.Transaction(func(tx *gorm.DB) error {
 		return uc.createResourceAndVersion(tx, req.TypeKey, req.CategoryID, req.Name, req.OwnerID, objectKey, objInfo.Size, req.Tags, req.ExtraMeta)
 	})
+	if err == nil {
+		uc.kickOutbox()
+	}
+	return err
 }
 
 // ConfirmUpload 确认上传完成
@@ -337,9 +580,13 @@ func (uc *UseCase) ConfirmUpload(ctx context.Context, req ConfirmUploadRequest)
 		return fmt.Errorf("uploaded file not found: %w", err)
 	}
 
-	return uc.data.DB.Transaction(func(tx *gorm.DB) error {
+	err = uc.data.DB.Transaction(func(tx *gorm.DB) error {
 		return uc.createResourceAndVersion(tx, req.TypeKey, req.CategoryID, req.Name, req.OwnerID, objectKey, objInfo.Size, req.Tags, req.ExtraMeta)
 	})
+	if err == nil {
+		uc.kickOutbox()
+	}
+	return err
 }
 
 // createResourceAndVersion 内部统一资源注册逻辑
@@ -355,147 +602,158 @@ func (uc *UseCase) createResourceAndVersion(tx *gorm.DB, typeKey, categoryID, na
 		return err
 	}
 
+	// ExtraMeta 为 nil 表示用户元数据未知 (见 ReportProcessResult)，未提供时记为空
+	if meta == nil {
+		meta = map[string]any{}
+	}
 	ver := model.ResourceVersion{
 		ResourceID: res.ID,
 		VersionNum: 1,
 		FilePath:   objectKey,
 		FileSize:   size,
 		MetaData:   meta,
+		ExtraMeta:  meta,
 		State:      "PENDING",
 	}
 	if err := tx.Create(&ver).Error; err != nil {
 		return err
 	}
 
-	// 触发异步处理
-	uc.dispatchJob(processJob{
-		Action:    ActionProcess,
-		TypeKey:   typeKey,
-		ObjectKey: objectKey,
-		VersionID: ver.ID,
-	})
-	return nil
+	// 触发异步处理：任务随事务提交后由发件箱转发器发布
+	return uc.enqueueProcessJob(tx, ver, typeKey, PriorityInteractive)
 }
 
 // processResourceInternal 异步处理资源逻辑 (由 Worker 调用)
-func (uc *UseCase) processResourceInternal(ctx context.Context, typeKey, objectKey, versionID string) {
+func (uc *UseCase) processResourceInternal(ctx context.Context, job processJob) {
+	typeKey, objectKey := job.TypeKey, job.ObjectKey
 	slog.Debug("开始处理资源", "key", objectKey, "type", typeKey, "role", uc.role)
 
-	// 1. 查询本地是否存在对应的处理器
-	processorCmd := uc.handlers[typeKey]
-
-	finalMeta := make(map[string]any)
-	if processorCmd != "" {
-		// --- 真实执行逻辑 ---
-		// 1. 下载文件到本地临时目录
-		ext := ""
-		if parts := strings.Split(objectKey, "."); len(parts) > 1 {
-			ext = "." + parts[len(parts)-1]
+	// 1. 确定处理流水线：优先使用 ProcessConf.pipeline，否则按资源类型查找单个处理器
+	// 本节点不具备该类型或流水线必需阶段的处理能力：在开始执行任何阶段之前转交其他 Worker，
+	// 而不是误报完成或执行到该阶段才失败；没有 Worker 能处理时任务与版本置为失败 (本地模式与分布式模式相同)
+	if reason := uc.unhandledReason(job); reason != "" {
+		uc.rejectJob(ctx, job, reason)
+		return
+	}
+	stages := parsePipeline(job.ProcessConf)
+	if len(stages) == 0 {
+		if !uc.hasProcessor(typeKey) {
+			// 显式声明但不需要计算的类型 (handlers 中配置为空)
+			slog.Debug("该类型无需计算，跳过", "type", typeKey)
+			uc.reportResult(ctx, job, pipelineResult{MetaData: map[string]any{"status": "skipped"}})
+			return
 		}
+		stages = []PipelineStage{{Name: typeKey}}
+	}
+	uc.reportProgress(ctx, job.JobID, JobProgressRequest{Percent: 0, Message: "started"})
 
-		tempFile, err := os.CreateTemp("", "simhub-resource-*"+ext)
-		if err != nil {
-			slog.Error("创建临时文件失败", "error", err)
-			return // 应该上报 ERROR 状态
-		}
-		defer os.Remove(tempFile.Name())
-		defer tempFile.Close()
+	// 2. 获取输入文件 (本地缓存或下载)，供所有阶段共用
+	inputPath, release, err := uc.fetchInput(ctx, job)
+	if err != nil {
+		slog.Error("下载资源文件失败", "key", objectKey, "error", err)
+		uc.reportFailure(ctx, job, fmt.Sprintf("Failed to download resource: %v", err), nil)
+		return
+	}
+	defer release()
 
-		// 从 MinIO 下载
-		obj, err := uc.store.Get(ctx, uc.minioConfig, objectKey)
+	// 资源类型声明 extract 时解压归档，处理器拿到解压后的目录
+	if opts, ok := parseExtractOptions(job.ProcessConf); ok {
+		dir, err := extractInput(ctx, inputPath, opts)
 		if err != nil {
-			slog.Error("下载资源文件失败", "key", objectKey, "error", err)
-			return
-		}
-
-		if _, err := io.Copy(tempFile, obj); err != nil {
-			obj.Close()
-			slog.Error("保存临时文件失败", "error", err)
-			return
-		}
-		obj.Close()
-
-		slog.Info("文件已下载至本地，准备处理", "path", tempFile.Name())
-
-		// 2. 执行外部命令
-		// 格式: <cmd> <filepath>
-		// 输出: JSON 格式的 metadata 到 stdout
-		cmd := exec.CommandContext(ctx, "sh", "-c", fmt.Sprintf("%s '%s'", processorCmd, tempFile.Name()))
-		var stdout, stderr bytes.Buffer
-		cmd.Stdout = &stdout
-		cmd.Stderr = &stderr
-
-		slog.Debug("执行外部处理器", "cmd", cmd.String())
-		startTime := time.Now()
-		if err := cmd.Run(); err != nil {
-			slog.Error("外部处理器执行失败", "error", err, "stderr", stderr.String())
-			// 上报错误状态
-			uc.notifyResult(ctx, versionID, ProcessResultRequest{
-				State:   "ERROR",
-				Message: fmt.Sprintf("Processor failed: %v, stderr: %s", err, stderr.String()),
-			})
+			slog.Error("解压资源文件失败", "key", objectKey, "error", err)
+			uc.reportFailure(ctx, job, fmt.Sprintf("Failed to extract archive: %v", err), nil)
 			return
 		}
+		defer os.RemoveAll(dir)
+		inputPath = dir
+	}
 
-		duration := time.Since(startTime)
-		slog.Info("外部处理器执行完成", "duration", duration)
+	slog.Info("文件已就绪，准备处理", "path", inputPath, "stages", len(stages))
 
-		// 3. 解析结果
-		if err := json.Unmarshal(stdout.Bytes(), &finalMeta); err != nil {
-			slog.Warn("处理器输出非 JSON 格式，忽略元数据", "output", stdout.String())
-			finalMeta["raw_output"] = stdout.String()
-		} else {
-			// 追加系统级元数据
-			finalMeta["processed_by"] = "simhub-worker"
-			finalMeta["processed_at"] = time.Now().Format(time.RFC3339)
-			finalMeta["processor_duration_ms"] = duration.Milliseconds()
-		}
-	} else {
-		slog.Debug("未配置该类型的处理器，跳过计算", "type", typeKey)
-		finalMeta["status"] = "skipped"
+	// 3. 依次执行各阶段，全部必需阶段通过后版本才会激活
+	startTime := time.Now()
+	result := uc.runPipeline(ctx, job, stages, inputPath)
+	if result.Failure != "" {
+		// 失败的结果不会被接受，此前阶段已上传的派生文件不再需要
+		uc.discardRenditions(result.Renditions)
+		uc.reportFailure(ctx, job, result.Failure, result.Stages)
+		return
 	}
 
-	// 2. 上报结果
-	err := uc.notifyResult(ctx, versionID, ProcessResultRequest{
-		MetaData: finalMeta,
-		State:    "ACTIVE",
+	duration := time.Since(startTime)
+	slog.Info("资源处理完成", "key", objectKey, "duration", duration)
+
+	// 追加系统级元数据
+	result.MetaData["processed_by"] = "simhub-worker"
+	result.MetaData["processed_at"] = time.Now().Format(time.RFC3339)
+	result.MetaData["processor_duration_ms"] = duration.Milliseconds()
+	uc.reportResult(ctx, job, result)
+}
+
+// reportResult 上报处理成功，版本将被置为 ACTIVE
+func (uc *UseCase) reportResult(ctx context.Context, job processJob, result pipelineResult) {
+	if jobCanceled(ctx, job) {
+		uc.discardRenditions(result.Renditions)
+		return
+	}
+	// 无法编码的元数据 (如 NaN/Inf) 既不能上报也不能写库，按失败上报，避免任务一直停留在运行中被反复重新排队
+	if _, err := json.Marshal(result.MetaData); err != nil {
+		slog.Error("处理器产出的元数据无法编码", "key", job.ObjectKey, "error", err)
+		uc.discardRenditions(result.Renditions)
+		uc.reportFailure(ctx, job, fmt.Sprintf("processor metadata cannot be encoded: %v", err), result.Stages)
+		return
+	}
+	err := uc.notifyResult(ctx, job.VersionID, ProcessResultRequest{
+		MetaData:         result.MetaData,
+		State:            "ACTIVE",
+		ProcessorVersion: result.ProcessorVersion,
+		JobID:            job.JobID,
+		Renditions:       result.Renditions,
+		Stages:           result.Stages,
 	})
 
+	uc.stats.jobFinished(true)
 	if err != nil {
 		slog.Error("处理结果上报失败", "error", err)
 	} else {
-		slog.Debug("资源处理结果已成功同步", "key", objectKey)
+		slog.Debug("资源处理结果已成功同步", "key", job.ObjectKey)
 	}
 }
 
-// notifyResult 根据节点角色选择上报方式（直接写库或通过 HTTP API）
-func (uc *UseCase) notifyResult(ctx context.Context, versionID string, req ProcessResultRequest) error {
-	if uc.role == "api" || uc.role == "combined" {
-		// 本地模式：直接调用内部方法写库
-		return uc.ReportProcessResult(ctx, versionID, req)
+// reportFailure 上报处理失败，版本将被置为 ERROR
+func (uc *UseCase) reportFailure(ctx context.Context, job processJob, message string, stages []model.JobStage) {
+	if jobCanceled(ctx, job) {
+		return
 	}
-
-	// 远程 Worker 模式：通过 HTTP Callback 上报给 API 节点
-	callbackURL := fmt.Sprintf("%s/api/v1/resources/%s/process-result", uc.apiBaseURL, versionID)
-	body, _ := json.Marshal(req)
-
-	httpReq, err := http.NewRequestWithContext(ctx, "PATCH", callbackURL, bytes.NewReader(body))
-	if err != nil {
-		return err
+	uc.stats.jobFinished(false)
+	if err := uc.notifyResult(ctx, job.VersionID, ProcessResultRequest{
+		State:   "ERROR",
+		Message: message,
+		JobID:   job.JobID,
+		Stages:  stages,
+	}); err != nil {
+		slog.Error("处理失败结果上报失败", "version_id", job.VersionID, "error", err)
 	}
-	httpReq.Header.Set("Content-Type", "application/json")
+}
 
-	resp, err := http.DefaultClient.Do(httpReq)
-	if err != nil {
-		return err
+// jobCanceled 任务被取消时处理器随上下文终止，API 已记录取消状态，不再上报结果
+func jobCanceled(ctx context.Context, job processJob) bool {
+	if errors.Is(ctx.Err(), context.Canceled) {
+		slog.Info("任务已取消，不上报处理结果", "job_id", job.JobID)
+		return true
 	}
-	defer resp.Body.Close()
+	return false
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("callback failed with status: %d", resp.StatusCode)
+// notifyResult 根据节点角色选择上报方式（直接写库或通过 HTTP API）
+func (uc *UseCase) notifyResult(ctx context.Context, versionID string, req ProcessResultRequest) error {
+	if uc.role == "api" || uc.role == "combined" {
+		// 本地模式：直接调用内部方法写库
+		return uc.ReportProcessResult(ctx, versionID, req)
 	}
 
-	return nil
+	// 远程 Worker 模式：通过 HTTP Callback 或 NATS 结果主题上报给 API 节点，任务 ID 作为幂等键
+	return uc.deliverResult(ctx, versionID, ResultIdempotencyKey(versionID, req.JobID), req)
 }
 
 // syncSidecarInternal 仅执行元数据同步到存储 (不涉及外部 Processor)
@@ -516,8 +774,14 @@ func (uc *UseCase) syncSidecarInternal(ctx context.Context, objectKey, versionID
 		"version_id":    ver.ID,
 		"type_key":      res.TypeKey,
 		"metadata":      ver.MetaData,
+		"extra_meta":    ver.ExtraMeta,
+		"processor":     ver.ProcessorVersion,
 		"synced_at":     time.Now().Format(time.RFC3339),
 	}
+	// 地理范围单独写出，存储同步时无需解析元数据即可恢复空间索引
+	if fp, ok := footprintFromMeta(ver.MetaData); ok {
+		sidecarData["footprint"] = fp.Slice()
+	}
 
 	if sidecarBytes, err := json.Marshal(sidecarData); err == nil {
 		if err := uc.store.Put(ctx, uc.minioConfig, sidecarKey, bytes.NewReader(sidecarBytes), int64(len(sidecarBytes)), "application/json"); err != nil {
@@ -554,17 +818,19 @@ func (uc *UseCase) GetResource(ctx context.Context, id string) (*ResourceDTO, er
 		Tags:       r.Tags,
 		CreatedAt:  r.CreatedAt,
 		LatestVer: &ResourceVersionDTO{
-			VersionNum:  v.VersionNum,
-			FileSize:    v.FileSize,
-			MetaData:    v.MetaData,
-			State:       v.State,
-			DownloadURL: url,
+			VersionNum:       v.VersionNum,
+			FileSize:         v.FileSize,
+			MetaData:         v.MetaData,
+			State:            v.State,
+			DownloadURL:      url,
+			ProcessorVersion: v.ProcessorVersion,
+			ErrorMessage:     v.ErrorMessage,
 		},
 	}, nil
 }
 
-// ListResources 列出资源
-func (uc *UseCase) ListResources(ctx context.Context, typeKey string, categoryID string, page, size int) ([]*ResourceDTO, int64, error) {
+// ListResources 列出资源，bbox 不为空时只返回地理范围与之相交的资源
+func (uc *UseCase) ListResources(ctx context.Context, typeKey string, categoryID string, bbox *BBox, page, size int) ([]*ResourceDTO, int64, error) {
 	var resources []model.Resource
 	var total int64
 	offset := (page - 1) * size
@@ -576,6 +842,9 @@ func (uc *UseCase) ListResources(ctx context.Context, typeKey string, categoryID
 	if categoryID != "" {
 		query = query.Where("category_id = ?", categoryID)
 	}
+	if bbox != nil {
+		query = uc.intersecting(query, *bbox)
+	}
 
 	if err := query.Count(&total).Limit(size).Offset(offset).Order("created_at desc").Find(&resources).Error; err != nil {
 		return nil, 0, err
@@ -596,9 +865,10 @@ func (uc *UseCase) ListResources(ctx context.Context, typeKey string, categoryID
 			Tags:       r.Tags,
 			CreatedAt:  r.CreatedAt,
 			LatestVer: &ResourceVersionDTO{
-				VersionNum: v.VersionNum,
-				State:      v.State,
-				MetaData:   v.MetaData,
+				VersionNum:   v.VersionNum,
+				State:        v.State,
+				MetaData:     v.MetaData,
+				ErrorMessage: v.ErrorMessage,
 			},
 		})
 	}
@@ -639,22 +909,31 @@ func (uc *UseCase) DeleteCategory(ctx context.Context, id string) error {
 
 // UpdateResourceTags 更新资源标签 并同步刷新 Sidecar
 func (uc *UseCase) UpdateResourceTags(ctx context.Context, id string, tags []string) error {
-	return uc.data.DB.Transaction(func(tx *gorm.DB) error {
+	var refresh *processJob
+	err := uc.data.DB.Transaction(func(tx *gorm.DB) error {
 		if err := tx.Model(&model.Resource{}).Where("id = ?", id).Select("Tags").Updates(model.Resource{Tags: tags}).Error; err != nil {
 			return err
 		}
 
-		// 触发异步刷新 Sidecar (获取最新版本)
+		// 刷新最新版本的 Sidecar
 		var v model.ResourceVersion
 		if err := tx.Order("version_num desc").First(&v, "resource_id = ?", id).Error; err == nil {
-			uc.dispatchJob(processJob{
+			refresh = &processJob{
 				Action:    ActionRefresh,
 				ObjectKey: v.FilePath,
 				VersionID: v.ID,
-			})
+			}
 		}
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+	// 事务提交后才触发异步刷新，Sidecar 读到的是已提交的标签，回滚时不会刷新
+	if refresh != nil {
+		uc.dispatchJob(*refresh)
+	}
+	return nil
 }
 
 // SyncFromStorage 从存储扫描并同步资源到数据库
@@ -675,6 +954,9 @@ func (uc *UseCase) SyncFromStorage(ctx context.Context) (int, error) {
 		if len(slashParts) < 4 {
 			continue // 路径格式不对
 		}
+		if len(slashParts) > 4 && slashParts[3] == renditionsDir {
+			continue // 派生文件随处理流程重新生成
+		}
 
 		typeKey := slashParts[1]
 		resourceID := slashParts[2]
@@ -710,20 +992,36 @@ func (uc *UseCase) SyncFromStorage(ctx context.Context) (int, error) {
 			FilePath:   object.Key,
 			State:      "PENDING",
 			MetaData:   map[string]any{"source": "storage_sync"},
+			ExtraMeta:  map[string]any{"source": "storage_sync"},
 		}
 
 		// --- 关键：通过 Sidecar 恢复元数据 ---
+		var footprint *BBox
 		sidecarKey := object.Key + ".meta.json"
 		if rc, err := uc.store.Get(ctx, bucketName, sidecarKey); err == nil {
 			var sd struct {
 				ResourceName string         `json:"resource_name"`
 				Tags         []string       `json:"tags"`
 				Metadata     map[string]any `json:"metadata"`
+				ExtraMeta    map[string]any `json:"extra_meta"`
+				Processor    string         `json:"processor"`
+				Footprint    []float64      `json:"footprint"`
 			}
 			if decodeErr := json.NewDecoder(rc).Decode(&sd); decodeErr == nil {
 				res.Name = sd.ResourceName
 				res.Tags = sd.Tags
-				ver.MetaData = sd.Metadata
+				if sd.Metadata != nil {
+					ver.MetaData = sd.Metadata
+				}
+				switch {
+				case sd.ExtraMeta != nil:
+					ver.ExtraMeta = sd.ExtraMeta
+				case sd.Metadata != nil:
+					// 早期的 Sidecar 没有单独记录用户元数据：留空，首次处理完成时由处理器未产出的键推断
+					ver.ExtraMeta = nil
+				}
+				ver.ProcessorVersion = sd.Processor
+				footprint, _ = bboxFromValue(sd.Footprint)
 			}
 			rc.Close()
 			// 更新主表（如果已创建）
@@ -734,14 +1032,19 @@ func (uc *UseCase) SyncFromStorage(ctx context.Context) (int, error) {
 			slog.Error("无法创建版本记录", "error", err)
 			continue
 		}
+		// 重新处理完成前即可按 Sidecar 中的地理范围检索
+		if footprint != nil {
+			if err := setFootprint(uc.data.DB, resourceID, footprint); err != nil {
+				slog.Error("无法恢复地理范围", "resource_id", resourceID, "error", err)
+			}
+		}
 
 		// 5. 触发异步处理器（重新提取元数据和分类）
-		uc.dispatchJob(processJob{
-			Action:    ActionProcess,
-			TypeKey:   typeKey,
-			ObjectKey: object.Key,
-			VersionID: ver.ID,
-		})
+		if err := uc.enqueueProcessJob(uc.data.DB, ver, typeKey, PriorityBulk); err != nil {
+			slog.Error("无法创建处理任务", "error", err)
+			continue
+		}
+		uc.kickOutbox()
 		syncedCount++
 	}
 
@@ -763,7 +1066,20 @@ func (uc *UseCase) DeleteResource(ctx context.Context, id string) error {
 		return err
 	}
 
-	// 3. 删除 MinIO 中的文件 (包括元数据 Sidecar)
+	// 3. 删除 MinIO 中的文件 (包括元数据 Sidecar 与派生文件)
+	versionIDs := make([]string, 0, len(versions))
+	for _, v := range versions {
+		versionIDs = append(versionIDs, v.ID)
+	}
+	var renditions []model.Rendition
+	if err := uc.data.DB.Find(&renditions, "version_id IN ?", versionIDs).Error; err != nil {
+		return err
+	}
+	for _, r := range renditions {
+		if err := uc.store.Delete(ctx, uc.minioConfig, r.ObjectKey); err != nil {
+			slog.Error("无法删除派生文件", "path", r.ObjectKey, "error", err)
+		}
+	}
 	for _, v := range versions {
 		// 删除主文件
 		if err := uc.store.Delete(ctx, uc.minioConfig, v.FilePath); err != nil {
@@ -780,10 +1096,18 @@ func (uc *UseCase) DeleteResource(ctx context.Context, id string) error {
 
 	// 4. 数据库级联删除
 	return uc.data.DB.Transaction(func(tx *gorm.DB) error {
+		// 删除派生文件记录
+		if err := tx.Delete(&model.Rendition{}, "version_id IN ?", versionIDs).Error; err != nil {
+			return err
+		}
 		// 删除所有版本记录
 		if err := tx.Delete(&model.ResourceVersion{}, "resource_id = ?", id).Error; err != nil {
 			return err
 		}
+		// 删除地理范围索引
+		if err := setFootprint(tx, id, nil); err != nil {
+			return err
+		}
 		// 删除资源主表记录
 		if err := tx.Delete(&model.Resource{}, "id = ?", id).Error; err != nil {
 			return err
@@ -794,13 +1118,60 @@ func (uc *UseCase) DeleteResource(ctx context.Context, id string) error {
 
 // ReportProcessResult 由外部 Worker 回调，上报资源处理结果
 func (uc *UseCase) ReportProcessResult(ctx context.Context, versionID string, req ProcessResultRequest) error {
-	return uc.data.DB.Transaction(func(tx *gorm.DB) error {
+	var typeKey string
+	var orphaned []string
+	var refresh *processJob
+	ignored := ""
+	err := uc.data.DB.Transaction(func(tx *gorm.DB) error {
+		if req.JobID != "" {
+			// 任务 ID 即幂等键 (Worker 以 Idempotency-Key 携带)：先结束任务，未能结束时说明任务已取消或结果已应用，
+			// 重复投递与已取消任务迟到的结果不再改写版本
+			finished, err := uc.finishJob(tx, req.JobID, req)
+			if err != nil {
+				return err
+			}
+			if !finished {
+				var record model.Job
+				if err := tx.Select("state").Where("id = ?", req.JobID).Limit(1).Find(&record).Error; err != nil {
+					return err
+				}
+				switch record.State {
+				case model.JobStateCanceled:
+					ignored = "任务已取消，忽略处理结果"
+					return nil
+				case model.JobStateSucceeded, model.JobStateFailed:
+					ignored = "任务结果已处理，忽略重复上报"
+					return nil
+				}
+			}
+		}
+
 		var ver model.ResourceVersion
 		if err := tx.First(&ver, "id = ?", versionID).Error; err != nil {
 			return err
 		}
+		if err := tx.Model(&model.Resource{}).Select("type_key").Where("id = ?", ver.ResourceID).Scan(&typeKey).Error; err != nil {
+			return err
+		}
 
 		// 合并元数据
+		if req.State == "ACTIVE" {
+			if ver.ExtraMeta == nil {
+				// 用户元数据未知 (引入 extra_meta 之前的版本或早期 Sidecar 同步的版本)：
+				// 现有元数据中本次处理器未产出的键视为用户提供，记录下来供之后的重处理使用
+				ver.ExtraMeta = make(map[string]any)
+				for k, v := range ver.MetaData {
+					if _, ok := req.MetaData[k]; !ok {
+						ver.ExtraMeta[k] = v
+					}
+				}
+			}
+			// 以用户提供的 ExtraMeta 为基底重建，处理器产出的键整体替换 (重处理时不残留旧键)
+			ver.MetaData = make(map[string]any, len(ver.ExtraMeta)+len(req.MetaData))
+			for k, v := range ver.ExtraMeta {
+				ver.MetaData[k] = v
+			}
+		}
 		if ver.MetaData == nil {
 			ver.MetaData = make(map[string]any)
 		}
@@ -809,20 +1180,60 @@ func (uc *UseCase) ReportProcessResult(ctx context.Context, versionID string, re
 		}
 
 		ver.State = req.State
+		ver.ErrorMessage = req.Message
+		if req.State == "ACTIVE" {
+			ver.ProcessorVersion = req.ProcessorVersion
+		}
 		if err := tx.Save(&ver).Error; err != nil {
 			return err
 		}
 
-		// 如果处理成功，触发 Sidecar 刷新
+		if req.State == "ACTIVE" {
+			var err error
+			if orphaned, err = replaceRenditions(tx, ver.ID, req.Renditions); err != nil {
+				return err
+			}
+			if err := updateFootprint(tx, ver); err != nil {
+				return err
+			}
+		}
+
+		// 如果处理成功，提交后刷新 Sidecar
 		if ver.State == "ACTIVE" {
-			uc.dispatchJob(processJob{
+			refresh = &processJob{
 				Action:    ActionRefresh,
 				ObjectKey: ver.FilePath,
 				VersionID: ver.ID,
-			})
+			}
 		}
 
 		slog.Info("接收到处理结果回调", "version_id", versionID, "state", ver.State)
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+	if ignored != "" || req.State != "ACTIVE" {
+		// 未被接受的结果携带的派生文件位于该任务独立的前缀下，不影响当前记录；重复投递的文件已被记录，保留
+		stale, err := unreferencedRenditions(uc.data.DB, req.Renditions)
+		if err != nil {
+			slog.Warn("无法确认未接受结果的派生文件", "version_id", versionID, "error", err)
+		}
+		uc.deleteRenditionObjects(ctx, stale)
+	}
+	if ignored != "" {
+		slog.Info(ignored, "version_id", versionID, "job_id", req.JobID)
+		return nil
+	}
+
+	// 新的记录已提交，清理被取代的派生文件；Sidecar 刷新同样在提交后触发，读取的是已提交的结果
+	uc.deleteRenditionObjects(ctx, orphaned)
+	if refresh != nil {
+		uc.dispatchJob(*refresh)
+	}
+
+	if req.State == "ACTIVE" && req.ProcessorVersion != "" {
+		uc.observeProcessorVersion(ctx, typeKey, req.ProcessorVersion)
+	}
+	return nil
 }
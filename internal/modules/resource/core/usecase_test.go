@@ -1,10 +1,28 @@
 package core
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/liny/sim-hub/internal/conf"
 	"github.com/liny/sim-hub/internal/data"
+	"github.com/liny/sim-hub/internal/model"
 	"github.com/liny/sim-hub/internal/modules/resource/core/mocks"
 	"github.com/liny/sim-hub/pkg/storage"
 	"github.com/stretchr/testify/assert"
@@ -25,7 +43,7 @@ func setupTestUseCase() (*UseCase, *mocks.MockBlobStore, *mocks.MockSTSProvider,
 	mockStore := new(mocks.MockBlobStore)
 	mockSTS := new(mocks.MockSTSProvider)
 
-	uc := NewUseCase(d, mockStore, mockSTS, "test-bucket", nil, "combined", "http://localhost:30030", nil)
+	uc := NewUseCase(d, mockStore, mockSTS, "test-bucket", nil, "combined", conf.Worker{ApiBaseURL: "http://localhost:30030"})
 	return uc, mockStore, mockSTS, db
 }
 
@@ -76,3 +94,1243 @@ func TestRequestUploadToken(t *testing.T) {
 		mockSTS.AssertExpectations(t)
 	})
 }
+
+// setupDBUseCase 创建带有已迁移内存数据库的 API 模式 UseCase，任务停留在本地队列中便于断言
+func setupDBUseCase(t *testing.T) (*UseCase, *mocks.MockBlobStore, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1) // 内存库每个连接相互独立，限制为单连接
+	assert.NoError(t, db.AutoMigrate(&model.ResourceType{}, &model.Category{}, &model.Resource{}, &model.ResourceVersion{}, &model.Job{}, &model.Rendition{}, &model.Worker{}, &model.OutboxEntry{}, &model.ResourceFootprint{}, &model.ResourceFootprintCell{}))
+
+	mockStore := new(mocks.MockBlobStore)
+	// Sidecar 刷新在后台执行，测试不关心其结果
+	mockStore.On("Put", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+
+	uc := NewUseCase(&data.Data{DB: db}, mockStore, nil, "test-bucket", nil, "api", conf.Worker{})
+	// 以 combined 角色的本地队列承接任务，但不启动执行器，由测试逐个取出
+	uc.role = "combined"
+	go uc.startOutboxRelay()
+	return uc, mockStore, db
+}
+
+// nextJob 取出本地队列中的下一个任务 (经发件箱转发)，异步派发的任务最多等待 2 秒
+func nextJob(t *testing.T, uc *UseCase) processJob {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		uc.kickOutbox()
+		if job, ok := uc.queue.TryPop(func(string) bool { return true }); ok {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected a queued job")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReprocessPreservesExtraMeta(t *testing.T) {
+	// 上传时未提供 extra_meta 的版本同样整体替换处理器产出的键
+	for name, extra := range map[string]map[string]any{"with extra_meta": {"author": "alice"}, "without extra_meta": nil} {
+		t.Run(name, func(t *testing.T) {
+			uc, _, db := setupDBUseCase(t)
+			ctx := context.Background()
+
+			err := db.Transaction(func(tx *gorm.DB) error {
+				return uc.createResourceAndVersion(tx, "scenario", "", "demo", "u1", "resources/scenario/x/demo.zip", 10, nil, extra)
+			})
+			assert.NoError(t, err)
+			job := nextJob(t, uc)
+
+			assert.NoError(t, uc.ReportProcessResult(ctx, job.VersionID, ProcessResultRequest{
+				State:    "ACTIVE",
+				JobID:    job.JobID,
+				MetaData: map[string]any{"files_count": 3, "legacy_key": true},
+			}))
+
+			var ver model.ResourceVersion
+			assert.NoError(t, db.First(&ver, "id = ?", job.VersionID).Error)
+			assert.NoError(t, uc.ReprocessVersion(ctx, ver.ResourceID, 1))
+
+			reprocessJob := nextJob(t, uc)
+			assert.Equal(t, ActionProcess, reprocessJob.Action)
+			assert.Equal(t, "scenario", reprocessJob.TypeKey)
+
+			assert.NoError(t, uc.ReportProcessResult(ctx, reprocessJob.VersionID, ProcessResultRequest{
+				State:    "ACTIVE",
+				JobID:    reprocessJob.JobID,
+				MetaData: map[string]any{"files_count": 4},
+			}))
+
+			assert.NoError(t, db.First(&ver, "id = ?", job.VersionID).Error)
+			for k, v := range extra {
+				assert.Equal(t, v, ver.MetaData[k])
+			}
+			assert.EqualValues(t, 4, ver.MetaData["files_count"])
+			assert.NotContains(t, ver.MetaData, "legacy_key")
+		})
+	}
+}
+
+func TestSyncLegacySidecarKeepsUserMeta(t *testing.T) {
+	uc, mockStore, db := setupDBUseCase(t)
+	ctx := context.Background()
+
+	// 早期的 Sidecar 只有合并后的 metadata，没有 extra_meta
+	objects := make(chan storage.ObjectInfo, 1)
+	objects <- storage.ObjectInfo{Key: "resources/scenario/r1/demo.zip", Size: 10}
+	close(objects)
+	mockStore.On("ListObjects", mock.Anything, mock.Anything, "resources/", true).Return((<-chan storage.ObjectInfo)(objects))
+	mockStore.On("Get", mock.Anything, mock.Anything, "resources/scenario/r1/demo.zip.meta.json").
+		Return(io.NopCloser(strings.NewReader(`{"resource_name":"legacy","metadata":{"author":"alice","files_count":3}}`)), nil)
+	n, err := uc.SyncFromStorage(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	job := nextJob(t, uc)
+	var ver model.ResourceVersion
+	assert.NoError(t, db.First(&ver, "id = ?", job.VersionID).Error)
+	assert.Equal(t, "alice", ver.MetaData["author"])
+	assert.Nil(t, ver.ExtraMeta)
+
+	// 处理器未产出的键作为用户元数据保留，重处理后仍然存在
+	for i, count := range []int{4, 5} {
+		if i > 0 {
+			assert.NoError(t, uc.ReprocessVersion(ctx, "r1", 1))
+			job = nextJob(t, uc)
+		}
+		assert.NoError(t, uc.ReportProcessResult(ctx, job.VersionID, ProcessResultRequest{
+			State:    "ACTIVE",
+			JobID:    job.JobID,
+			MetaData: map[string]any{"files_count": count},
+		}))
+		ver = model.ResourceVersion{}
+		assert.NoError(t, db.First(&ver, "id = ?", job.VersionID).Error)
+		assert.Equal(t, map[string]any{"author": "alice"}, ver.ExtraMeta)
+		assert.Equal(t, "alice", ver.MetaData["author"])
+		assert.EqualValues(t, count, ver.MetaData["files_count"])
+	}
+}
+
+func TestSidecarRefreshAfterCommit(t *testing.T) {
+	uc, mockStore, db := setupDBUseCase(t)
+	ctx := context.Background()
+
+	sidecars := make(chan map[string]any, 4)
+	mockStore.ExpectedCalls = nil
+	mockStore.On("Put", mock.Anything, mock.Anything, "resources/scenario/r1/demo.zip.meta.json", mock.Anything, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			var sd map[string]any
+			assert.NoError(t, json.NewDecoder(args.Get(3).(io.Reader)).Decode(&sd))
+			sidecars <- sd
+		}).Return(nil)
+
+	res := model.Resource{ID: "r1", TypeKey: "scenario", Name: "demo"}
+	assert.NoError(t, db.Create(&res).Error)
+	ver := model.ResourceVersion{ResourceID: res.ID, VersionNum: 1, FilePath: "resources/scenario/r1/demo.zip", State: "PENDING"}
+	assert.NoError(t, db.Create(&ver).Error)
+
+	// 标签更新提交后才刷新，Sidecar 中是已提交的标签
+	assert.NoError(t, uc.UpdateResourceTags(ctx, res.ID, []string{"a", "b"}))
+	select {
+	case sd := <-sidecars:
+		assert.Equal(t, []any{"a", "b"}, sd["tags"])
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a sidecar refresh")
+	}
+
+	// 结果写库失败回滚时不刷新 Sidecar
+	assert.ErrorIs(t, uc.ReportProcessResult(ctx, "missing", ProcessResultRequest{State: "ACTIVE"}), gorm.ErrRecordNotFound)
+	assert.NoError(t, uc.ReportProcessResult(ctx, ver.ID, ProcessResultRequest{State: "ACTIVE", MetaData: map[string]any{"files_count": 1}}))
+	select {
+	case sd := <-sidecars:
+		assert.EqualValues(t, 1, sd["metadata"].(map[string]any)["files_count"])
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a sidecar refresh")
+	}
+	assert.Empty(t, sidecars)
+}
+
+func TestReprocessResourceTypeLatestOnly(t *testing.T) {
+	uc, _, db := setupDBUseCase(t)
+
+	res := model.Resource{TypeKey: "scenario", Name: "demo"}
+	assert.NoError(t, db.Create(&res).Error)
+	for i := 1; i <= 2; i++ {
+		assert.NoError(t, db.Create(&model.ResourceVersion{ResourceID: res.ID, VersionNum: i, FilePath: "p", State: "ACTIVE"}).Error)
+	}
+
+	resp, err := uc.ReprocessResourceType(context.Background(), "scenario", ReprocessFilter{Rate: 1000})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, resp.Matched)
+
+	// 最新版本的任务尚未结束，批量重处理跳过该版本
+	assert.Eventually(t, func() bool {
+		var n int64
+		db.Model(&model.Job{}).Where("state = ?", model.JobStateQueued).Count(&n)
+		return n == 1
+	}, 2*time.Second, 10*time.Millisecond)
+	resp, err = uc.ReprocessResourceType(context.Background(), "scenario", ReprocessFilter{AllVersions: true, Rate: 1000})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, resp.Matched)
+
+	for _, rate := range []int{-1, maxReprocessRate + 1, 2e9} {
+		_, err = uc.ReprocessResourceType(context.Background(), "scenario", ReprocessFilter{Rate: rate})
+		assert.ErrorIs(t, err, ErrInvalidRate)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	assert.Equal(t, 0, compareVersions("1.2.0", "v1.2.0"))
+	assert.Equal(t, -1, compareVersions("1.2.0", "1.10.0"))
+	assert.Equal(t, 1, compareVersions("2.0", "1.9.9"))
+	assert.Equal(t, 1, compareVersions("1.0.1", "1.0"))
+}
+
+func TestReprocessRereadsVersion(t *testing.T) {
+	uc, _, db := setupDBUseCase(t)
+	ctx := context.Background()
+
+	assert.NoError(t, db.Transaction(func(tx *gorm.DB) error {
+		return uc.createResourceAndVersion(tx, "scenario", "", "demo", "u1", "resources/scenario/x/demo.zip", 10, nil, nil)
+	}))
+	job := nextJob(t, uc)
+	assert.NoError(t, uc.ReportProcessResult(ctx, job.VersionID, ProcessResultRequest{State: "ACTIVE", JobID: job.JobID, MetaData: map[string]any{"files_count": 3}}))
+
+	// 批量重处理筛选出的快照在派发前已过时：任务的原状态与元数据取自派发时的记录
+	var snapshot model.ResourceVersion
+	assert.NoError(t, db.First(&snapshot, "id = ?", job.VersionID).Error)
+	current := snapshot
+	current.State = "ERROR"
+	current.MetaData = map[string]any{"files_count": 5}
+	assert.NoError(t, db.Save(&current).Error)
+
+	uc.dispatchThrottled("scenario", []model.ResourceVersion{snapshot}, maxReprocessRate, PriorityBulk)
+	reprocessed := nextJob(t, uc)
+	assert.EqualValues(t, 5, reprocessed.MetaData["files_count"])
+	var record model.Job
+	assert.NoError(t, db.First(&record, "id = ?", reprocessed.JobID).Error)
+	assert.Equal(t, "ERROR", record.PrevState)
+}
+
+func TestProcessorVersionTracking(t *testing.T) {
+	uc, _, db := setupDBUseCase(t)
+	ctx := context.Background()
+
+	assert.NoError(t, db.Create(&model.ResourceType{TypeKey: "scenario", TypeName: "想定", ProcessConf: map[string]any{"auto_reprocess": true}}).Error)
+	res := model.Resource{TypeKey: "scenario", Name: "demo"}
+	assert.NoError(t, db.Create(&res).Error)
+	v1 := model.ResourceVersion{ResourceID: res.ID, VersionNum: 1, FilePath: "a"}
+	v2 := model.ResourceVersion{ResourceID: res.ID, VersionNum: 2, FilePath: "b"}
+	assert.NoError(t, db.Create(&v1).Error)
+	assert.NoError(t, db.Create(&v2).Error)
+	// 处理失败的版本不计为过期，也不会被自动重处理
+	failed := model.ResourceVersion{ResourceID: res.ID, VersionNum: 3, FilePath: "c", State: "ERROR", ProcessorVersion: "1.0.0"}
+	assert.NoError(t, db.Create(&failed).Error)
+
+	assert.NoError(t, uc.ReportProcessResult(ctx, v1.ID, ProcessResultRequest{State: "ACTIVE", ProcessorVersion: "1.0.0"}))
+	assert.NoError(t, uc.ReportProcessResult(ctx, v2.ID, ProcessResultRequest{State: "ACTIVE", ProcessorVersion: "1.1.0"}))
+
+	report, err := uc.GetProcessorReport(ctx, "scenario")
+	assert.NoError(t, err)
+	assert.Equal(t, "1.1.0", report.CurrentVersion)
+	assert.EqualValues(t, 1, report.StaleTotal)
+	assert.Equal(t, 1, report.Stale[0].VersionNum)
+
+	// 观测到新版本后自动派发 v1 的重处理 (以默认速率异步派发)
+	job := nextJob(t, uc)
+	assert.Equal(t, v1.ID, job.VersionID)
+	assert.Equal(t, PriorityMaintenance, job.Priority)
+	assert.EqualValues(t, 2, report.VersionCounts["1.0.0"])
+	var jobs int64
+	db.Model(&model.Job{}).Where("version_id = ?", failed.ID).Count(&jobs)
+	assert.Zero(t, jobs)
+}
+
+func TestProcessorVersionRollback(t *testing.T) {
+	uc, _, db := setupDBUseCase(t)
+	ctx := context.Background()
+
+	assert.NoError(t, db.Create(&model.ResourceType{TypeKey: "scenario", TypeName: "想定", ProcessConf: map[string]any{"auto_reprocess": true}}).Error)
+	res := model.Resource{TypeKey: "scenario", Name: "demo"}
+	assert.NoError(t, db.Create(&res).Error)
+	report := func(num int, version string) model.ResourceVersion {
+		ver := model.ResourceVersion{ResourceID: res.ID, VersionNum: num, FilePath: fmt.Sprintf("v%d", num)}
+		assert.NoError(t, db.Create(&ver).Error)
+		assert.NoError(t, uc.ReportProcessResult(ctx, ver.ID, ProcessResultRequest{State: "ACTIVE", ProcessorVersion: version}))
+		return ver
+	}
+	v1 := report(1, "2.0.0")
+
+	// 处理器从 2.0.0 回滚到 1.0.0：类型版本跟随回滚，回滚后产出的结果不计为过期，回滚也不触发自动重处理
+	v2 := report(2, "1.0.0")
+	r, err := uc.GetProcessorReport(ctx, "scenario")
+	assert.NoError(t, err)
+	assert.Equal(t, "1.0.0", r.CurrentVersion)
+	assert.EqualValues(t, 1, r.StaleTotal)
+	assert.Equal(t, 1, r.Stale[0].VersionNum)
+	time.Sleep(300 * time.Millisecond) // 超过默认速率下首个任务的派发间隔
+	var jobs int64
+	db.Model(&model.Job{}).Count(&jobs)
+	assert.Zero(t, jobs)
+
+	// 再次升级后照常重处理过期版本
+	report(3, "2.1.0")
+	reprocessed := []string{nextJob(t, uc).VersionID, nextJob(t, uc).VersionID}
+	assert.ElementsMatch(t, []string{v1.ID, v2.ID}, reprocessed)
+}
+
+func TestLongPipelineVersion(t *testing.T) {
+	uc, _, db := setupDBUseCase(t)
+	ctx := context.Background()
+
+	// 组合版本长度不定，两列均不限制长度
+	for _, table := range []any{&model.ResourceType{}, &model.ResourceVersion{}} {
+		columns, err := db.Migrator().ColumnTypes(table)
+		assert.NoError(t, err)
+		for _, c := range columns {
+			if c.Name() == "processor_version" {
+				assert.Equal(t, "text", strings.ToLower(c.DatabaseTypeName()))
+			}
+		}
+	}
+
+	var pipeline []any
+	versions := make(map[string]string)
+	for i := range 8 {
+		name := fmt.Sprintf("stage_with_a_long_name_%d", i)
+		pipeline = append(pipeline, name)
+		versions[name] = fmt.Sprintf("%d.0.0-build.20261018+commit.0123456789abcdef", i)
+	}
+	stages := parsePipeline(map[string]any{"pipeline": pipeline})
+	version := pipelineVersion(stages, versions)
+	assert.Greater(t, len(version), 255)
+
+	assert.NoError(t, db.Create(&model.ResourceType{TypeKey: "scenario", TypeName: "想定", ProcessConf: map[string]any{"pipeline": pipeline}}).Error)
+	res := model.Resource{TypeKey: "scenario", Name: "demo"}
+	assert.NoError(t, db.Create(&res).Error)
+	ver := model.ResourceVersion{ResourceID: res.ID, VersionNum: 1, FilePath: "v1"}
+	assert.NoError(t, db.Create(&ver).Error)
+	assert.NoError(t, uc.ReportProcessResult(ctx, ver.ID, ProcessResultRequest{State: "ACTIVE", ProcessorVersion: version}))
+
+	assert.NoError(t, db.First(&ver, "id = ?", ver.ID).Error)
+	assert.Equal(t, version, ver.ProcessorVersion)
+	var rt model.ResourceType
+	assert.NoError(t, db.First(&rt, "type_key = ?", "scenario").Error)
+	assert.Equal(t, version, rt.ProcessorVersion)
+}
+
+func TestStaleOnlyReprocess(t *testing.T) {
+	uc, _, db := setupDBUseCase(t)
+	ctx := context.Background()
+	filter := ReprocessFilter{State: "ACTIVE", StaleOnly: true, AllVersions: true, Rate: 1000}
+
+	rt := model.ResourceType{TypeKey: "scenario", TypeName: "想定"}
+	assert.NoError(t, db.Create(&rt).Error)
+	res := model.Resource{TypeKey: "scenario", Name: "demo"}
+	assert.NoError(t, db.Create(&res).Error)
+	for i, pv := range []string{"1.0.0", "", "", "1.1.0"} {
+		ver := model.ResourceVersion{ResourceID: res.ID, VersionNum: i + 1, FilePath: fmt.Sprintf("v%d", i+1), State: "ACTIVE", ProcessorVersion: pv}
+		assert.NoError(t, db.Create(&ver).Error)
+		if i == 2 {
+			assert.NoError(t, db.Model(&ver).UpdateColumn("processor_version", gorm.Expr("NULL")).Error)
+		}
+	}
+
+	// 尚未检测到处理器版本时无法判断过期，明确报错
+	_, err := uc.ReprocessResourceType(ctx, "scenario", filter)
+	assert.ErrorIs(t, err, ErrNoProcessorVersion)
+
+	// 没有记录处理器版本 (NULL 或空) 的版本同样视为过期
+	assert.NoError(t, db.Model(&rt).Update("processor_version", "1.1.0").Error)
+	report, err := uc.GetProcessorReport(ctx, "scenario")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, report.StaleTotal)
+	resp, err := uc.ReprocessResourceType(ctx, "scenario", filter)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, resp.Matched)
+}
+
+func TestPipelineVersionTracking(t *testing.T) {
+	uc, _, db := setupDBUseCase(t)
+	ctx := context.Background()
+
+	pipeline := []any{"scenario", "manifest", map[string]any{"name": "thumbnail", "optional": true}}
+	assert.NoError(t, db.Create(&model.ResourceType{TypeKey: "scenario", TypeName: "想定", ProcessConf: map[string]any{"pipeline": pipeline}}).Error)
+	res := model.Resource{TypeKey: "scenario", Name: "demo"}
+	assert.NoError(t, db.Create(&res).Error)
+	current := func() string {
+		var rt model.ResourceType
+		assert.NoError(t, db.First(&rt, "type_key = ?", "scenario").Error)
+		return rt.ProcessorVersion
+	}
+	for i, v := range []struct{ reported, want string }{
+		{"scenario@1.0.0,manifest@1.0.0", "scenario@1.0.0,manifest@1.0.0"},
+		// 配置变更前排队的任务不改变类型版本
+		{"scenario@2.0.0", "scenario@1.0.0,manifest@1.0.0"},
+		// 阶段各有新旧、整体回滚的结果同样记录为类型版本
+		{"scenario@1.2.0,manifest@0.9.0", "scenario@1.2.0,manifest@0.9.0"},
+		{"scenario@0.9.0,manifest@1.0.0", "scenario@0.9.0,manifest@1.0.0"},
+		{"scenario@1.0.0,manifest@1.1.0", "scenario@1.0.0,manifest@1.1.0"},
+	} {
+		ver := model.ResourceVersion{ResourceID: res.ID, VersionNum: i + 1, FilePath: fmt.Sprintf("v%d", i+1)}
+		assert.NoError(t, db.Create(&ver).Error)
+		assert.NoError(t, uc.ReportProcessResult(ctx, ver.ID, ProcessResultRequest{State: "ACTIVE", ProcessorVersion: v.reported}))
+		assert.Equal(t, v.want, current(), "reported %s", v.reported)
+	}
+
+	// 流水线配置变更后，首个符合新配置的结果直接成为类型版本
+	var rt model.ResourceType
+	assert.NoError(t, db.First(&rt, "type_key = ?", "scenario").Error)
+	rt.ProcessConf = map[string]any{"pipeline": []any{"scenario", map[string]any{"name": "manifest", "optional": true}}}
+	assert.NoError(t, db.Save(&rt).Error)
+	ver := model.ResourceVersion{ResourceID: res.ID, VersionNum: 9, FilePath: "v9"}
+	assert.NoError(t, db.Create(&ver).Error)
+	assert.NoError(t, uc.ReportProcessResult(ctx, ver.ID, ProcessResultRequest{State: "ACTIVE", ProcessorVersion: "scenario@1.0.0"}))
+	assert.Equal(t, "scenario@1.0.0", current())
+}
+
+func TestJobRouting(t *testing.T) {
+	assert.Equal(t, "simhub.jobs.map_terrain.bulk", jobSubject("simhub.jobs", "map_terrain", PriorityBulk))
+	assert.Equal(t, "simhub.jobs.a_b_c.interactive", jobSubject("simhub.jobs", "a.b*c", ""))
+
+	uc, mockStore, db := setupDBUseCase(t)
+	ctx := context.Background()
+	uc.handlers = map[string]string{"map_terrain": ""}
+	uc.extraTypes = []string{"scenario_bundle"}
+	assert.Equal(t, []string{"map_terrain", "scenario_bundle"}, uc.acceptedTypes())
+
+	assert.NoError(t, db.Transaction(func(tx *gorm.DB) error {
+		return uc.createResourceAndVersion(tx, "scenario", "", "demo", "u1", "resources/scenario/x/demo.zip", 10, nil, nil)
+	}))
+	job := nextJob(t, uc)
+
+	// 无法处理该类型的 Worker 不接收任务，重新发布给其他 Worker (本地队列模拟每次都投递回同一个 Worker)，
+	// 转交次数达到上限后任务与版本置为失败并记录原因，而不是无限重新投递
+	unhandled := job
+	uc.onNATSJob(&unhandled)
+	var record model.Job
+	assert.NoError(t, db.First(&record, "id = ?", job.JobID).Error)
+	assert.Equal(t, model.JobStateQueued, record.State)
+	var ver model.ResourceVersion
+	assert.NoError(t, db.First(&ver, "id = ?", job.VersionID).Error)
+	assert.Equal(t, "PENDING", ver.State)
+	hops := 1
+	for {
+		next, ok := uc.queue.TryPop(func(string) bool { return true })
+		if !ok {
+			break
+		}
+		assert.Equal(t, hops, next.Rejections)
+		uc.onNATSJob(&next)
+		hops++
+	}
+	assert.Equal(t, jobMaxRejections, hops)
+	assert.NoError(t, db.First(&record, "id = ?", job.JobID).Error)
+	assert.Equal(t, model.JobStateFailed, record.State)
+	assert.Equal(t, "no handler configured for type scenario", record.Message)
+	assert.NoError(t, db.First(&ver, "id = ?", job.VersionID).Error)
+	assert.Equal(t, "ERROR", ver.State)
+	assert.Equal(t, "no handler configured for type scenario", ver.ErrorMessage)
+
+	// 恢复为排队状态，继续验证重新投递
+	assert.NoError(t, db.Model(&model.Job{}).Where("id = ?", job.JobID).Updates(map[string]any{"state": model.JobStateQueued, "message": ""}).Error)
+	assert.NoError(t, db.Model(&model.ResourceVersion{}).Where("id = ?", job.VersionID).Updates(map[string]any{"state": "PENDING", "error_message": ""}).Error)
+
+	// 消息仍在发件箱中等待发布 (如 NATS 不可用) 的任务不重复写入
+	pending := model.OutboxEntry{JobID: job.JobID, Payload: "{}", AvailableAt: time.Now().Add(time.Hour)}
+	assert.NoError(t, db.Create(&pending).Error)
+	n, err := uc.redispatchQueuedJobs(time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+	assert.NoError(t, db.Delete(&pending).Error)
+
+	// 超时未被领取的任务经发件箱重新投递，刚投递过的不会重复投递
+	n, err = uc.redispatchQueuedJobs(time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, job.JobID, nextJob(t, uc).JobID)
+	n, err = uc.redispatchQueuedJobs(time.Now().Add(-time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	// Worker 已接收、在本地队列等待的任务由心跳刷新，不会被重新投递
+	assert.NoError(t, db.Model(&model.Job{}).Where("id = ?", job.JobID).UpdateColumn("updated_at", time.Now().Add(-time.Hour)).Error)
+	assert.NoError(t, uc.RecordHeartbeat(ctx, WorkerHeartbeat{WorkerID: "w1", State: model.WorkerStateOnline, QueuedJobs: []string{job.JobID}}))
+	n, err = uc.redispatchQueuedJobs(time.Now().Add(-time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	// 执行时发现无法处理的任务同样转交，没有 Worker 能处理时任务与版本置为失败
+	job.Rejections = jobMaxRejections - 1
+	uc.processResourceInternal(ctx, job)
+	assert.NoError(t, db.First(&record, "id = ?", job.JobID).Error)
+	assert.Equal(t, model.JobStateFailed, record.State)
+	assert.NoError(t, db.First(&ver, "id = ?", job.VersionID).Error)
+	assert.Equal(t, "ERROR", ver.State)
+	assert.Equal(t, "no handler configured for type scenario", ver.ErrorMessage)
+
+	// 流水线缺少必需阶段的处理器：不下载输入、不执行任何阶段，与不可处理的类型一样转交其他 Worker，
+	// 没有 Worker 能处理时任务置为失败并记录原因
+	uc.handlers["hash"] = writeScript(t, `echo '{"status":"success"}'`)
+	assert.NoError(t, db.Transaction(func(tx *gorm.DB) error {
+		return uc.createResourceAndVersion(tx, "map_terrain", "", "dem", "u1", "resources/map_terrain/x/dem.tif", 10, nil, nil)
+	}))
+	job = nextJob(t, uc)
+	job.ProcessConf = map[string]any{"pipeline": []any{"hash", "gdal_retile", map[string]any{"name": "thumbnail", "optional": true}}}
+	uc.processResourceInternal(ctx, job)
+	var pipelineJob model.Job
+	assert.NoError(t, db.First(&pipelineJob, "id = ?", job.JobID).Error)
+	assert.Equal(t, model.JobStateQueued, pipelineJob.State)
+	for {
+		next, ok := uc.queue.TryPop(func(string) bool { return true })
+		if !ok {
+			break
+		}
+		uc.processResourceInternal(ctx, next)
+	}
+	assert.NoError(t, db.First(&pipelineJob, "id = ?", job.JobID).Error)
+	assert.Equal(t, model.JobStateFailed, pipelineJob.State)
+	assert.Equal(t, "no handler configured for required stages: gdal_retile", pipelineJob.Message)
+	mockStore.AssertNotCalled(t, "Get", mock.Anything, mock.Anything, "resources/map_terrain/x/dem.tif")
+}
+
+func TestWorkerRegistry(t *testing.T) {
+	uc, _, db := setupDBUseCase(t)
+	ctx := context.Background()
+	uc.handlers = map[string]string{"scenario": "./proc"}
+	uc.limiter = newJobLimiter(2, nil)
+	uc.stats = newWorkerStats()
+
+	uc.stats.jobStarted("job-1")
+	uc.stats.jobStarted("job-2")
+	uc.stats.jobStopped("job-2")
+	uc.stats.jobFinished(true)
+	uc.stats.jobFinished(false)
+	hb := uc.stats.heartbeat(uc, model.WorkerStateOnline)
+	assert.NoError(t, uc.RecordHeartbeat(ctx, hb))
+
+	hb.Succeeded = 5
+	assert.NoError(t, uc.RecordHeartbeat(ctx, hb))
+
+	workers, err := uc.ListWorkers(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, workers, 1)
+	assert.Equal(t, model.WorkerStateOnline, workers[0].State)
+	assert.Equal(t, []string{"scenario"}, workers[0].Types)
+	assert.Equal(t, []string{"job-1"}, workers[0].RunningJobs)
+	assert.EqualValues(t, 5, workers[0].Succeeded)
+	assert.EqualValues(t, 1, workers[0].Failed)
+	assert.InDelta(t, 0.4, workers[0].ThroughputPerMin, 0.001)
+
+	// 错过心跳标记为 DEAD，长期失联的记录被清理
+	assert.NoError(t, db.Model(&model.Worker{}).Where("id = ?", hb.WorkerID).Update("last_seen_at", time.Now().Add(-time.Minute)).Error)
+	workers, _ = uc.ListWorkers(ctx)
+	assert.Equal(t, model.WorkerStateDead, workers[0].State)
+	n, err := uc.reapWorkers(time.Now())
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+	var w model.Worker
+	assert.NoError(t, db.First(&w, "id = ?", hb.WorkerID).Error)
+	assert.Equal(t, model.WorkerStateDead, w.State)
+
+	assert.NoError(t, db.Model(&model.Worker{}).Where("id = ?", hb.WorkerID).Update("last_seen_at", time.Now().Add(-25*time.Hour)).Error)
+	_, err = uc.reapWorkers(time.Now())
+	assert.NoError(t, err)
+	workers, _ = uc.ListWorkers(ctx)
+	assert.Empty(t, workers)
+
+	// 运行中任务随心跳刷新；Worker 失联后超时未刷新的任务重新排队并再次投递
+	assert.NoError(t, db.Transaction(func(tx *gorm.DB) error {
+		return uc.createResourceAndVersion(tx, "scenario", "", "demo", "u1", "resources/scenario/x/demo.zip", 10, nil, nil)
+	}))
+	job := nextJob(t, uc)
+	assert.NoError(t, uc.UpdateJobProgress(ctx, job.JobID, JobProgressRequest{Percent: 40}))
+	stale := func() {
+		assert.NoError(t, db.Model(&model.Job{}).Where("id = ?", job.JobID).UpdateColumn("updated_at", time.Now().Add(-time.Hour)).Error)
+	}
+	stale()
+	assert.NoError(t, uc.RecordHeartbeat(ctx, WorkerHeartbeat{WorkerID: "w2", State: model.WorkerStateOnline, RunningJobs: []string{job.JobID}}))
+	n, err = uc.reapWorkers(time.Now())
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+
+	stale()
+	n, err = uc.reapWorkers(time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	var record model.Job
+	assert.NoError(t, db.First(&record, "id = ?", job.JobID).Error)
+	assert.Equal(t, model.JobStateQueued, record.State)
+	assert.Zero(t, record.Progress)
+	assert.Nil(t, record.StartedAt)
+	assert.Equal(t, job.JobID, nextJob(t, uc).JobID)
+	var ver model.ResourceVersion
+	assert.NoError(t, db.First(&ver, "id = ?", job.VersionID).Error)
+	assert.Equal(t, "PENDING", ver.State)
+}
+
+func TestJobLimiter(t *testing.T) {
+	l := newJobLimiter(2, map[string]int{"map_terrain": 1})
+
+	assert.True(t, l.TryAcquire("map_terrain"))
+	assert.True(t, l.Saturated("map_terrain"))
+	assert.False(t, l.Saturated("scenario"))
+	assert.False(t, l.TryAcquire("map_terrain"), "per-type limit reached")
+
+	assert.True(t, l.TryAcquire("scenario"))
+	assert.True(t, l.Saturated("scenario"), "global limit reached")
+	assert.False(t, l.TryAcquire("scenario"))
+
+	l.Release("scenario")
+	assert.False(t, l.TryAcquire("map_terrain"), "per-type limit should still block map_terrain")
+	l.Release("map_terrain")
+	assert.True(t, l.TryAcquire("map_terrain"))
+}
+
+func TestJobQueuePriority(t *testing.T) {
+	q := newJobQueue()
+	q.Push(processJob{JobID: "m1", TypeKey: "scenario", Priority: PriorityMaintenance})
+	q.Push(processJob{JobID: "b1", TypeKey: "scenario", Priority: PriorityBulk})
+	q.Push(processJob{JobID: "b2", TypeKey: "map_terrain", Priority: PriorityBulk})
+	q.Push(processJob{JobID: "i1", TypeKey: "map_terrain", Priority: PriorityInteractive})
+	q.Push(processJob{JobID: "legacy", TypeKey: "scenario"})
+
+	l := newJobLimiter(10, map[string]int{"map_terrain": 1})
+	var order []string
+	for {
+		job, ok := q.TryPop(l.TryAcquire)
+		if !ok {
+			break
+		}
+		order = append(order, job.JobID)
+	}
+	// map_terrain 槽位被 i1 占用后，b2 留在队列中，不阻塞其后其他类型的任务
+	assert.Equal(t, []string{"i1", "legacy", "b1", "m1"}, order)
+	assert.Equal(t, 1, q.Pending("map_terrain"))
+
+	l.Release("map_terrain")
+	job, ok := q.TryPop(l.TryAcquire)
+	assert.True(t, ok)
+	assert.Equal(t, "b2", job.JobID)
+}
+
+func TestCancelJob(t *testing.T) {
+	uc, _, db := setupDBUseCase(t)
+	ctx := context.Background()
+
+	// 排队中的任务：从本地队列移除，版本置为 ERROR
+	assert.NoError(t, db.Transaction(func(tx *gorm.DB) error {
+		return uc.createResourceAndVersion(tx, "scenario", "", "demo", "u1", "resources/scenario/x/demo.zip", 10, nil, nil)
+	}))
+	record, err := uc.CancelJob(ctx, nextQueuedJobID(t, db))
+	assert.NoError(t, err)
+	assert.Equal(t, model.JobStateCanceled, record.State)
+	assert.Equal(t, 0, uc.queue.Pending("scenario"))
+	var ver model.ResourceVersion
+	assert.NoError(t, db.First(&ver, "id = ?", record.VersionID).Error)
+	assert.Equal(t, "ERROR", ver.State)
+
+	_, err = uc.CancelJob(ctx, record.ID)
+	assert.ErrorIs(t, err, ErrJobFinished)
+	_, err = uc.CancelJob(ctx, "missing")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	// 迟到的处理结果不改写已取消的任务与版本
+	assert.NoError(t, uc.ReportProcessResult(ctx, record.VersionID, ProcessResultRequest{State: "ACTIVE", JobID: record.ID}))
+	assert.NoError(t, db.First(&ver, "id = ?", record.VersionID).Error)
+	assert.Equal(t, "ERROR", ver.State)
+
+	// 取消重处理：版本恢复为 ACTIVE，原有元数据保留
+	assert.NoError(t, db.Transaction(func(tx *gorm.DB) error {
+		return uc.createResourceAndVersion(tx, "scenario", "", "demo2", "u1", "resources/scenario/y/demo.zip", 10, nil, nil)
+	}))
+	var upload model.Job
+	assert.NoError(t, db.First(&upload, "id = ?", nextQueuedJobID(t, db)).Error)
+	assert.NoError(t, uc.ReportProcessResult(ctx, upload.VersionID, ProcessResultRequest{State: "ACTIVE", JobID: upload.ID, MetaData: map[string]any{"files_count": 3}}))
+	assert.NoError(t, uc.ReprocessVersion(ctx, upload.ResourceID, 1))
+	// 已有未结束的任务时不重复创建，否则后一个任务会把 PENDING 记为原状态
+	assert.ErrorIs(t, uc.ReprocessVersion(ctx, upload.ResourceID, 1), ErrJobInProgress)
+	var unfinished int64
+	db.Model(&model.Job{}).Where("version_id = ? AND state = ?", upload.VersionID, model.JobStateQueued).Count(&unfinished)
+	assert.EqualValues(t, 1, unfinished)
+	reprocessed, err := uc.CancelJob(ctx, nextQueuedJobID(t, db))
+	assert.NoError(t, err)
+	assert.Equal(t, "ACTIVE", reprocessed.PrevState)
+	ver = model.ResourceVersion{}
+	assert.NoError(t, db.First(&ver, "id = ?", upload.VersionID).Error)
+	assert.Equal(t, "ACTIVE", ver.State)
+	assert.Empty(t, ver.ErrorMessage)
+	assert.EqualValues(t, 3, ver.MetaData["files_count"])
+
+	// 执行中的任务：取消其上下文
+	runCtx, done, ok := uc.control.start(ctx, "running-job")
+	assert.True(t, ok)
+	defer done()
+	uc.cancelLocal("running-job")
+	assert.ErrorIs(t, runCtx.Err(), context.Canceled)
+
+	// 取消通知先于任务到达：任务到达后直接跳过
+	uc.cancelLocal("late-job")
+	_, _, ok = uc.control.start(ctx, "late-job")
+	assert.False(t, ok)
+}
+
+// nextQueuedJobID 返回最早的排队任务 ID
+func nextQueuedJobID(t *testing.T, db *gorm.DB) string {
+	t.Helper()
+	var record model.Job
+	assert.NoError(t, db.Where("state = ?", model.JobStateQueued).Order("created_at").First(&record).Error)
+	return record.ID
+}
+
+func TestResultCallbackDelivery(t *testing.T) {
+	callbackRetryBase = time.Millisecond
+	api := &UseCase{callbackSecret: "s3cret"}
+
+	var calls, failing atomic.Int32
+	failing.Store(2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		body, _ := ReadCallbackBody(r)
+		if err := api.VerifyCallback(r, body); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.Equal(t, "result:job-1", r.Header.Get(HeaderIdempotencyKey))
+		if failing.Load() != 0 {
+			failing.Add(-1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	worker := &UseCase{apiBaseURL: srv.URL, callbackSecret: "s3cret", spoolDir: t.TempDir(), httpClient: srv.Client()}
+	req := ProcessResultRequest{State: "ACTIVE", JobID: "job-1"}
+
+	// 临时故障在重试中恢复
+	assert.NoError(t, worker.deliverResult(context.Background(), "v1", "result:job-1", req))
+	assert.EqualValues(t, 3, calls.Load())
+
+	// API 持续不可用：结果写入暂存目录，恢复后重新投递
+	failing.Store(-1)
+	assert.NoError(t, worker.deliverResult(context.Background(), "v1", "result:job-1", req))
+	entries, _ := os.ReadDir(worker.spoolDir)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, 0, worker.flushSpool(context.Background()))
+
+	failing.Store(0)
+	assert.Equal(t, 1, worker.flushSpool(context.Background()))
+	entries, _ = os.ReadDir(worker.spoolDir)
+	assert.Empty(t, entries)
+
+	// 密钥不一致的请求被拒绝
+	worker.callbackSecret = "wrong"
+	calls.Store(0)
+	assert.Error(t, worker.sendResult(context.Background(), "v1", "result:job-1", []byte("{}")))
+	assert.EqualValues(t, 1, calls.Load())
+
+	// API 未配置有效密钥时拒绝所有回调，包括未签名与以占位密钥签名的请求
+	for _, secret := range []string{"", "change-me"} {
+		api.callbackSecret = secret
+		worker.callbackSecret = secret
+		calls.Store(0)
+		assert.Error(t, worker.sendResult(context.Background(), "v1", "result:job-1", []byte("{}")))
+		assert.EqualValues(t, 1, calls.Load())
+	}
+}
+
+func TestResultIdempotencyKey(t *testing.T) {
+	assert.ErrorIs(t, ValidateCallbackSecret(""), ErrCallbackSecretUnset)
+	assert.ErrorIs(t, ValidateCallbackSecret("change-me"), ErrCallbackSecretUnset)
+	assert.NoError(t, ValidateCallbackSecret("s3cret"))
+
+	req := ProcessResultRequest{State: "ACTIVE", JobID: "job-1"}
+	assert.NoError(t, CheckResultIdempotencyKey("", "v1", req))
+	assert.NoError(t, CheckResultIdempotencyKey("result:job-1", "v1", req))
+	assert.ErrorIs(t, CheckResultIdempotencyKey("result:job-2", "v1", req), ErrIdempotencyKeyMismatch)
+	assert.NoError(t, CheckResultIdempotencyKey("result:v1", "v1", ProcessResultRequest{State: "ACTIVE"}))
+}
+
+func TestApplyResultMessage(t *testing.T) {
+	uc, _, db := setupDBUseCase(t)
+	ctx := context.Background()
+
+	assert.NoError(t, db.Transaction(func(tx *gorm.DB) error {
+		return uc.createResourceAndVersion(tx, "scenario", "", "demo", "u1", "resources/scenario/x/demo.zip", 10, nil, nil)
+	}))
+	job := nextJob(t, uc)
+
+	result, _ := json.Marshal(ProcessResultRequest{State: "ACTIVE", JobID: job.JobID, MetaData: map[string]any{"files_count": 2}})
+	data, _ := json.Marshal(resultMessage{VersionID: job.VersionID, Result: result})
+	assert.NoError(t, uc.applyResultMessage(ctx, data))
+	// JetStream 重新投递同一消息时不重复生效，同一任务之后的结果也不再改写版本
+	assert.NoError(t, uc.applyResultMessage(ctx, data))
+	assert.NoError(t, uc.ReportProcessResult(ctx, job.VersionID, ProcessResultRequest{State: "ERROR", JobID: job.JobID, Message: "late"}))
+
+	var ver model.ResourceVersion
+	assert.NoError(t, db.First(&ver, "id = ?", job.VersionID).Error)
+	assert.Equal(t, "ACTIVE", ver.State)
+	var record model.Job
+	assert.NoError(t, db.First(&record, "id = ?", job.JobID).Error)
+	assert.Equal(t, model.JobStateSucceeded, record.State)
+
+	assert.ErrorIs(t, uc.applyResultMessage(ctx, []byte("not json")), errMalformedResult)
+	missing, _ := json.Marshal(resultMessage{VersionID: "missing", Result: []byte(`{"state":"ACTIVE"}`)})
+	assert.ErrorIs(t, uc.applyResultMessage(ctx, missing), gorm.ErrRecordNotFound)
+}
+
+func TestUnencodableResultFailsJob(t *testing.T) {
+	uc, _, db := setupDBUseCase(t)
+	assert.NoError(t, db.Transaction(func(tx *gorm.DB) error {
+		return uc.createResourceAndVersion(tx, "map_terrain", "", "dem", "u1", "resources/map_terrain/x/dem.tif", 10, nil, nil)
+	}))
+	job := nextJob(t, uc)
+
+	// NaN 无法编码为 JSON：任务与版本置为失败，而不是丢弃结果使任务一直停留在运行中
+	uc.reportResult(context.Background(), job, pipelineResult{MetaData: map[string]any{"nodata": math.NaN()}})
+	var record model.Job
+	assert.NoError(t, db.First(&record, "id = ?", job.JobID).Error)
+	assert.Equal(t, model.JobStateFailed, record.State)
+	assert.Contains(t, record.Message, "processor metadata cannot be encoded")
+	var ver model.ResourceVersion
+	assert.NoError(t, db.First(&ver, "id = ?", job.VersionID).Error)
+	assert.Equal(t, "ERROR", ver.State)
+}
+
+func TestOutboxDispatch(t *testing.T) {
+	uc, _, db := setupDBUseCase(t)
+
+	// 回滚的事务既不留下任务记录，也不会发布任务
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := uc.createResourceAndVersion(tx, "scenario", "", "demo", "u1", "resources/scenario/x/a.zip", 10, nil, nil); err != nil {
+			return err
+		}
+		return errors.New("rollback")
+	})
+	assert.Error(t, err)
+	_, err = uc.relayOutbox(time.Now())
+	assert.NoError(t, err)
+	var jobs, entries int64
+	db.Model(&model.Job{}).Count(&jobs)
+	db.Model(&model.OutboxEntry{}).Count(&entries)
+	assert.Zero(t, jobs)
+	assert.Zero(t, entries)
+	assert.Zero(t, uc.queue.Pending("scenario"))
+
+	// 提交后由转发器发布，发布成功的消息从发件箱删除
+	assert.NoError(t, db.Transaction(func(tx *gorm.DB) error {
+		return uc.createResourceAndVersion(tx, "scenario", "", "demo", "u1", "resources/scenario/x/b.zip", 10, nil, nil)
+	}))
+	job := nextJob(t, uc)
+	assert.Equal(t, "resources/scenario/x/b.zip", job.ObjectKey)
+	assert.Equal(t, PriorityInteractive, job.Priority)
+	assert.Eventually(t, func() bool {
+		db.Model(&model.OutboxEntry{}).Count(&entries)
+		return entries == 0
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// 未启用 NATS 的 API 节点没有任务的接收方：消息保留在发件箱中，不写入无人消费的本地队列
+	uc.role = "api"
+	defer func() { uc.role = "combined" }()
+	assert.NoError(t, db.Transaction(func(tx *gorm.DB) error {
+		return uc.createResourceAndVersion(tx, "scenario", "", "demo", "u1", "resources/scenario/x/c.zip", 10, nil, nil)
+	}))
+	n, err := uc.relayOutbox(time.Now())
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+	assert.Zero(t, uc.queue.Pending("scenario"))
+	var entry model.OutboxEntry
+	assert.NoError(t, db.First(&entry).Error)
+	assert.Contains(t, entry.LastError, "nats is disabled")
+}
+
+func TestContentCache(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := newContentCache(dir, 10)
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	var fetches atomic.Int32
+	fetch := func(path string) error {
+		fetches.Add(1)
+		time.Sleep(20 * time.Millisecond)
+		return os.WriteFile(path, []byte("data"), 0o644)
+	}
+
+	// 同一内容并发请求只下载一次
+	paths := make(chan string, 2)
+	for range 2 {
+		go func() {
+			p, release, err := cache.Acquire(ctx, "hash:a", ".zip", fetch)
+			assert.NoError(t, err)
+			release()
+			paths <- p
+		}()
+	}
+	pa := <-paths
+	assert.Equal(t, pa, <-paths)
+	assert.EqualValues(t, 1, fetches.Load())
+	info, err := os.Stat(pa)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o444), info.Mode().Perm())
+
+	// 超出容量时淘汰最久未使用且未被占用的文件
+	pb, releaseB, err := cache.Acquire(ctx, "hash:b", ".zip", fetch)
+	assert.NoError(t, err)
+	_, releaseC, err := cache.Acquire(ctx, "hash:c", ".zip", fetch)
+	assert.NoError(t, err)
+	assert.NoFileExists(t, pa)
+	assert.FileExists(t, pb)
+	releaseB()
+	releaseC()
+
+	// 重启后载入已有的缓存文件
+	cache, err = newContentCache(dir, 10)
+	assert.NoError(t, err)
+	_, release, err := cache.Acquire(ctx, "hash:b", ".zip", fetch)
+	assert.NoError(t, err)
+	release()
+	assert.EqualValues(t, 3, fetches.Load())
+
+	// 超过缓存容量的文件不进入缓存：同时使用的任务各自持有独立的文件，释放一方不影响另一方
+	big := func(path string) error {
+		return os.WriteFile(path, make([]byte, 32), 0o644)
+	}
+	type acquired struct {
+		path    string
+		release func()
+	}
+	results := make(chan acquired, 2)
+	for range 2 {
+		go func() {
+			p, release, err := cache.Acquire(ctx, "hash:big", ".zip", big)
+			assert.NoError(t, err)
+			results <- acquired{p, release}
+		}()
+	}
+	first, second := <-results, <-results
+	assert.NotEqual(t, first.path, second.path)
+	first.release()
+	assert.NoFileExists(t, first.path)
+	data, err := os.ReadFile(second.path)
+	assert.NoError(t, err)
+	assert.Len(t, data, 32)
+	second.release()
+	assert.NoFileExists(t, second.path)
+}
+
+func TestExtractArchive(t *testing.T) {
+	ctx := context.Background()
+	opts, ok := parseExtractOptions(map[string]any{"extract": map[string]any{"max_entries": float64(2)}})
+	assert.True(t, ok)
+	assert.Equal(t, 2, opts.MaxEntries)
+	assert.EqualValues(t, defaultExtractMaxBytes, opts.MaxBytes)
+	_, ok = parseExtractOptions(map[string]any{"extract": false})
+	assert.False(t, ok)
+
+	writeZip := func(names ...string) string {
+		p := filepath.Join(t.TempDir(), "pkg.zip")
+		f, err := os.Create(p)
+		assert.NoError(t, err)
+		zw := zip.NewWriter(f)
+		for _, name := range names {
+			w, err := zw.Create(name)
+			assert.NoError(t, err)
+			w.Write([]byte("{}"))
+		}
+		assert.NoError(t, zw.Close())
+		assert.NoError(t, f.Close())
+		return p
+	}
+
+	dir, err := extractInput(ctx, writeZip("demo/scenario.json", "demo/terrain.dat"), opts)
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.FileExists(t, filepath.Join(dir, "demo", "scenario.json"))
+
+	// zip-slip 与条目数限制
+	_, err = extractInput(ctx, writeZip("ok.txt", "../evil.txt"), opts)
+	assert.ErrorIs(t, err, errUnsafeEntry)
+	_, err = extractInput(ctx, writeZip("/etc/passwd"), opts)
+	assert.ErrorIs(t, err, errUnsafeEntry)
+	_, err = extractInput(ctx, writeZip("a", "b", "c"), opts)
+	assert.ErrorIs(t, err, errExtractLimit)
+
+	// tar.gz：按实际写入的字节数限制大小，符号链接不会被创建
+	p := filepath.Join(t.TempDir(), "pkg.tgz")
+	f, err := os.Create(p)
+	assert.NoError(t, err)
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	assert.NoError(t, tw.WriteHeader(&tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc"}))
+	assert.NoError(t, tw.WriteHeader(&tar.Header{Name: "data.bin", Typeflag: tar.TypeReg, Mode: 0o644, Size: 2048}))
+	tw.Write(make([]byte, 2048))
+	assert.NoError(t, tw.Close())
+	assert.NoError(t, gz.Close())
+	assert.NoError(t, f.Close())
+
+	dir, err = extractInput(ctx, p, opts)
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.FileExists(t, filepath.Join(dir, "data.bin"))
+	_, err = os.Lstat(filepath.Join(dir, "link"))
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = extractInput(ctx, p, extractOptions{MaxBytes: 1024, MaxEntries: 10})
+	assert.ErrorIs(t, err, errExtractLimit)
+
+	_, err = extractInput(ctx, writeZip()+"-missing", opts)
+	assert.Error(t, err)
+}
+
+func TestSpatialSearch(t *testing.T) {
+	uc, mockStore, db := setupDBUseCase(t)
+	ctx := context.Background()
+
+	// 元数据经 JSON 回调后 bbox_wgs84 为 []any
+	activate := func(name string, bbox []any) string {
+		assert.NoError(t, db.Transaction(func(tx *gorm.DB) error {
+			return uc.createResourceAndVersion(tx, "map_terrain", "", name, "u1", "resources/map_terrain/"+name+"/t.tif", 10, nil, nil)
+		}))
+		job := nextJob(t, uc)
+		assert.NoError(t, uc.ReportProcessResult(ctx, job.VersionID, ProcessResultRequest{
+			State: "ACTIVE", JobID: job.JobID, MetaData: map[string]any{"bbox_wgs84": bbox},
+		}))
+		return job.ResourceID
+	}
+	east := activate("east", []any{119.5, 24.0, 122.0, 26.5})
+	west := activate("west", []any{73.0, 35.0, 80.0, 40.0})
+	global := activate("global", []any{-180.0, -90.0, 180.0, 90.0})
+
+	search := func(q string) []string {
+		bbox, err := ParseBBox(q)
+		assert.NoError(t, err)
+		list, total, err := uc.ListResources(ctx, "", "", bbox, 1, 20)
+		assert.NoError(t, err)
+		assert.EqualValues(t, len(list), total)
+		var ids []string
+		for _, r := range list {
+			ids = append(ids, r.ID)
+		}
+		return ids
+	}
+	assert.ElementsMatch(t, []string{east, global}, search("121,25,121.5,25.5"))
+	assert.ElementsMatch(t, []string{east, west, global}, search("70,20,125,45"))
+	assert.ElementsMatch(t, []string{global}, search("0,0,1,1"))
+	// 覆盖单元过多的查询直接按边界过滤
+	assert.ElementsMatch(t, []string{east, west, global}, search("-180,-90,180,90"))
+
+	_, err := ParseBBox("122,25,121,26")
+	assert.ErrorIs(t, err, ErrInvalidBBox)
+	_, err = ParseBBox("1,2,3")
+	assert.ErrorIs(t, err, ErrInvalidBBox)
+
+	// 资源删除后不再被检索到
+	mockStore.On("Delete", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	assert.NoError(t, uc.DeleteResource(ctx, west))
+	assert.ElementsMatch(t, []string{east, global}, search("70,20,125,45"))
+
+	// 存储同步时由 Sidecar 中的 footprint 恢复
+	objects := make(chan storage.ObjectInfo, 1)
+	objects <- storage.ObjectInfo{Key: "resources/map_terrain/r9/t.tif", Size: 10}
+	close(objects)
+	mockStore.On("ListObjects", mock.Anything, mock.Anything, "resources/", true).Return((<-chan storage.ObjectInfo)(objects))
+	mockStore.On("Get", mock.Anything, mock.Anything, "resources/map_terrain/r9/t.tif.meta.json").
+		Return(io.NopCloser(strings.NewReader(`{"resource_name":"synced","footprint":[100,10,101,11]}`)), nil)
+	n, err := uc.SyncFromStorage(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.ElementsMatch(t, []string{"r9", global}, search("100.5,10.5,100.6,10.6"))
+}
+
+func TestArchiveBrowsing(t *testing.T) {
+	uc, mockStore, db := setupDBUseCase(t)
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	big := strings.Repeat("entity-state ", 20000)
+	for _, e := range []struct {
+		name, content string
+		method        uint16
+	}{
+		{"demo/scenario.json", `{"title":"x"}`, zip.Deflate},
+		{"demo/models/", "", zip.Store},
+		{"demo/models/ddg.glb", "glTF-binary", zip.Store},
+		{"demo/logs/state.log", big, zip.Deflate},
+	} {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: e.name, Method: e.method})
+		assert.NoError(t, err)
+		w.Write([]byte(e.content))
+	}
+	assert.NoError(t, zw.Close())
+	archive := buf.Bytes()
+
+	// 以字节切片模拟对象存储，记录范围读取次数
+	var ranges atomic.Int32
+	serve := func(key string, content []byte) {
+		mockStore.On("Stat", mock.Anything, "test-bucket", key).Return(&storage.ObjectInfo{Key: key, Size: int64(len(content))}, nil)
+		mockStore.On("GetRange", mock.Anything, "test-bucket", key, mock.Anything, mock.Anything).Return(func(offset, length int64) io.ReadCloser {
+			ranges.Add(1)
+			return io.NopCloser(bytes.NewReader(content[offset : offset+length]))
+		}, nil)
+	}
+	res := model.Resource{TypeKey: "scenario", Name: "demo"}
+	assert.NoError(t, db.Create(&res).Error)
+	versions := map[int][]byte{1: archive, 2: []byte("not a zip at all")}
+	corrupt := append([]byte(nil), archive...)
+	corrupt[bytes.Index(corrupt, []byte("glTF-binary"))] = 'X'
+	versions[3] = corrupt
+	for num, content := range versions {
+		key := fmt.Sprintf("resources/scenario/v%d/demo.zip", num)
+		assert.NoError(t, db.Create(&model.ResourceVersion{ResourceID: res.ID, VersionNum: num, FilePath: key, State: "ACTIVE"}).Error)
+		serve(key, content)
+	}
+
+	list, total, err := uc.ListArchiveEntries(ctx, res.ID, 1, "", 1, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, total)
+	var paths []string
+	for _, e := range list {
+		paths = append(paths, e.Path)
+	}
+	assert.Equal(t, []string{"demo/logs/state.log", "demo/models", "demo/models/ddg.glb", "demo/scenario.json"}, paths)
+	assert.True(t, list[1].IsDir)
+	assert.EqualValues(t, len(big), list[0].Size)
+	assert.Less(t, list[0].CompressedSize, list[0].Size)
+
+	// 目录已缓存：再次列出与按前缀分页不再访问存储
+	before := ranges.Load()
+	list, total, err = uc.ListArchiveEntries(ctx, res.ID, 1, "/demo/models", 2, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, total)
+	assert.Equal(t, "demo/models/ddg.glb", list[0].Path)
+	assert.Equal(t, before, ranges.Load())
+
+	// 超大页号或页大小不会溢出
+	list, total, err = uc.ListArchiveEntries(ctx, res.ID, 1, "", math.MaxInt, 1000)
+	assert.NoError(t, err)
+	assert.NotZero(t, total)
+	assert.Empty(t, list)
+	list, _, err = uc.ListArchiveEntries(ctx, res.ID, 1, "", 2, math.MaxInt)
+	assert.NoError(t, err)
+	assert.Empty(t, list)
+
+	read := func(num int, name string) (string, error) {
+		_, body, err := uc.OpenArchiveEntry(ctx, res.ID, num, name)
+		if err != nil {
+			return "", err
+		}
+		defer body.Close()
+		data, err := io.ReadAll(body)
+		return string(data), err
+	}
+	content, err := read(1, "/demo/logs/state.log")
+	assert.NoError(t, err)
+	assert.Equal(t, big, content)
+	content, err = read(1, "demo/models/ddg.glb")
+	assert.NoError(t, err)
+	assert.Equal(t, "glTF-binary", content)
+
+	_, err = read(1, "demo/models")
+	assert.ErrorIs(t, err, ErrEntryNotFound)
+	_, err = read(1, "missing.txt")
+	assert.ErrorIs(t, err, ErrEntryNotFound)
+	_, _, err = uc.ListArchiveEntries(ctx, res.ID, 2, "", 1, 100)
+	assert.ErrorIs(t, err, ErrNotArchive)
+	_, _, err = uc.ListArchiveEntries(ctx, res.ID, 9, "", 1, 100)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	// 内容损坏时读到末尾返回校验错误
+	_, err = read(3, "demo/models/ddg.glb")
+	assert.ErrorIs(t, err, zip.ErrChecksum)
+}
+
+func TestDiffVersions(t *testing.T) {
+	uc, mockStore, db := setupDBUseCase(t)
+	ctx := context.Background()
+
+	res := model.Resource{TypeKey: "scenario", Name: "demo"}
+	assert.NoError(t, db.Create(&res).Error)
+	// 每次读取清单都返回新的 reader
+	serveManifest := func(key string, manifest *FileManifest) {
+		data, _ := json.Marshal(manifest)
+		mockStore.On("Get", mock.Anything, "test-bucket", key).Return(io.NopCloser(bytes.NewReader(data)), nil).Once()
+	}
+	addVersion := func(num int, meta map[string]any, manifest *FileManifest) model.ResourceVersion {
+		ver := model.ResourceVersion{ResourceID: res.ID, VersionNum: num, FilePath: fmt.Sprintf("resources/scenario/v%d/demo.zip", num), State: "ACTIVE", MetaData: meta}
+		assert.NoError(t, db.Create(&ver).Error)
+		if manifest != nil {
+			key := fmt.Sprintf("resources/scenario/v%d/renditions/manifest.json", num)
+			assert.NoError(t, db.Create(&model.Rendition{VersionID: ver.ID, Role: "manifest", ObjectKey: key}).Error)
+			serveManifest(key, manifest)
+		}
+		return ver
+	}
+
+	addVersion(1, map[string]any{"title": "Exercise", "engine": "simengine-3", "sides": []any{"blue", "red"}}, &FileManifest{Files: []ManifestFile{
+		{Path: "demo/scenario.json", Size: 100, CRC32: 1},
+		{Path: "demo/models/ddg.glb", Size: 2048, CRC32: 2},
+		{Path: "demo/readme.txt", Size: 5, CRC32: 3},
+	}})
+	v2Manifest := &FileManifest{Files: []ManifestFile{
+		{Path: "demo/scenario.json", Size: 100, CRC32: 9},
+		{Path: "demo/models/ddg.glb", Size: 2048, CRC32: 2},
+		{Path: "demo/models/j10.glb", Size: 4096, CRC32: 4},
+	}}
+	addVersion(2, map[string]any{"title": "Exercise", "sides": []any{"blue", "red", "white"}, "duration_s": float64(5400)}, v2Manifest)
+
+	diff, err := uc.DiffVersions(ctx, res.ID, 1, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []ManifestFile{{Path: "demo/models/j10.glb", Size: 4096, CRC32: 4}}, diff.Files.Added)
+	assert.Equal(t, []ManifestFile{{Path: "demo/readme.txt", Size: 5, CRC32: 3}}, diff.Files.Removed)
+	assert.Equal(t, []FileChange{{
+		Path: "demo/scenario.json",
+		From: ManifestFile{Path: "demo/scenario.json", Size: 100, CRC32: 1},
+		To:   ManifestFile{Path: "demo/scenario.json", Size: 100, CRC32: 9},
+	}}, diff.Files.Modified)
+	assert.Equal(t, 1, diff.Files.Unchanged)
+	assert.Equal(t, map[string]any{"duration_s": float64(5400)}, diff.Metadata.Added)
+	assert.Equal(t, map[string]any{"engine": "simengine-3"}, diff.Metadata.Removed)
+	assert.Equal(t, map[string]MetaChange{"sides": {From: []any{"blue", "red"}, To: []any{"blue", "red", "white"}}}, diff.Metadata.Modified)
+
+	// 没有清单的 ZIP 版本按范围读取中央目录
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range map[string]string{"demo/models/": "", "demo/models/ddg.glb": "glTF", "demo/notes.txt": "hello"} {
+		w, err := zw.Create(name)
+		assert.NoError(t, err)
+		w.Write([]byte(content))
+	}
+	assert.NoError(t, zw.Close())
+	v3 := addVersion(3, map[string]any{"title": "Exercise"}, nil)
+	archive := buf.Bytes()
+	mockStore.On("Stat", mock.Anything, "test-bucket", v3.FilePath).Return(&storage.ObjectInfo{Key: v3.FilePath, Size: int64(len(archive))}, nil)
+	mockStore.On("GetRange", mock.Anything, "test-bucket", v3.FilePath, mock.Anything, mock.Anything).Return(func(offset, length int64) io.ReadCloser {
+		return io.NopCloser(bytes.NewReader(archive[offset : offset+length]))
+	}, nil)
+
+	serveManifest("resources/scenario/v2/renditions/manifest.json", v2Manifest)
+	diff, err = uc.DiffVersions(ctx, res.ID, 2, 3)
+	assert.NoError(t, err)
+	assert.Len(t, diff.Files.Added, 1)
+	assert.Equal(t, "demo/notes.txt", diff.Files.Added[0].Path)
+	assert.EqualValues(t, 5, diff.Files.Added[0].Size)
+	assert.Len(t, diff.Files.Modified, 1)
+	assert.Equal(t, "demo/models/ddg.glb", diff.Files.Modified[0].Path)
+	assert.Len(t, diff.Files.Removed, 2)
+
+	v4 := addVersion(4, nil, nil)
+	text := []byte("not a zip at all")
+	mockStore.On("Stat", mock.Anything, "test-bucket", v4.FilePath).Return(&storage.ObjectInfo{Key: v4.FilePath, Size: int64(len(text))}, nil)
+	mockStore.On("GetRange", mock.Anything, "test-bucket", v4.FilePath, mock.Anything, mock.Anything).Return(func(offset, length int64) io.ReadCloser {
+		return io.NopCloser(bytes.NewReader(text[offset : offset+length]))
+	}, nil)
+	_, err = uc.DiffVersions(ctx, res.ID, 3, 4)
+	assert.ErrorIs(t, err, ErrNoManifest)
+	_, err = uc.DiffVersions(ctx, res.ID, 1, 9)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
@@ -0,0 +1,154 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+// WASM 处理器的沙箱内路径：输入文件所在目录只读挂载，输出目录可写
+const (
+	wasmInputDir  = "/input"
+	wasmOutputDir = "/output"
+	wasmPrevDir   = "/prev"
+	wasmPageSize  = 64 << 10
+	wasmMaxPages  = 65536 // wasm32 的地址空间上限 (4GB)
+)
+
+// wasmCompilationCache 跨调用复用 WASM 模块的编译结果
+var wasmCompilationCache = wazero.NewCompilationCache()
+
+// isWasmModule 判断处理器命令是否指向 .wasm 模块
+func isWasmModule(exe string) bool {
+	return strings.EqualFold(filepath.Ext(exe), ".wasm")
+}
+
+// wasmMount 宿主目录到沙箱路径的挂载
+type wasmMount struct {
+	HostDir   string
+	GuestPath string
+	ReadOnly  bool
+}
+
+// stageWasmInput 为 WASM 处理器准备仅包含输入文件的目录，避免挂载整个临时目录
+func stageWasmInput(filePath string) (string, error) {
+	dir, err := os.MkdirTemp("", "simhub-wasm-input-*")
+	if err != nil {
+		return "", err
+	}
+	dst := filepath.Join(dir, filepath.Base(filePath))
+	if err := os.Link(filePath, dst); err != nil {
+		// 跨设备等情况无法硬链接时复制一份
+		if err := copyFile(filePath, dst); err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// runWasm 使用纯 Go 的 WASI 运行时执行 WASM 处理器
+//
+// 模块只能访问显式挂载的目录，看不到宿主环境变量与网络；超时后中断执行，
+// 内存按 max_memory_mb 限制线性内存页数，stdout/stderr 上限与外部命令一致。
+func runWasm(ctx context.Context, run sandboxedRun, mounts []wasmMount) error {
+	exe, err := filepath.Abs(run.Argv[0])
+	if err != nil {
+		return fmt.Errorf("resolve wasm module: %w", err)
+	}
+	bin, err := os.ReadFile(exe)
+	if err != nil {
+		return fmt.Errorf("read wasm module: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, run.Limits.Timeout)
+	defer cancel()
+
+	rtConf := wazero.NewRuntimeConfig().
+		WithCloseOnContextDone(true).
+		WithCompilationCache(wasmCompilationCache)
+	if run.Limits.MemoryBytes > 0 {
+		rtConf = rtConf.WithMemoryLimitPages(uint32(min(run.Limits.MemoryBytes/wasmPageSize, wasmMaxPages)))
+	}
+	rt := wazero.NewRuntimeWithConfig(ctx, rtConf)
+	defer rt.Close(context.Background())
+
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, rt); err != nil {
+		return fmt.Errorf("instantiate wasi: %w", err)
+	}
+	compiled, err := rt.CompileModule(ctx, bin)
+	if err != nil {
+		return fmt.Errorf("compile wasm module: %w", err)
+	}
+
+	fsConf := wazero.NewFSConfig()
+	for _, m := range mounts {
+		if m.ReadOnly {
+			fsConf = fsConf.WithReadOnlyDirMount(m.HostDir, m.GuestPath)
+		} else {
+			fsConf = fsConf.WithDirMount(m.HostDir, m.GuestPath)
+		}
+	}
+
+	args := append([]string{path.Base(filepath.ToSlash(run.Argv[0]))}, run.Argv[1:]...)
+	modConf := wazero.NewModuleConfig().
+		WithName("").
+		WithArgs(args...).
+		WithFSConfig(fsConf).
+		WithSysWalltime().
+		WithSysNanotime().
+		WithSysNanosleep()
+	if run.OutputDir != "" {
+		modConf = modConf.WithEnv("SIMHUB_OUTPUT_DIR", run.OutputDir)
+	}
+	if run.Stdin != nil {
+		modConf = modConf.WithStdin(run.Stdin)
+	}
+	if run.Stdout != nil {
+		modConf = modConf.WithStdout(run.Stdout)
+	}
+	if run.Stderr != nil {
+		modConf = modConf.WithStderr(run.Stderr)
+	}
+
+	slog.Debug("执行 WASM 处理器", "module", exe, "args", args, "timeout", run.Limits.Timeout)
+	_, err = rt.InstantiateModule(ctx, compiled, modConf)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %s", run.Limits.Timeout)
+	}
+	var exitErr *sys.ExitError
+	if errors.As(err, &exitErr) {
+		if exitErr.ExitCode() == 0 {
+			return nil
+		}
+		return fmt.Errorf("exit status %d", exitErr.ExitCode())
+	}
+	return err
+}
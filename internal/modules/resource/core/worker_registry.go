@@ -0,0 +1,324 @@
+package core
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/liny/sim-hub/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// WorkerVersion Worker 程序版本，构建时可通过
+// -ldflags "-X github.com/liny/sim-hub/internal/modules/resource/core.WorkerVersion=x.y.z" 注入
+var WorkerVersion = "dev"
+
+const (
+	defaultWorkerSubject    = "simhub.workers"
+	apiQueueGroup           = "simhub-api" // 多个 API 节点分摊心跳写入
+	workerHeartbeatInterval = 15 * time.Second
+	workerDeadAfter         = 3 * workerHeartbeatInterval // 连续错过 3 次心跳视为失联
+	workerPruneAfter        = 24 * time.Hour              // 失联超过该时间的记录被清理
+	workerReapBatch         = 100
+	throughputWindow        = 5 * time.Minute
+)
+
+// WorkerHeartbeat Worker 周期上报的注册与运行状态，首次心跳即完成注册
+type WorkerHeartbeat struct {
+	WorkerID          string            `json:"worker_id"`
+	Hostname          string            `json:"hostname"`
+	Version           string            `json:"version"`
+	Types             []string          `json:"types"`
+	ProcessorVersions map[string]string `json:"processor_versions"`
+	Concurrency       int               `json:"concurrency"`
+	RunningJobs       []string          `json:"running_jobs"`
+	QueuedJobs        []string          `json:"queued_jobs,omitempty"` // 已从 NATS 接收、在本地队列等待执行的任务
+	Succeeded         int64             `json:"succeeded"`
+	Failed            int64             `json:"failed"`
+	ThroughputPerMin  float64           `json:"throughput_per_min"`
+	State             string            `json:"state"` // ONLINE, OFFLINE
+	StartedAt         time.Time         `json:"started_at"`
+	SentAt            time.Time         `json:"sent_at"`
+}
+
+// workerStats Worker 本地的任务运行统计
+type workerStats struct {
+	mu          sync.Mutex
+	id          string
+	hostname    string
+	startedAt   time.Time
+	running     map[string]struct{}
+	succeeded   int64
+	failed      int64
+	completions []time.Time // 吞吐统计窗口内的完成时间
+}
+
+func newWorkerStats() *workerStats {
+	hostname, _ := os.Hostname()
+	return &workerStats{
+		id:        uuid.New().String(),
+		hostname:  hostname,
+		startedAt: time.Now(),
+		running:   make(map[string]struct{}),
+	}
+}
+
+// 统计方法允许 nil 接收者，API 节点上直接调用处理逻辑时不做统计
+func (s *workerStats) jobStarted(jobID string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running[jobID] = struct{}{}
+}
+
+func (s *workerStats) jobStopped(jobID string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.running, jobID)
+}
+
+// jobFinished 记录一次处理结果 (成功或失败)
+func (s *workerStats) jobFinished(ok bool) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ok {
+		s.succeeded++
+	} else {
+		s.failed++
+	}
+	s.completions = append(s.completions, time.Now())
+}
+
+// heartbeat 生成当前状态的心跳
+func (s *workerStats) heartbeat(uc *UseCase, state string) WorkerHeartbeat {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := time.Now().Add(-throughputWindow)
+	i := 0
+	for i < len(s.completions) && s.completions[i].Before(cutoff) {
+		i++
+	}
+	s.completions = s.completions[i:]
+
+	running := make([]string, 0, len(s.running))
+	for id := range s.running {
+		running = append(running, id)
+	}
+	slices.Sort(running)
+
+	return WorkerHeartbeat{
+		WorkerID:          s.id,
+		Hostname:          s.hostname,
+		Version:           WorkerVersion,
+		Types:             uc.acceptedTypes(),
+		ProcessorVersions: uc.processorVersions,
+		Concurrency:       uc.limiter.limit,
+		RunningJobs:       running,
+		QueuedJobs:        uc.queue.JobIDs(),
+		Succeeded:         s.succeeded,
+		Failed:            s.failed,
+		ThroughputPerMin:  float64(len(s.completions)) / throughputWindow.Minutes(),
+		State:             state,
+		StartedAt:         s.startedAt,
+		SentAt:            time.Now(),
+	}
+}
+
+// workerSubject 心跳主题前缀
+func (uc *UseCase) workerSubject() string {
+	if uc.nats != nil && uc.nats.Config.WorkerSubject != "" {
+		return uc.nats.Config.WorkerSubject
+	}
+	return defaultWorkerSubject
+}
+
+// startHeartbeat 启动时立即注册，之后周期上报心跳，直到 Shutdown
+func (uc *UseCase) startHeartbeat() {
+	uc.sendHeartbeat(model.WorkerStateOnline)
+	ticker := time.NewTicker(workerHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			uc.sendHeartbeat(model.WorkerStateOnline)
+		case <-uc.stopCh:
+			return
+		}
+	}
+}
+
+// sendHeartbeat 根据节点角色上报心跳 (NATS 或直接写库)，失败仅记录日志
+func (uc *UseCase) sendHeartbeat(state string) {
+	hb := uc.stats.heartbeat(uc, state)
+
+	var err error
+	if uc.nats != nil && uc.nats.Config.Enabled {
+		err = uc.nats.Encoded.Publish(uc.workerSubject()+".heartbeat", &hb)
+	} else if uc.data != nil && uc.data.DB != nil {
+		err = uc.RecordHeartbeat(context.Background(), hb)
+	}
+	if err != nil {
+		slog.Warn("Worker 心跳上报失败", "worker_id", hb.WorkerID, "error", err)
+	}
+}
+
+// Shutdown 停止心跳并通知 API 本节点下线
+func (uc *UseCase) Shutdown() {
+	if uc.stats == nil {
+		return
+	}
+	uc.stopOnce.Do(func() {
+		close(uc.stopCh)
+		uc.sendHeartbeat(model.WorkerStateOffline)
+		if uc.nats != nil && uc.nats.Conn != nil {
+			_ = uc.nats.Conn.Flush()
+		}
+	})
+}
+
+// startHeartbeatConsumer API 节点消费 Worker 心跳并维护注册表
+func (uc *UseCase) startHeartbeatConsumer() {
+	subject := uc.workerSubject() + ".heartbeat"
+	_, err := uc.nats.Encoded.QueueSubscribe(subject, apiQueueGroup, func(hb *WorkerHeartbeat) {
+		if err := uc.RecordHeartbeat(context.Background(), *hb); err != nil {
+			slog.Error("记录 Worker 心跳失败", "worker_id", hb.WorkerID, "error", err)
+		}
+	})
+	if err != nil {
+		slog.Error("订阅 Worker 心跳失败", "subject", subject, "error", err)
+		return
+	}
+	slog.Info("Worker 心跳订阅已启动", "subject", subject)
+}
+
+// RecordHeartbeat 写入或更新 Worker 注册信息
+func (uc *UseCase) RecordHeartbeat(ctx context.Context, hb WorkerHeartbeat) error {
+	if hb.WorkerID == "" {
+		return nil
+	}
+	w := model.Worker{
+		ID:                hb.WorkerID,
+		Hostname:          hb.Hostname,
+		Version:           hb.Version,
+		Types:             hb.Types,
+		ProcessorVersions: hb.ProcessorVersions,
+		Concurrency:       hb.Concurrency,
+		RunningJobs:       hb.RunningJobs,
+		Succeeded:         hb.Succeeded,
+		Failed:            hb.Failed,
+		ThroughputPerMin:  hb.ThroughputPerMin,
+		State:             hb.State,
+		StartedAt:         hb.StartedAt,
+		LastSeenAt:        time.Now(),
+	}
+	err := uc.data.DB.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"hostname", "version", "types", "processor_versions", "concurrency", "running_jobs",
+			"succeeded", "failed", "throughput_per_min", "state", "started_at", "last_seen_at",
+		}),
+	}).Create(&w).Error
+	jobs := append(append([]string(nil), hb.RunningJobs...), hb.QueuedJobs...)
+	if err != nil || len(jobs) == 0 {
+		return err
+	}
+	// Worker 已接收 (QUEUED) 与正在执行 (RUNNING) 的任务随心跳刷新更新时间：前者不被重新投递，
+	// 后者不被视为失联 Worker 遗留的任务；Worker 失联后心跳停止，任务超时后由 API 节点重新排队
+	return uc.data.DB.WithContext(ctx).Model(&model.Job{}).
+		Where("id IN ? AND state IN ?", jobs, []string{model.JobStateQueued, model.JobStateRunning}).
+		Update("updated_at", time.Now()).Error
+}
+
+// startWorkerReaper API 节点定期处理失联的 Worker
+func (uc *UseCase) startWorkerReaper() {
+	ticker := time.NewTicker(workerHeartbeatInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		n, err := uc.reapWorkers(time.Now())
+		if err != nil {
+			slog.Error("处理失联 Worker 失败", "error", err)
+		} else if n > 0 {
+			slog.Warn("失联 Worker 的运行中任务已重新排队", "count", n)
+		}
+	}
+}
+
+// reapWorkers 把超时未心跳的 Worker 置为 DEAD 并清理长期失联的记录；
+// 超过失联判定时间仍未被任何心跳刷新的 RUNNING 任务重新排队，经发件箱投递，返回重新排队的任务数
+func (uc *UseCase) reapWorkers(now time.Time) (int, error) {
+	db := uc.data.DB
+	if err := db.Model(&model.Worker{}).Where("state = ? AND last_seen_at < ?", model.WorkerStateOnline, now.Add(-workerDeadAfter)).
+		Update("state", model.WorkerStateDead).Error; err != nil {
+		return 0, err
+	}
+	if err := db.Where("last_seen_at < ?", now.Add(-workerPruneAfter)).Delete(&model.Worker{}).Error; err != nil {
+		return 0, err
+	}
+
+	cutoff := now.Add(-workerDeadAfter)
+	var jobs []model.Job
+	if err := db.Where("state = ? AND action = ? AND updated_at < ?", model.JobStateRunning, ActionProcess, cutoff).
+		Order("updated_at").Limit(workerReapBatch).Find(&jobs).Error; err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, record := range jobs {
+		requeued := false
+		err := db.Transaction(func(tx *gorm.DB) error {
+			// 期间已结束或刚上报进度的任务不处理
+			result := tx.Model(&model.Job{}).Where("id = ? AND state = ? AND updated_at < ?", record.ID, model.JobStateRunning, cutoff).
+				Updates(map[string]any{
+					"state":        model.JobStateQueued,
+					"progress":     0,
+					"progress_msg": "",
+					"started_at":   nil,
+				})
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
+			}
+			var err error
+			requeued, err = uc.requeueJob(tx, record)
+			return err
+		})
+		if err != nil {
+			return count, err
+		}
+		if requeued {
+			slog.Warn("任务所在 Worker 已失联，重新排队", "job_id", record.ID, "type_key", record.TypeKey)
+			count++
+		}
+	}
+	if count > 0 {
+		uc.kickOutbox()
+	}
+	return count, nil
+}
+
+// ListWorkers 列出已注册的 Worker，超时未心跳的显示为 DEAD
+func (uc *UseCase) ListWorkers(ctx context.Context) ([]model.Worker, error) {
+	now := time.Now()
+	var workers []model.Worker
+	if err := uc.data.DB.WithContext(ctx).Order("hostname, started_at desc").Find(&workers).Error; err != nil {
+		return nil, err
+	}
+	for i := range workers {
+		if workers[i].State == model.WorkerStateOnline && now.Sub(workers[i].LastSeenAt) > workerDeadAfter {
+			workers[i].State = model.WorkerStateDead
+		}
+	}
+	return workers, nil
+}
@@ -1,13 +1,20 @@
 package resource
 
 import (
+	"errors"
+	"mime"
 	"net/http"
+	"path"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/liny/sim-hub/internal/conf"
 	"github.com/liny/sim-hub/internal/core/module"
 	"github.com/liny/sim-hub/internal/data"
 	"github.com/liny/sim-hub/internal/modules/resource/core"
 	"github.com/liny/sim-hub/pkg/storage"
+	"gorm.io/gorm"
 )
 
 // Module 实现了 module.Module 接口
@@ -15,9 +22,9 @@ type Module struct {
 	uc *core.UseCase
 }
 
-func NewModule(d *data.Data, store storage.MultipartBlobStore, stsProvider storage.SecurityTokenProvider, bucket string, natsClient *data.NATSClient, role string, apiBaseURL string, handlers map[string]string) module.Module {
+func NewModule(d *data.Data, store storage.MultipartBlobStore, stsProvider storage.SecurityTokenProvider, bucket string, natsClient *data.NATSClient, role string, workerConf conf.Worker) module.Module {
 	return &Module{
-		uc: core.NewUseCase(d, store, stsProvider, bucket, natsClient, role, apiBaseURL, handlers),
+		uc: core.NewUseCase(d, store, stsProvider, bucket, natsClient, role, workerConf),
 	}
 }
 
@@ -42,9 +49,34 @@ func (m *Module) RegisterRoutes(g *gin.RouterGroup) {
 		resources.GET("/:id", m.GetResource)
 		resources.DELETE("/:id", m.DeleteResource)         // 新增：删除资源
 		resources.PATCH("/:id/tags", m.UpdateResourceTags) // 新增：更新标签
-		resources.PATCH("/:id/process-result", m.ReportProcessResult)
+		resources.PATCH("/:id/process-result", m.workerAuth, m.ReportProcessResult)
+		resources.POST("/:id/versions/:num/reprocess", m.ReprocessVersion)
+		resources.GET("/:id/versions/:num/renditions", m.ListRenditions)
+		resources.GET("/:id/versions/:num/entries", m.ListArchiveEntries)
+		resources.GET("/:id/versions/:num/entries/*path", m.GetArchiveEntry)
+		resources.GET("/:id/thumbnail", m.GetThumbnail)
+		resources.GET("/:id/diff", m.DiffVersions)
 	}
 
+	// /api/v1/resource-types 路径组
+	resourceTypes := g.Group("/resource-types")
+	{
+		resourceTypes.POST("/:key/reprocess", m.ReprocessResourceType)
+		resourceTypes.GET("/:key/processor-report", m.GetProcessorReport)
+	}
+
+	// /api/v1/jobs 路径组
+	jobs := g.Group("/jobs")
+	{
+		jobs.GET("", m.ListJobs)
+		jobs.GET("/:id", m.GetJob)
+		jobs.PATCH("/:id/progress", m.workerAuth, m.ReportJobProgress)
+		jobs.POST("/:id/cancel", m.CancelJob)
+	}
+
+	// /api/v1/workers 计算节点状态
+	g.GET("/workers", m.ListWorkers)
+
 	// /api/v1/categories 路径组
 	categories := g.Group("/categories")
 	{
@@ -54,6 +86,20 @@ func (m *Module) RegisterRoutes(g *gin.RouterGroup) {
 	}
 }
 
+// workerAuth 校验 Worker 回调请求的 HMAC 签名
+func (m *Module) workerAuth(c *gin.Context) {
+	body, err := core.ReadCallbackBody(c.Request)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := m.uc.VerifyCallback(c.Request, body); err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	c.Next()
+}
+
 // ApplyUploadToken 申请上传令牌
 func (m *Module) ApplyUploadToken(c *gin.Context) {
 	var req core.ApplyUploadTokenRequest
@@ -151,8 +197,18 @@ func (m *Module) ReportProcessResult(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	// 幂等键须对应请求体中的任务，重复投递由 ReportProcessResult 按任务去重
+	if err := core.CheckResultIdempotencyKey(c.GetHeader(core.HeaderIdempotencyKey), id, req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	if err := m.uc.ReportProcessResult(c.Request.Context(), id, req); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// 版本已被删除，Worker 不再重试
+			c.JSON(http.StatusNotFound, gin.H{"error": "Version not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -165,8 +221,16 @@ func (m *Module) ListResources(c *gin.Context) {
 	size := 20
 	typeKey := c.Query("type")
 	categoryID := c.Query("category_id")
+	var bbox *core.BBox
+	if s := c.Query("bbox"); s != "" {
+		var err error
+		if bbox, err = core.ParseBBox(s); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
-	list, total, err := m.uc.ListResources(c.Request.Context(), typeKey, categoryID, page, size)
+	list, total, err := m.uc.ListResources(c.Request.Context(), typeKey, categoryID, bbox, page, size)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -251,3 +315,294 @@ func (m *Module) DeleteResource(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, gin.H{"code": 200, "msg": "Resource deleted"})
 }
+
+// ReprocessVersion 重新处理指定版本
+func (m *Module) ReprocessVersion(c *gin.Context) {
+	id := c.Param("id")
+	num, err := strconv.Atoi(c.Param("num"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid version number"})
+		return
+	}
+
+	if err := m.uc.ReprocessVersion(c.Request.Context(), id, num); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Version not found"})
+			return
+		}
+		if errors.Is(err, core.ErrJobInProgress) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "msg": "Reprocess started"})
+}
+
+// ReprocessResourceType 按类型与筛选条件批量重处理
+func (m *Module) ReprocessResourceType(c *gin.Context) {
+	var filter core.ReprocessFilter
+	// 请求体可选，空请求体表示处理该类型下所有资源的最新版本
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&filter); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	resp, err := m.uc.ReprocessResourceType(c.Request.Context(), c.Param("key"), filter)
+	if errors.Is(err, core.ErrInvalidPriority) || errors.Is(err, core.ErrInvalidRate) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, core.ErrNoProcessorVersion) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Resource type not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetProcessorReport 获取某类型的处理器版本分布与过期版本报告
+func (m *Module) GetProcessorReport(c *gin.Context) {
+	report, err := m.uc.GetProcessorReport(c.Request.Context(), c.Param("key"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Resource type not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// ListJobs 列出处理任务
+func (m *Module) ListJobs(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 || size > 100 {
+		size = 20
+	}
+
+	list, total, err := m.uc.ListJobs(c.Request.Context(), c.Query("version_id"), c.Query("state"), page, size)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"items": list,
+		"total": total,
+		"page":  page,
+		"size":  size,
+	})
+}
+
+// GetJob 获取处理任务详情
+func (m *Module) GetJob(c *gin.Context) {
+	job, err := m.uc.GetJob(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// ReportJobProgress 处理由外部 Worker 转发的处理器进度
+func (m *Module) ReportJobProgress(c *gin.Context) {
+	var req core.JobProgressRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := m.uc.UpdateJobProgress(c.Request.Context(), c.Param("id"), req); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "msg": "Progress reported"})
+}
+
+// CancelJob 取消排队或运行中的处理任务
+func (m *Module) CancelJob(c *gin.Context) {
+	job, err := m.uc.CancelJob(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		case errors.Is(err, core.ErrJobFinished):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// ListWorkers 列出计算节点及其心跳状态
+func (m *Module) ListWorkers(c *gin.Context) {
+	workers, err := m.uc.ListWorkers(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, workers)
+}
+
+// ListRenditions 列出版本的派生文件
+func (m *Module) ListRenditions(c *gin.Context) {
+	num, err := strconv.Atoi(c.Param("num"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid version number"})
+		return
+	}
+
+	list, err := m.uc.ListRenditions(c.Request.Context(), c.Param("id"), num)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Version not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// thumbnailMaxAge 缩略图的浏览器缓存时间，过期后凭 ETag 校验，资源出新版本后最迟在此时间后更新
+const thumbnailMaxAge = "public, max-age=300"
+
+// GetThumbnail 返回资源最新可用版本的缩略图，支持 If-None-Match 条件请求
+func (m *Module) GetThumbnail(c *gin.Context) {
+	thumb, err := m.uc.Thumbnail(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, core.ErrThumbnailNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Thumbnail not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	etag := `"` + thumb.ID + `"`
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", thumbnailMaxAge)
+	c.Header("Last-Modified", thumb.CreatedAt.UTC().Format(http.TimeFormat))
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	body, err := m.uc.OpenRendition(c.Request.Context(), thumb)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer body.Close()
+	c.DataFromReader(http.StatusOK, thumb.Size, thumb.ContentType, body, nil)
+}
+
+// etagMatches 判断 If-None-Match 是否命中 (弱比较，支持列表与 *)
+func etagMatches(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// ListArchiveEntries 列出 ZIP 版本中的文件，只按范围读取中央目录，不下载整个文件
+func (m *Module) ListArchiveEntries(c *gin.Context) {
+	num, err := strconv.Atoi(c.Param("num"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid version number"})
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "1000"))
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 || size > 10000 {
+		size = 1000
+	}
+
+	list, total, err := m.uc.ListArchiveEntries(c.Request.Context(), c.Param("id"), num, c.Query("prefix"), page, size)
+	if err != nil {
+		m.archiveError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"items": list,
+		"total": total,
+		"page":  page,
+		"size":  size,
+	})
+}
+
+// GetArchiveEntry 流式返回 ZIP 版本中的单个文件
+func (m *Module) GetArchiveEntry(c *gin.Context) {
+	num, err := strconv.Atoi(c.Param("num"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid version number"})
+		return
+	}
+
+	entry, body, err := m.uc.OpenArchiveEntry(c.Request.Context(), c.Param("id"), num, c.Param("path"))
+	if err != nil {
+		m.archiveError(c, err)
+		return
+	}
+	defer body.Close()
+
+	contentType := mime.TypeByExtension(path.Ext(entry.Path))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.DataFromReader(http.StatusOK, int64(entry.Size), contentType, body, map[string]string{
+		"Content-Disposition": mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(entry.Path)}),
+	})
+}
+
+// DiffVersions 比较两个版本的文件清单与元数据: ?from=2&to=3
+func (m *Module) DiffVersions(c *gin.Context) {
+	from, err1 := strconv.Atoi(c.Query("from"))
+	to, err2 := strconv.Atoi(c.Query("to"))
+	if err1 != nil || err2 != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from and to must be version numbers"})
+		return
+	}
+	diff, err := m.uc.DiffVersions(c.Request.Context(), c.Param("id"), from, to)
+	if err != nil {
+		m.archiveError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, diff)
+}
+
+func (m *Module) archiveError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Version not found"})
+	case errors.Is(err, core.ErrEntryNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, core.ErrNotArchive), errors.Is(err, core.ErrUnsupportedEntry), errors.Is(err, core.ErrNoManifest):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,515 @@
+package processors
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/liny/sim-hub/internal/modules/resource/core"
+)
+
+// GeoTIFFExtractorVersion GeoTIFF 元数据提取器版本
+const GeoTIFFExtractorVersion = "1.0.0"
+
+func init() {
+	// 既可作为 map_terrain 类型的处理器，也可作为流水线中的 geotiff 阶段
+	core.RegisterProcessor("map_terrain", GeoTIFFExtractor{})
+	core.RegisterProcessor("geotiff", GeoTIFFExtractor{})
+}
+
+// GeoTIFFExtractor 读取 GeoTIFF 的标签与 GeoKey，不读取栅格数据
+type GeoTIFFExtractor struct{}
+
+func (GeoTIFFExtractor) Version() string {
+	return GeoTIFFExtractorVersion
+}
+
+func (GeoTIFFExtractor) Process(ctx context.Context, req core.ProcessorRequest, progress func(core.ProgressEvent)) (*core.ProcessorOutput, error) {
+	progress(core.ProgressEvent{Percent: 0, Message: "reading tags"})
+	meta, warnings, err := InspectGeoTIFF(req.FilePath)
+	if err != nil {
+		return &core.ProcessorOutput{Status: core.ProcessorStatusFailed, Error: err.Error()}, nil
+	}
+	progress(core.ProgressEvent{Percent: 100, Message: "done"})
+	return &core.ProcessorOutput{Status: core.ProcessorStatusSuccess, Metadata: meta, Warnings: warnings}, nil
+}
+
+// TIFF 与 GeoTIFF 标签
+const (
+	tagImageWidth      = 256
+	tagImageLength     = 257
+	tagBitsPerSample   = 258
+	tagCompression     = 259
+	tagSamplesPerPixel = 277
+	tagTileWidth       = 322
+	tagSampleFormat    = 339
+	tagModelPixelScale = 33550
+	tagModelTiepoint   = 33922
+	tagModelTransform  = 34264
+	tagGeoKeyDirectory = 34735
+	tagGeoDoubleParams = 34736
+	tagGeoASCIIParams  = 34737
+	tagGDALNoData      = 42113
+)
+
+// GeoKey
+const (
+	keyModelType      = 1024
+	keyRasterType     = 1025
+	keyGeographicType = 2048
+	keyProjectedType  = 3072
+
+	modelTypeProjected  = 1
+	modelTypeGeographic = 2
+	rasterPixelIsPoint  = 2
+	userDefinedGeoKey   = 32767
+)
+
+// maxTagValueBytes 单个标签值的读取上限，防止损坏的文件声明超大数组
+const maxTagValueBytes = 16 << 20
+
+var errNotTIFF = errors.New("not a TIFF file")
+
+// tiffTypeSizes TIFF 字段类型对应的字节数 (BigTIFF 新增 16/17/18)
+var tiffTypeSizes = map[uint16]int{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8, 16: 8, 17: 8, 18: 8,
+}
+
+// tiffEntry IFD 中的一个标签及其原始值
+type tiffEntry struct {
+	typ   uint16
+	count uint64
+	raw   []byte
+}
+
+// tiffFile 一个 IFD 中的标签
+type tiffFile struct {
+	order binary.ByteOrder
+	big   bool
+	tags  map[uint16]tiffEntry
+	next  uint64 // 下一个 IFD 的偏移，0 表示没有
+}
+
+// readTIFF 解析文件头与首个 IFD (支持经典 TIFF 与 BigTIFF)，只读取标签值，不读取像素
+func readTIFF(r io.ReaderAt) (*tiffFile, error) {
+	head := make([]byte, 16)
+	if _, err := r.ReadAt(head, 0); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	var order binary.ByteOrder
+	switch string(head[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, errNotTIFF
+	}
+
+	var big bool
+	var ifd uint64
+	switch order.Uint16(head[2:]) {
+	case 42:
+		ifd = uint64(order.Uint32(head[4:]))
+	case 43:
+		big = true
+		ifd = order.Uint64(head[8:])
+	default:
+		return nil, errNotTIFF
+	}
+	return readIFD(r, order, big, ifd)
+}
+
+// readIFD 解析位于 ifd 偏移处的 IFD，并记录下一个 IFD 的偏移 (概视图、掩膜或多页)
+func readIFD(r io.ReaderAt, order binary.ByteOrder, big bool, ifd uint64) (*tiffFile, error) {
+	t := &tiffFile{order: order, big: big, tags: make(map[uint16]tiffEntry)}
+	countSize, entrySize, inline := 2, 12, 4
+	if big {
+		countSize, entrySize, inline = 8, 20, 8
+	}
+	buf := make([]byte, countSize)
+	if _, err := r.ReadAt(buf, int64(ifd)); err != nil {
+		return nil, fmt.Errorf("read IFD: %w", err)
+	}
+	var n uint64
+	if big {
+		n = t.order.Uint64(buf)
+	} else {
+		n = uint64(t.order.Uint16(buf))
+	}
+	if n == 0 || n > 4096 {
+		return nil, fmt.Errorf("invalid IFD entry count %d", n)
+	}
+
+	entries := make([]byte, int(n)*entrySize)
+	if _, err := r.ReadAt(entries, int64(ifd)+int64(countSize)); err != nil {
+		return nil, fmt.Errorf("read IFD: %w", err)
+	}
+	for i := 0; i < int(n); i++ {
+		e := entries[i*entrySize : (i+1)*entrySize]
+		tag, typ := t.order.Uint16(e), t.order.Uint16(e[2:])
+		size, ok := tiffTypeSizes[typ]
+		if !ok {
+			continue
+		}
+		var count uint64
+		var value []byte
+		if big {
+			count, value = t.order.Uint64(e[4:]), e[12:20]
+		} else {
+			count, value = uint64(t.order.Uint32(e[4:])), e[8:12]
+		}
+		if count > maxTagValueBytes/uint64(size) {
+			return nil, fmt.Errorf("tag %d: value too large", tag)
+		}
+		length := int(count) * size
+		raw := make([]byte, length)
+		if length <= inline {
+			copy(raw, value)
+		} else {
+			var off uint64
+			if big {
+				off = t.order.Uint64(value)
+			} else {
+				off = uint64(t.order.Uint32(value))
+			}
+			if _, err := r.ReadAt(raw, int64(off)); err != nil {
+				return nil, fmt.Errorf("tag %d: %w", tag, err)
+			}
+		}
+		t.tags[tag] = tiffEntry{typ: typ, count: count, raw: raw}
+	}
+
+	next := make([]byte, inline)
+	if _, err := r.ReadAt(next, int64(ifd)+int64(countSize)+int64(len(entries))); err == nil {
+		if big {
+			t.next = t.order.Uint64(next)
+		} else {
+			t.next = uint64(t.order.Uint32(next))
+		}
+	}
+	return t, nil
+}
+
+// uints 以无符号整数读取标签值
+func (t *tiffFile) uints(tag uint16) []uint64 {
+	e, ok := t.tags[tag]
+	if !ok {
+		return nil
+	}
+	out := make([]uint64, 0, e.count)
+	for i := 0; i < int(e.count); i++ {
+		switch e.typ {
+		case 1, 6, 7:
+			out = append(out, uint64(e.raw[i]))
+		case 3, 8:
+			out = append(out, uint64(t.order.Uint16(e.raw[i*2:])))
+		case 4, 9:
+			out = append(out, uint64(t.order.Uint32(e.raw[i*4:])))
+		case 16, 17, 18:
+			out = append(out, t.order.Uint64(e.raw[i*8:]))
+		default:
+			return nil
+		}
+	}
+	return out
+}
+
+func (t *tiffFile) uint(tag uint16, def uint64) uint64 {
+	if v := t.uints(tag); len(v) > 0 {
+		return v[0]
+	}
+	return def
+}
+
+// floats 以浮点数读取 DOUBLE/FLOAT 标签值
+func (t *tiffFile) floats(tag uint16) []float64 {
+	e, ok := t.tags[tag]
+	if !ok {
+		return nil
+	}
+	out := make([]float64, 0, e.count)
+	for i := 0; i < int(e.count); i++ {
+		switch e.typ {
+		case 11:
+			out = append(out, float64(math.Float32frombits(t.order.Uint32(e.raw[i*4:]))))
+		case 12:
+			out = append(out, math.Float64frombits(t.order.Uint64(e.raw[i*8:])))
+		default:
+			return nil
+		}
+	}
+	return out
+}
+
+func (t *tiffFile) ascii(tag uint16) string {
+	e, ok := t.tags[tag]
+	if !ok || e.typ != 2 {
+		return ""
+	}
+	return strings.TrimRight(string(e.raw), "\x00")
+}
+
+// geoKeys 解析 GeoKeyDirectory，只保留整数值的键
+func (t *tiffFile) geoKeys() map[uint16]uint64 {
+	dir := t.uints(tagGeoKeyDirectory)
+	if len(dir) < 4 {
+		return nil
+	}
+	keys := make(map[uint16]uint64)
+	for i := 0; i < int(dir[3]) && 4+i*4+3 < len(dir); i++ {
+		k := dir[4+i*4:]
+		// location 为 0 表示值直接存放在目录中
+		if k[1] == 0 && k[2] == 1 {
+			keys[uint16(k[0])] = k[3]
+		}
+	}
+	return keys
+}
+
+// InspectGeoTIFF 提取 GeoTIFF 的尺寸、像元大小、坐标系、范围、波段数与数据类型
+func InspectGeoTIFF(path string) (map[string]any, []string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to open file: %v", err)
+	}
+	defer f.Close()
+
+	t, err := readTIFF(f)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to read TIFF: %v", err)
+	}
+	width, height := t.uint(tagImageWidth, 0), t.uint(tagImageLength, 0)
+	if width == 0 || height == 0 {
+		return nil, nil, fmt.Errorf("Failed to read TIFF: missing image dimensions")
+	}
+
+	bands := t.uint(tagSamplesPerPixel, 1)
+	bits := t.uint(tagBitsPerSample, 1)
+	meta := map[string]any{
+		"width":       width,
+		"height":      height,
+		"band_count":  bands,
+		"data_type":   sampleDataType(t.uint(tagSampleFormat, 1), bits),
+		"compression": compressionName(t.uint(tagCompression, 1)),
+		"tiled":       t.tags[tagTileWidth].count > 0,
+		"driver":      "geotiff-extractor-v1",
+	}
+	if nodata := strings.TrimSpace(t.ascii(tagGDALNoData)); nodata != "" {
+		// 浮点 DEM 常以 "nan" 作为无效值，JSON 无法表示 NaN/Inf，保留原文
+		if v, err := strconv.ParseFloat(nodata, 64); err == nil {
+			if isFinite(v) {
+				meta["nodata"] = v
+			} else {
+				meta["nodata"] = nodata
+			}
+		}
+	}
+
+	var warnings []string
+	keys := t.geoKeys()
+	if keys == nil {
+		warnings = append(warnings, "no GeoTIFF georeferencing found")
+		return meta, warnings, nil
+	}
+
+	// 坐标系
+	epsg := uint64(0)
+	switch keys[keyModelType] {
+	case modelTypeGeographic:
+		meta["model_type"] = "geographic"
+		epsg = keys[keyGeographicType]
+	case modelTypeProjected:
+		meta["model_type"] = "projected"
+		epsg = keys[keyProjectedType]
+	}
+	if epsg != 0 && epsg != userDefinedGeoKey {
+		meta["epsg"] = epsg
+		meta["crs"] = fmt.Sprintf("EPSG:%d", epsg)
+	} else {
+		warnings = append(warnings, "user-defined or missing CRS, EPSG code unknown")
+	}
+
+	// 像元大小与范围 (坐标系单位)
+	bbox, sx, sy, ok := modelExtent(t, float64(width), float64(height), keys[keyRasterType] == rasterPixelIsPoint)
+	if !ok {
+		warnings = append(warnings, "no valid model tiepoint or transformation, extent unknown")
+		return meta, warnings, nil
+	}
+	meta["pixel_size_x"] = sx
+	meta["pixel_size_y"] = sy
+	meta["bbox"] = bbox[:]
+
+	// 经纬度范围与以米计的分辨率，用于按区域与分辨率检索
+	if lonlat, ok := toWGS84(epsg, keys[keyModelType], bbox); ok {
+		meta["bbox_wgs84"] = lonlat[:]
+		res := sy
+		if keys[keyModelType] == modelTypeGeographic {
+			// 按纬线方向把度换算为米 (1° 约 111.32km)
+			res = sy * 111320
+		}
+		meta["resolution_m"] = roundTo(res, 3)
+		meta["resolution"] = strconv.FormatFloat(roundTo(res, 3), 'f', -1, 64) + "m"
+	} else if epsg != 0 && epsg != userDefinedGeoKey {
+		warnings = append(warnings, fmt.Sprintf("EPSG:%d not supported for WGS84 extent", epsg))
+	}
+	return meta, warnings, nil
+}
+
+// modelExtent 由 tiepoint+pixel scale 或仿射变换矩阵计算范围 [minX, minY, maxX, maxY] 与像元大小
+func modelExtent(t *tiffFile, width, height float64, pixelIsPoint bool) ([4]float64, float64, float64, bool) {
+	// 像元坐标到模型坐标的仿射变换 x = a*i + b*j + c, y = d*i + e*j + f
+	var a, b, c, d, e, f float64
+	if m := t.floats(tagModelTransform); len(m) >= 16 {
+		a, b, c, d, e, f = m[0], m[1], m[3], m[4], m[5], m[7]
+	} else {
+		scale, tie := t.floats(tagModelPixelScale), t.floats(tagModelTiepoint)
+		if len(scale) < 2 || len(tie) < 6 {
+			return [4]float64{}, 0, 0, false
+		}
+		a, e = scale[0], -scale[1]
+		c, f = tie[3]-tie[0]*scale[0], tie[4]+tie[1]*scale[1]
+	}
+	// 标签中的 NaN/Inf 使范围无从计算，也无法写入 JSON
+	for _, v := range []float64{a, b, c, d, e, f} {
+		if !isFinite(v) {
+			return [4]float64{}, 0, 0, false
+		}
+	}
+	// PixelIsPoint 时坐标指向像元中心，范围向外扩半个像元
+	off := 0.0
+	if pixelIsPoint {
+		off = -0.5
+	}
+
+	bbox := [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, p := range [][2]float64{{0, 0}, {width, 0}, {0, height}, {width, height}} {
+		i, j := p[0]+off, p[1]+off
+		x, y := a*i+b*j+c, d*i+e*j+f
+		bbox[0], bbox[1] = math.Min(bbox[0], x), math.Min(bbox[1], y)
+		bbox[2], bbox[3] = math.Max(bbox[2], x), math.Max(bbox[3], y)
+	}
+	sx, sy := math.Hypot(a, d), math.Hypot(b, e)
+	// 极大的系数相乘后仍可能溢出为 Inf
+	for _, v := range []float64{bbox[0], bbox[1], bbox[2], bbox[3], sx, sy} {
+		if !isFinite(v) {
+			return [4]float64{}, 0, 0, false
+		}
+	}
+	return bbox, sx, sy, true
+}
+
+// isFinite 判断数值既不是 NaN 也不是 ±Inf
+func isFinite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// toWGS84 把范围换算为经纬度：支持地理坐标系、Web Mercator 与 WGS84 UTM 分带
+func toWGS84(epsg, modelType uint64, bbox [4]float64) ([4]float64, bool) {
+	var conv func(x, y float64) (float64, float64)
+	switch {
+	case modelType == modelTypeGeographic:
+		// 各地理坐标系与 WGS84 的差异远小于检索所需精度
+		conv = func(x, y float64) (float64, float64) { return x, y }
+	case epsg == 3857 || epsg == 900913:
+		conv = mercatorToLonLat
+	case epsg >= 32601 && epsg <= 32660:
+		zone := int(epsg - 32600)
+		conv = func(x, y float64) (float64, float64) { return utmToLonLat(zone, true, x, y) }
+	case epsg >= 32701 && epsg <= 32760:
+		zone := int(epsg - 32700)
+		conv = func(x, y float64) (float64, float64) { return utmToLonLat(zone, false, x, y) }
+	default:
+		return [4]float64{}, false
+	}
+
+	out := [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, p := range [][2]float64{{bbox[0], bbox[1]}, {bbox[2], bbox[1]}, {bbox[0], bbox[3]}, {bbox[2], bbox[3]}} {
+		lon, lat := conv(p[0], p[1])
+		out[0], out[1] = math.Min(out[0], lon), math.Min(out[1], lat)
+		out[2], out[3] = math.Max(out[2], lon), math.Max(out[3], lat)
+	}
+	for i := range out {
+		out[i] = roundTo(out[i], 7)
+	}
+	return out, true
+}
+
+const wgs84A, wgs84F = 6378137.0, 1 / 298.257223563
+
+func mercatorToLonLat(x, y float64) (float64, float64) {
+	lon := x / wgs84A * 180 / math.Pi
+	lat := (2*math.Atan(math.Exp(y/wgs84A)) - math.Pi/2) * 180 / math.Pi
+	return lon, lat
+}
+
+// utmToLonLat UTM 反算 (Snyder 公式)，精度满足范围检索
+func utmToLonLat(zone int, north bool, x, y float64) (float64, float64) {
+	const k0 = 0.9996
+	e2 := wgs84F * (2 - wgs84F)
+	ep2 := e2 / (1 - e2)
+	x -= 500000
+	if !north {
+		y -= 10000000
+	}
+
+	m := y / k0
+	mu := m / (wgs84A * (1 - e2/4 - 3*e2*e2/64 - 5*e2*e2*e2/256))
+	e1 := (1 - math.Sqrt(1-e2)) / (1 + math.Sqrt(1-e2))
+	phi := mu + (3*e1/2-27*e1*e1*e1/32)*math.Sin(2*mu) +
+		(21*e1*e1/16-55*e1*e1*e1*e1/32)*math.Sin(4*mu) +
+		(151*e1*e1*e1/96)*math.Sin(6*mu)
+
+	sin, cos, tan := math.Sin(phi), math.Cos(phi), math.Tan(phi)
+	n := wgs84A / math.Sqrt(1-e2*sin*sin)
+	t := tan * tan
+	c := ep2 * cos * cos
+	r := wgs84A * (1 - e2) / math.Pow(1-e2*sin*sin, 1.5)
+	d := x / (n * k0)
+
+	lat := phi - (n*tan/r)*(d*d/2-(5+3*t+10*c-4*c*c-9*ep2)*d*d*d*d/24+
+		(61+90*t+298*c+45*t*t-252*ep2-3*c*c)*d*d*d*d*d*d/720)
+	lon := (d - (1+2*t+c)*d*d*d/6 + (5-2*c+28*t-3*c*c+8*ep2+24*t*t)*d*d*d*d*d/120) / cos
+	lon0 := float64(zone-1)*6 - 180 + 3
+	return lon0 + lon*180/math.Pi, lat * 180 / math.Pi
+}
+
+func roundTo(v float64, digits int) float64 {
+	p := math.Pow(10, float64(digits))
+	return math.Round(v*p) / p
+}
+
+// sampleDataType 由 SampleFormat 与 BitsPerSample 得到 GDAL 风格的数据类型名
+func sampleDataType(format, bits uint64) string {
+	switch format {
+	case 2:
+		return fmt.Sprintf("int%d", bits)
+	case 3:
+		return fmt.Sprintf("float%d", bits)
+	}
+	return fmt.Sprintf("uint%d", bits)
+}
+
+func compressionName(c uint64) string {
+	switch c {
+	case 1:
+		return "none"
+	case 5:
+		return "lzw"
+	case 7:
+		return "jpeg"
+	case 8, 32946:
+		return "deflate"
+	case 32773:
+		return "packbits"
+	case 50000:
+		return "zstd"
+	}
+	return strconv.FormatUint(c, 10)
+}
@@ -0,0 +1,163 @@
+package processors
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/liny/sim-hub/internal/modules/resource/core"
+	"github.com/stretchr/testify/assert"
+)
+
+// testTag 构造测试文件用的标签，值为 []uint16、[]uint32、[]float64 或 string
+type testTag struct {
+	id  uint16
+	val any
+}
+
+// writeGeoTIFF 写出只有 IFD、没有像素数据的经典小端 TIFF
+func writeGeoTIFF(t *testing.T, tags []testTag) string {
+	return writeTIFFData(t, tags, nil)
+}
+
+// writeTIFFData 写出经典小端 TIFF，像素数据紧跟文件头 (偏移 8)，IFD 位于其后
+func writeTIFFData(t *testing.T, tags []testTag, data []byte) string {
+	base := 8 + len(data)
+	sort.Slice(tags, func(i, j int) bool { return tags[i].id < tags[j].id })
+	le := binary.LittleEndian
+	ifdSize := 2 + len(tags)*12 + 4
+	var ifd, extra bytes.Buffer
+	binary.Write(&ifd, le, uint16(len(tags)))
+	for _, tag := range tags {
+		var typ uint16
+		var raw bytes.Buffer
+		var count int
+		switch v := tag.val.(type) {
+		case []uint16:
+			typ, count = 3, len(v)
+			binary.Write(&raw, le, v)
+		case []uint32:
+			typ, count = 4, len(v)
+			binary.Write(&raw, le, v)
+		case []float64:
+			typ, count = 12, len(v)
+			binary.Write(&raw, le, v)
+		case string:
+			typ, count = 2, len(v)+1
+			raw.WriteString(v + "\x00")
+		}
+		binary.Write(&ifd, le, tag.id)
+		binary.Write(&ifd, le, typ)
+		binary.Write(&ifd, le, uint32(count))
+		if raw.Len() <= 4 {
+			value := make([]byte, 4)
+			copy(value, raw.Bytes())
+			ifd.Write(value)
+		} else {
+			binary.Write(&ifd, le, uint32(base+ifdSize+extra.Len()))
+			extra.Write(raw.Bytes())
+		}
+	}
+	binary.Write(&ifd, le, uint32(0))
+
+	var file bytes.Buffer
+	file.WriteString("II")
+	binary.Write(&file, le, uint16(42))
+	binary.Write(&file, le, uint32(base))
+	file.Write(data)
+	file.Write(ifd.Bytes())
+	file.Write(extra.Bytes())
+
+	path := filepath.Join(t.TempDir(), "terrain.tif")
+	assert.NoError(t, os.WriteFile(path, file.Bytes(), 0o644))
+	return path
+}
+
+func TestGeoTIFFExtractor(t *testing.T) {
+	// 地理坐标系：100x50 像元，0.01° 分辨率，左上角 (120°E, 30°N)
+	path := writeGeoTIFF(t, []testTag{
+		{tagImageWidth, []uint32{100}},
+		{tagImageLength, []uint32{50}},
+		{tagBitsPerSample, []uint16{32}},
+		{tagSampleFormat, []uint16{3}},
+		{tagCompression, []uint16{8}},
+		{tagModelPixelScale, []float64{0.01, 0.01, 0}},
+		{tagModelTiepoint, []float64{0, 0, 0, 120, 30, 0}},
+		{tagGeoKeyDirectory, []uint16{1, 1, 0, 2, keyModelType, 0, 1, modelTypeGeographic, keyGeographicType, 0, 1, 4326}},
+		{tagGDALNoData, "-9999"},
+	})
+	out, err := GeoTIFFExtractor{}.Process(context.Background(), core.ProcessorRequest{FilePath: path}, func(core.ProgressEvent) {})
+	assert.NoError(t, err)
+	assert.Equal(t, core.ProcessorStatusSuccess, out.Status, out.Error)
+	meta := out.Metadata
+	assert.EqualValues(t, 100, meta["width"])
+	assert.EqualValues(t, 50, meta["height"])
+	assert.EqualValues(t, 1, meta["band_count"])
+	assert.Equal(t, "float32", meta["data_type"])
+	assert.Equal(t, "deflate", meta["compression"])
+	assert.Equal(t, "EPSG:4326", meta["crs"])
+	assert.Equal(t, -9999.0, meta["nodata"])
+	assert.InDeltaSlice(t, []float64{120, 29.5, 121, 30}, meta["bbox_wgs84"], 1e-9)
+	assert.Equal(t, "1113.2m", meta["resolution"])
+	assert.Empty(t, out.Warnings)
+
+	// UTM 50N：30m 分辨率，范围换算为经纬度
+	path = writeGeoTIFF(t, []testTag{
+		{tagImageWidth, []uint32{1000}},
+		{tagImageLength, []uint32{1000}},
+		{tagBitsPerSample, []uint16{16, 16, 16}},
+		{tagSamplesPerPixel, []uint16{3}},
+		{tagModelPixelScale, []float64{30, 30, 0}},
+		{tagModelTiepoint, []float64{0, 0, 0, 500000, 3320000, 0}},
+		{tagGeoKeyDirectory, []uint16{1, 1, 0, 2, keyModelType, 0, 1, modelTypeProjected, keyProjectedType, 0, 1, 32650}},
+	})
+	meta, warnings, err := InspectGeoTIFF(path)
+	assert.NoError(t, err)
+	assert.Empty(t, warnings)
+	assert.EqualValues(t, 3, meta["band_count"])
+	assert.Equal(t, "uint16", meta["data_type"])
+	assert.Equal(t, "30m", meta["resolution"])
+	assert.Equal(t, []float64{500000, 3290000, 530000, 3320000}, meta["bbox"])
+	bbox := meta["bbox_wgs84"].([]float64)
+	assert.InDelta(t, 117.0, bbox[0], 1e-3)
+	assert.InDelta(t, 30.0, bbox[3], 0.05)
+	assert.Less(t, math.Abs(bbox[2]-bbox[0]-0.31), 0.01)
+
+	// 浮点 DEM 的 nodata 常为 "nan"，像元大小为 NaN 时范围未知：元数据中不出现 JSON 无法表示的值
+	path = writeGeoTIFF(t, []testTag{
+		{tagImageWidth, []uint32{10}},
+		{tagImageLength, []uint32{10}},
+		{tagModelPixelScale, []float64{math.NaN(), 0.01, 0}},
+		{tagModelTiepoint, []float64{0, 0, 0, 120, 30, 0}},
+		{tagGeoKeyDirectory, []uint16{1, 1, 0, 2, keyModelType, 0, 1, modelTypeGeographic, keyGeographicType, 0, 1, 4326}},
+		{tagGDALNoData, "nan"},
+	})
+	meta, warnings, err = InspectGeoTIFF(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "nan", meta["nodata"])
+	assert.NotContains(t, meta, "bbox")
+	assert.NotContains(t, meta, "pixel_size_x")
+	assert.Equal(t, []string{"no valid model tiepoint or transformation, extent unknown"}, warnings)
+	_, err = json.Marshal(meta)
+	assert.NoError(t, err)
+
+	// 没有地理参考的普通 TIFF 仅报告栅格信息
+	path = writeGeoTIFF(t, []testTag{{tagImageWidth, []uint32{8}}, {tagImageLength, []uint32{8}}})
+	meta, warnings, err = InspectGeoTIFF(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "uint1", meta["data_type"])
+	assert.Equal(t, []string{"no GeoTIFF georeferencing found"}, warnings)
+
+	bad := filepath.Join(t.TempDir(), "bad.tif")
+	assert.NoError(t, os.WriteFile(bad, []byte("not a tiff at all"), 0o644))
+	out, err = GeoTIFFExtractor{}.Process(context.Background(), core.ProcessorRequest{FilePath: bad}, func(core.ProgressEvent) {})
+	assert.NoError(t, err)
+	assert.Equal(t, core.ProcessorStatusFailed, out.Status)
+	assert.Contains(t, out.Error, "not a TIFF file")
+}
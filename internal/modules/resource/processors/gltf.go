@@ -0,0 +1,568 @@
+package processors
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg" // 解码嵌入纹理的尺寸
+	_ "image/png"
+	"io"
+	"io/fs"
+	"math"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/liny/sim-hub/internal/modules/resource/core"
+)
+
+// GLTFExtractorVersion glTF/GLB 元数据提取器版本
+const GLTFExtractorVersion = "1.0.0"
+
+const (
+	glbMagic          = 0x46546C67 // "glTF"
+	glbChunkJSON      = 0x4E4F534A
+	glbChunkBIN       = 0x004E4942
+	maxGLTFJSONBytes  = 64 << 20
+	maxNodeDepth      = 256
+	gltfModeTriangles = 4
+	gltfModeStrip     = 5
+	gltfModeFan       = 6
+)
+
+func init() {
+	// 既可作为 model_glb 类型的处理器，也可作为流水线中的 gltf 阶段
+	core.RegisterProcessor("model_glb", GLTFExtractor{})
+	core.RegisterProcessor("gltf", GLTFExtractor{})
+}
+
+// GLTFExtractor 解析 glTF 2.0 (.gltf 或 .glb) 的结构统计，不解码几何与纹理数据
+type GLTFExtractor struct{}
+
+func (GLTFExtractor) Version() string {
+	return GLTFExtractorVersion
+}
+
+func (GLTFExtractor) Process(ctx context.Context, req core.ProcessorRequest, progress func(core.ProgressEvent)) (*core.ProcessorOutput, error) {
+	progress(core.ProgressEvent{Percent: 0, Message: "parsing model"})
+	meta, warnings, err := InspectGLTF(ctx, req.FilePath)
+	if err != nil {
+		return &core.ProcessorOutput{Status: core.ProcessorStatusFailed, Error: err.Error()}, nil
+	}
+	progress(core.ProgressEvent{Percent: 100, Message: "done"})
+	return &core.ProcessorOutput{Status: core.ProcessorStatusSuccess, Metadata: meta, Warnings: warnings}, nil
+}
+
+// gltfDoc glTF JSON 中用到的部分
+type gltfDoc struct {
+	Asset struct {
+		Version   string `json:"version"`
+		Generator string `json:"generator"`
+	} `json:"asset"`
+	Scene  *int `json:"scene"`
+	Scenes []struct {
+		Nodes []int `json:"nodes"`
+	} `json:"scenes"`
+	Nodes  []gltfNode `json:"nodes"`
+	Meshes []struct {
+		Name       string          `json:"name"`
+		Primitives []gltfPrimitive `json:"primitives"`
+	} `json:"meshes"`
+	Accessors []struct {
+		Count int       `json:"count"`
+		Min   []float64 `json:"min"`
+		Max   []float64 `json:"max"`
+	} `json:"accessors"`
+	BufferViews []struct {
+		Buffer     int   `json:"buffer"`
+		ByteOffset int64 `json:"byteOffset"`
+		ByteLength int64 `json:"byteLength"`
+	} `json:"bufferViews"`
+	Buffers []struct {
+		URI        string `json:"uri"`
+		ByteLength int64  `json:"byteLength"`
+	} `json:"buffers"`
+	Images []struct {
+		Name       string `json:"name"`
+		URI        string `json:"uri"`
+		MimeType   string `json:"mimeType"`
+		BufferView *int   `json:"bufferView"`
+	} `json:"images"`
+	Textures   []json.RawMessage `json:"textures"`
+	Materials  []json.RawMessage `json:"materials"`
+	Animations []struct {
+		Name string `json:"name"`
+	} `json:"animations"`
+}
+
+type gltfNode struct {
+	Children    []int     `json:"children"`
+	Mesh        *int      `json:"mesh"`
+	Matrix      []float64 `json:"matrix"`
+	Translation []float64 `json:"translation"`
+	Rotation    []float64 `json:"rotation"`
+	Scale       []float64 `json:"scale"`
+}
+
+type gltfPrimitive struct {
+	Attributes map[string]int `json:"attributes"`
+	Indices    *int           `json:"indices"`
+	Mode       *int           `json:"mode"`
+}
+
+// gltfAsset 已打开的模型：JSON 文档、GLB 的二进制块与外部资源所在目录
+type gltfAsset struct {
+	doc    gltfDoc
+	format string
+	dir    string
+	file   *os.File
+	bin    *io.SectionReader // GLB 的 BIN 块，.gltf 为空
+}
+
+// openGLTF 打开 .glb 或 .gltf；传入目录时使用其中层级最浅的模型文件 (解压后的模型包)
+func openGLTF(p string) (*gltfAsset, error) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open model: %v", err)
+	}
+	if info.IsDir() {
+		if p, err = findModelFile(p); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open model: %v", err)
+	}
+	asset := &gltfAsset{dir: filepath.Dir(p), file: f, format: "gltf"}
+	var jsonData []byte
+	head := make([]byte, 12)
+	if _, err := io.ReadFull(f, head); err == nil && binary.LittleEndian.Uint32(head) == glbMagic {
+		asset.format = "glb"
+		jsonData, asset.bin, err = readGLBChunks(f, head)
+	} else {
+		jsonData, err = io.ReadAll(io.NewSectionReader(f, 0, maxGLTFJSONBytes+1))
+		if err == nil && len(jsonData) > maxGLTFJSONBytes {
+			err = fmt.Errorf("glTF JSON larger than %d bytes", maxGLTFJSONBytes)
+		}
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("Failed to read model: %v", err)
+	}
+	if err := json.Unmarshal(jsonData, &asset.doc); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("Failed to parse glTF JSON: %v", err)
+	}
+	if !strings.HasPrefix(asset.doc.Asset.Version, "2.") {
+		f.Close()
+		return nil, fmt.Errorf("unsupported glTF version %q", asset.doc.Asset.Version)
+	}
+	return asset, nil
+}
+
+func findModelFile(dir string) (string, error) {
+	var found []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ext := strings.ToLower(filepath.Ext(p)); !d.IsDir() && (ext == ".glb" || ext == ".gltf") {
+			found = append(found, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("Failed to read model dir: %v", err)
+	}
+	if len(found) == 0 {
+		return "", fmt.Errorf("no .glb or .gltf file found")
+	}
+	sort.Slice(found, func(i, j int) bool {
+		di, dj := strings.Count(found[i], string(filepath.Separator)), strings.Count(found[j], string(filepath.Separator))
+		return di < dj || (di == dj && found[i] < found[j])
+	})
+	return found[0], nil
+}
+
+// readGLBChunks 读取 GLB 的 JSON 块，BIN 块只记录位置
+func readGLBChunks(f *os.File, head []byte) ([]byte, *io.SectionReader, error) {
+	if v := binary.LittleEndian.Uint32(head[4:]); v != 2 {
+		return nil, nil, fmt.Errorf("unsupported GLB version %d", v)
+	}
+	length := int64(binary.LittleEndian.Uint32(head[8:]))
+	var jsonData []byte
+	var bin *io.SectionReader
+	for off := int64(12); off+8 <= length; {
+		chunk := make([]byte, 8)
+		if _, err := f.ReadAt(chunk, off); err != nil {
+			return nil, nil, fmt.Errorf("read chunk header: %w", err)
+		}
+		size, typ := int64(binary.LittleEndian.Uint32(chunk)), binary.LittleEndian.Uint32(chunk[4:])
+		if off+8+size > length {
+			return nil, nil, errors.New("truncated GLB chunk")
+		}
+		switch typ {
+		case glbChunkJSON:
+			if size > maxGLTFJSONBytes {
+				return nil, nil, fmt.Errorf("glTF JSON larger than %d bytes", maxGLTFJSONBytes)
+			}
+			jsonData = make([]byte, size)
+			if _, err := f.ReadAt(jsonData, off+8); err != nil {
+				return nil, nil, fmt.Errorf("read JSON chunk: %w", err)
+			}
+		case glbChunkBIN:
+			bin = io.NewSectionReader(f, off+8, size)
+		}
+		off += 8 + size
+	}
+	if jsonData == nil {
+		return nil, nil, errors.New("GLB has no JSON chunk")
+	}
+	return jsonData, bin, nil
+}
+
+// localURI 解析外部资源的本地路径，绝对路径或越出模型目录的 URI 视为非法
+func (a *gltfAsset) localURI(uri string) (string, error) {
+	rel, err := url.PathUnescape(uri)
+	if err != nil {
+		return "", err
+	}
+	if strings.Contains(rel, "://") {
+		return "", fmt.Errorf("uri %q is not a local file", uri)
+	}
+	rel = path.Clean(rel)
+	if path.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("uri %q is outside the model directory", uri)
+	}
+	return filepath.Join(a.dir, filepath.FromSlash(rel)), nil
+}
+
+// openBuffer 返回缓冲区的读取器：GLB 的 BIN 块、data URI 或外部文件
+func (a *gltfAsset) openBuffer(i int) (io.ReaderAt, func(), error) {
+	if i < 0 || i >= len(a.doc.Buffers) {
+		return nil, nil, fmt.Errorf("buffer %d out of range", i)
+	}
+	uri := a.doc.Buffers[i].URI
+	switch {
+	case uri == "" && a.bin != nil:
+		return a.bin, func() {}, nil
+	case strings.HasPrefix(uri, "data:"):
+		data, _, err := decodeDataURI(uri)
+		return bytes.NewReader(data), func() {}, err
+	case uri == "":
+		return nil, nil, fmt.Errorf("buffer %d has no data", i)
+	}
+	p, err := a.localURI(uri)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, func() { f.Close() }, nil
+}
+
+// decodeDataURI 解码 base64 的 data URI，返回数据与 MIME 类型
+func decodeDataURI(uri string) ([]byte, string, error) {
+	header, payload, ok := strings.Cut(strings.TrimPrefix(uri, "data:"), ",")
+	if !ok || !strings.HasSuffix(header, ";base64") {
+		return nil, "", errors.New("unsupported data uri")
+	}
+	data, err := base64.StdEncoding.DecodeString(payload)
+	return data, strings.TrimSuffix(header, ";base64"), err
+}
+
+// InspectGLTF 统计 glTF/GLB 的几何规模、资源数量、包围盒、动画与嵌入纹理，并检查外部 URI 是否存在
+func InspectGLTF(ctx context.Context, p string) (map[string]any, []string, error) {
+	a, err := openGLTF(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer a.file.Close()
+	doc := &a.doc
+
+	var warnings []string
+	// 1. 几何规模：按网格定义统计 (不重复计算实例)
+	var triangles, vertices, primitives int
+	for mi, mesh := range doc.Meshes {
+		for pi, prim := range mesh.Primitives {
+			primitives++
+			pos, ok := prim.Attributes["POSITION"]
+			if !ok || pos < 0 || pos >= len(doc.Accessors) {
+				warnings = append(warnings, fmt.Sprintf("meshes[%d].primitives[%d]: missing POSITION accessor", mi, pi))
+				continue
+			}
+			vertices += doc.Accessors[pos].Count
+			n := doc.Accessors[pos].Count
+			if prim.Indices != nil && *prim.Indices >= 0 && *prim.Indices < len(doc.Accessors) {
+				n = doc.Accessors[*prim.Indices].Count
+			}
+			mode := gltfModeTriangles
+			if prim.Mode != nil {
+				mode = *prim.Mode
+			}
+			switch {
+			case mode == gltfModeTriangles:
+				triangles += n / 3
+			case (mode == gltfModeStrip || mode == gltfModeFan) && n >= 3:
+				triangles += n - 2
+			}
+		}
+	}
+
+	meta := map[string]any{
+		"format":          a.format,
+		"gltf_version":    doc.Asset.Version,
+		"poly_count":      triangles,
+		"triangle_count":  triangles,
+		"vertex_count":    vertices,
+		"mesh_count":      len(doc.Meshes),
+		"primitive_count": primitives,
+		"material_count":  len(doc.Materials),
+		"texture_count":   len(doc.Textures),
+		"image_count":     len(doc.Images),
+		"node_count":      len(doc.Nodes),
+		"animation_count": len(doc.Animations),
+		"driver":          "gltf-extractor-v1",
+	}
+	if doc.Asset.Generator != "" {
+		meta["generator"] = doc.Asset.Generator
+	}
+
+	// 2. 包围盒：场景中各网格的局部包围盒经节点变换后合并
+	bounds, ok, err := a.sceneBounds(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ok {
+		meta["bbox_min"] = roundVec(bounds[0][:])
+		meta["bbox_max"] = roundVec(bounds[1][:])
+		meta["dimensions"] = roundVec([]float64{bounds[1][0] - bounds[0][0], bounds[1][1] - bounds[0][1], bounds[1][2] - bounds[0][2]})
+	}
+
+	names := make([]string, len(doc.Animations))
+	for i, anim := range doc.Animations {
+		names[i] = anim.Name
+		if names[i] == "" {
+			names[i] = fmt.Sprintf("animation_%d", i)
+		}
+	}
+	meta["animations"] = names
+
+	// 3. 嵌入纹理的大小与尺寸，外部资源是否存在
+	textures := []map[string]any{}
+	missing := []string{}
+	for i, img := range doc.Images {
+		switch {
+		case img.BufferView != nil:
+			tex, err := a.bufferViewImage(*img.BufferView)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("images[%d]: %v", i, err))
+				continue
+			}
+			tex["index"], tex["name"], tex["mime_type"] = i, img.Name, img.MimeType
+			textures = append(textures, tex)
+		case strings.HasPrefix(img.URI, "data:"):
+			data, mime, err := decodeDataURI(img.URI)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("images[%d]: %v", i, err))
+				continue
+			}
+			tex := imageInfo(bytes.NewReader(data), int64(len(data)))
+			tex["index"], tex["name"], tex["mime_type"] = i, img.Name, mime
+			textures = append(textures, tex)
+		case img.URI != "":
+			if !a.uriExists(img.URI) {
+				missing = append(missing, img.URI)
+			}
+		}
+	}
+	for _, buf := range doc.Buffers {
+		if buf.URI != "" && !strings.HasPrefix(buf.URI, "data:") && !a.uriExists(buf.URI) {
+			missing = append(missing, buf.URI)
+		}
+	}
+	meta["embedded_textures"] = textures
+	meta["missing_uris"] = missing
+	for _, uri := range missing {
+		warnings = append(warnings, fmt.Sprintf("external resource %q not found", uri))
+	}
+	return meta, warnings, nil
+}
+
+func (a *gltfAsset) uriExists(uri string) bool {
+	p, err := a.localURI(uri)
+	if err != nil {
+		return false
+	}
+	info, err := os.Stat(p)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// bufferViewImage 只读取图片头部获取尺寸
+func (a *gltfAsset) bufferViewImage(i int) (map[string]any, error) {
+	if i < 0 || i >= len(a.doc.BufferViews) {
+		return nil, fmt.Errorf("bufferView %d out of range", i)
+	}
+	bv := a.doc.BufferViews[i]
+	r, closeFn, err := a.openBuffer(bv.Buffer)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFn()
+	return imageInfo(io.NewSectionReader(r, bv.ByteOffset, bv.ByteLength), bv.ByteLength), nil
+}
+
+func imageInfo(r io.Reader, size int64) map[string]any {
+	info := map[string]any{"bytes": size}
+	if cfg, _, err := image.DecodeConfig(r); err == nil {
+		info["width"], info["height"] = cfg.Width, cfg.Height
+	}
+	return info
+}
+
+// mat4 列主序的 4x4 矩阵 (与 glTF 一致)
+type mat4 [16]float64
+
+var identity = mat4{1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1}
+
+func (m mat4) mul(b mat4) mat4 {
+	var out mat4
+	for c := 0; c < 4; c++ {
+		for r := 0; r < 4; r++ {
+			for k := 0; k < 4; k++ {
+				out[c*4+r] += m[k*4+r] * b[c*4+k]
+			}
+		}
+	}
+	return out
+}
+
+func (m mat4) apply(x, y, z float64) [3]float64 {
+	return [3]float64{
+		m[0]*x + m[4]*y + m[8]*z + m[12],
+		m[1]*x + m[5]*y + m[9]*z + m[13],
+		m[2]*x + m[6]*y + m[10]*z + m[14],
+	}
+}
+
+// localMatrix 节点的局部变换：matrix 或 T*R*S
+func (n gltfNode) localMatrix() mat4 {
+	if len(n.Matrix) == 16 {
+		var m mat4
+		copy(m[:], n.Matrix)
+		return m
+	}
+	t, s := [3]float64{}, [3]float64{1, 1, 1}
+	q := [4]float64{0, 0, 0, 1}
+	copy(t[:], n.Translation)
+	copy(s[:], n.Scale)
+	copy(q[:], n.Rotation)
+	x, y, z, w := q[0], q[1], q[2], q[3]
+	return mat4{
+		(1 - 2*(y*y+z*z)) * s[0], 2 * (x*y + z*w) * s[0], 2 * (x*z - y*w) * s[0], 0,
+		2 * (x*y - z*w) * s[1], (1 - 2*(x*x+z*z)) * s[1], 2 * (y*z + x*w) * s[1], 0,
+		2 * (x*z + y*w) * s[2], 2 * (y*z - x*w) * s[2], (1 - 2*(x*x+y*y)) * s[2], 0,
+		t[0], t[1], t[2], 1,
+	}
+}
+
+// meshBounds 网格局部坐标系下的包围盒，取自 POSITION 访问器的 min/max
+func (a *gltfAsset) meshBounds(mi int) ([2][3]float64, bool) {
+	b := [2][3]float64{{math.Inf(1), math.Inf(1), math.Inf(1)}, {math.Inf(-1), math.Inf(-1), math.Inf(-1)}}
+	ok := false
+	for _, prim := range a.doc.Meshes[mi].Primitives {
+		pos, has := prim.Attributes["POSITION"]
+		if !has || pos < 0 || pos >= len(a.doc.Accessors) {
+			continue
+		}
+		acc := a.doc.Accessors[pos]
+		if len(acc.Min) < 3 || len(acc.Max) < 3 {
+			continue
+		}
+		for k := 0; k < 3; k++ {
+			b[0][k], b[1][k] = math.Min(b[0][k], acc.Min[k]), math.Max(b[1][k], acc.Max[k])
+		}
+		ok = true
+	}
+	return b, ok
+}
+
+// sceneBounds 遍历默认场景 (未声明时为首个场景，没有场景时直接合并各网格) 计算世界坐标包围盒。
+// 规范要求节点层级是树，但文件可能含环或重复引用的子节点：每个节点只访问一次，总访问数不超过节点数
+func (a *gltfAsset) sceneBounds(ctx context.Context) ([2][3]float64, bool, error) {
+	doc := &a.doc
+	b := [2][3]float64{{math.Inf(1), math.Inf(1), math.Inf(1)}, {math.Inf(-1), math.Inf(-1), math.Inf(-1)}}
+	found := false
+	include := func(m mat4, mi int) {
+		mb, ok := a.meshBounds(mi)
+		if !ok {
+			return
+		}
+		for c := 0; c < 8; c++ {
+			p := m.apply(mb[c&1][0], mb[c>>1&1][1], mb[c>>2&1][2])
+			for k := 0; k < 3; k++ {
+				b[0][k], b[1][k] = math.Min(b[0][k], p[k]), math.Max(b[1][k], p[k])
+			}
+		}
+		found = true
+	}
+
+	if len(doc.Scenes) == 0 {
+		for mi := range doc.Meshes {
+			include(identity, mi)
+		}
+		return b, found, nil
+	}
+	scene := 0
+	if doc.Scene != nil && *doc.Scene >= 0 && *doc.Scene < len(doc.Scenes) {
+		scene = *doc.Scene
+	}
+	visited := make([]bool, len(doc.Nodes))
+	var walk func(ni int, parent mat4, depth int) error
+	walk = func(ni int, parent mat4, depth int) error {
+		if ni < 0 || ni >= len(doc.Nodes) || visited[ni] || depth > maxNodeDepth {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		visited[ni] = true
+		n := doc.Nodes[ni]
+		m := parent.mul(n.localMatrix())
+		if n.Mesh != nil && *n.Mesh >= 0 && *n.Mesh < len(doc.Meshes) {
+			include(m, *n.Mesh)
+		}
+		for _, child := range n.Children {
+			if err := walk(child, m, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, ni := range doc.Scenes[scene].Nodes {
+		if err := walk(ni, identity, 0); err != nil {
+			return b, false, err
+		}
+	}
+	return b, found, nil
+}
+
+func roundVec(v []float64) []float64 {
+	out := make([]float64, len(v))
+	for i, x := range v {
+		out[i] = roundTo(x, 6)
+	}
+	return out
+}
@@ -0,0 +1,137 @@
+package processors
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/liny/sim-hub/internal/modules/resource/core"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeGLB 以给定的 JSON 文档与 BIN 块写出 GLB 文件
+func writeGLB(t *testing.T, doc map[string]any, bin []byte) string {
+	jsonData, err := json.Marshal(doc)
+	assert.NoError(t, err)
+	for len(jsonData)%4 != 0 {
+		jsonData = append(jsonData, ' ')
+	}
+	for len(bin)%4 != 0 {
+		bin = append(bin, 0)
+	}
+	var buf bytes.Buffer
+	le := binary.LittleEndian
+	binary.Write(&buf, le, uint32(glbMagic))
+	binary.Write(&buf, le, uint32(2))
+	binary.Write(&buf, le, uint32(12+8+len(jsonData)+8+len(bin)))
+	binary.Write(&buf, le, uint32(len(jsonData)))
+	binary.Write(&buf, le, uint32(glbChunkJSON))
+	buf.Write(jsonData)
+	binary.Write(&buf, le, uint32(len(bin)))
+	binary.Write(&buf, le, uint32(glbChunkBIN))
+	buf.Write(bin)
+
+	path := filepath.Join(t.TempDir(), "model.glb")
+	assert.NoError(t, os.WriteFile(path, buf.Bytes(), 0o644))
+	return path
+}
+
+func TestGLTFExtractor(t *testing.T) {
+	var texture bytes.Buffer
+	assert.NoError(t, png.Encode(&texture, image.NewRGBA(image.Rect(0, 0, 64, 32))))
+
+	// 一个单位立方体网格被两个节点引用：原点处，以及平移 (10,0,0) 并放大 2 倍
+	doc := map[string]any{
+		"asset":  map[string]any{"version": "2.0", "generator": "test"},
+		"scene":  0,
+		"scenes": []any{map[string]any{"nodes": []int{0, 1}}},
+		"nodes": []any{
+			map[string]any{"mesh": 0},
+			map[string]any{"mesh": 0, "translation": []float64{10, 0, 0}, "scale": []float64{2, 2, 2}},
+		},
+		"meshes": []any{map[string]any{"primitives": []any{
+			map[string]any{"attributes": map[string]int{"POSITION": 0}, "indices": 1},
+		}}},
+		"accessors": []any{
+			map[string]any{"count": 8, "min": []float64{-0.5, -0.5, -0.5}, "max": []float64{0.5, 0.5, 0.5}},
+			map[string]any{"count": 36},
+		},
+		"bufferViews": []any{map[string]any{"buffer": 0, "byteOffset": 0, "byteLength": texture.Len()}},
+		"buffers":     []any{map[string]any{"byteLength": texture.Len()}},
+		"images":      []any{map[string]any{"name": "albedo", "mimeType": "image/png", "bufferView": 0}},
+		"textures":    []any{map[string]any{"source": 0}},
+		"materials":   []any{map[string]any{"name": "hull"}},
+		"animations":  []any{map[string]any{"name": "rotor"}, map[string]any{}},
+	}
+	path := writeGLB(t, doc, texture.Bytes())
+
+	out, err := GLTFExtractor{}.Process(context.Background(), core.ProcessorRequest{FilePath: path}, func(core.ProgressEvent) {})
+	assert.NoError(t, err)
+	assert.Equal(t, core.ProcessorStatusSuccess, out.Status, out.Error)
+	meta := out.Metadata
+	assert.Equal(t, "glb", meta["format"])
+	assert.Equal(t, 12, meta["poly_count"])
+	assert.Equal(t, 8, meta["vertex_count"])
+	assert.Equal(t, 1, meta["mesh_count"])
+	assert.Equal(t, 1, meta["material_count"])
+	assert.Equal(t, 1, meta["texture_count"])
+	assert.Equal(t, []string{"rotor", "animation_1"}, meta["animations"])
+	assert.Equal(t, []float64{-0.5, -1, -1}, meta["bbox_min"])
+	assert.Equal(t, []float64{11, 1, 1}, meta["bbox_max"])
+	assert.Equal(t, []float64{11.5, 2, 2}, meta["dimensions"])
+	textures := meta["embedded_textures"].([]map[string]any)
+	assert.Len(t, textures, 1)
+	assert.Equal(t, 64, textures[0]["width"])
+	assert.Equal(t, 32, textures[0]["height"])
+	assert.EqualValues(t, texture.Len(), textures[0]["bytes"])
+	assert.Empty(t, out.Warnings)
+
+	// .gltf 引用的外部文件缺失时记录在 missing_uris 中
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "mesh.bin"), make([]byte, 96), 0o644))
+	gltf, _ := json.Marshal(map[string]any{
+		"asset":   map[string]any{"version": "2.0"},
+		"buffers": []any{map[string]any{"uri": "mesh.bin", "byteLength": 96}},
+		"images":  []any{map[string]any{"uri": "textures/diffuse%20map.png"}, map[string]any{"uri": "../../etc/passwd"}},
+	})
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "scene.gltf"), gltf, 0o644))
+	meta, warnings, err := InspectGLTF(context.Background(), dir)
+	assert.NoError(t, err)
+	assert.Equal(t, "gltf", meta["format"])
+	assert.Equal(t, []string{"textures/diffuse%20map.png", "../../etc/passwd"}, meta["missing_uris"])
+	assert.Len(t, warnings, 2)
+
+	// 含环与重复子节点的节点图：每个节点只计入一次，取消时及时返回
+	cyclic := map[string]any{
+		"asset":  map[string]any{"version": "2.0"},
+		"scenes": []any{map[string]any{"nodes": []int{0, 0}}},
+		"nodes": []any{
+			map[string]any{"mesh": 0, "children": []int{0, 0, 1}},
+			map[string]any{"mesh": 0, "translation": []float64{1, 0, 0}, "children": []int{0, 1, 1}},
+		},
+		"meshes":    []any{map[string]any{"primitives": []any{map[string]any{"attributes": map[string]int{"POSITION": 0}}}}},
+		"accessors": []any{map[string]any{"count": 8, "min": []float64{0, 0, 0}, "max": []float64{1, 1, 1}}},
+	}
+	path = writeGLB(t, cyclic, nil)
+	meta, _, err = InspectGLTF(context.Background(), path)
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{0, 0, 0}, meta["bbox_min"])
+	assert.Equal(t, []float64{2, 1, 1}, meta["bbox_max"])
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = InspectGLTF(canceled, path)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	bad := filepath.Join(t.TempDir(), "bad.glb")
+	assert.NoError(t, os.WriteFile(bad, []byte(`{"asset":{"version":"1.0"}}`), 0o644))
+	out, err = GLTFExtractor{}.Process(context.Background(), core.ProcessorRequest{FilePath: bad}, func(core.ProgressEvent) {})
+	assert.NoError(t, err)
+	assert.Equal(t, core.ProcessorStatusFailed, out.Status)
+	assert.Contains(t, out.Error, "unsupported glTF version")
+}
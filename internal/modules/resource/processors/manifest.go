@@ -0,0 +1,101 @@
+package processors
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/liny/sim-hub/internal/modules/resource/core"
+)
+
+// ManifestBuilderVersion 文件清单生成器版本
+const ManifestBuilderVersion = "1.0.0"
+
+const manifestFile = "manifest.json"
+
+func init() {
+	core.RegisterProcessor("manifest", ManifestBuilder{})
+}
+
+// ManifestBuilder 为 ZIP 包或解压后的目录生成逐文件清单 (路径、大小、CRC32)，
+// 供版本比较使用。ZIP 直接取中央目录记录的 CRC32，目录输入逐个文件计算，两者结果一致
+type ManifestBuilder struct{}
+
+func (ManifestBuilder) Version() string {
+	return ManifestBuilderVersion
+}
+
+func (ManifestBuilder) Process(ctx context.Context, req core.ProcessorRequest, progress func(core.ProgressEvent)) (*core.ProcessorOutput, error) {
+	progress(core.ProgressEvent{Percent: 0, Message: "listing files"})
+	m, err := BuildManifest(ctx, req.FilePath, func(percent float64, msg string) {
+		progress(core.ProgressEvent{Percent: percent, Message: msg})
+	})
+	if err != nil {
+		return &core.ProcessorOutput{Status: core.ProcessorStatusFailed, Error: err.Error()}, nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(req.OutputDir, manifestFile), data, 0o644); err != nil {
+		return nil, err
+	}
+	progress(core.ProgressEvent{Percent: 100, Message: "done"})
+	return &core.ProcessorOutput{
+		Status:     core.ProcessorStatusSuccess,
+		Renditions: []core.RenditionSpec{{Path: manifestFile, Role: "manifest", ContentType: "application/json"}},
+	}, nil
+}
+
+// BuildManifest 列出包内全部普通文件，按路径排序，progress 可为 nil
+func BuildManifest(ctx context.Context, p string, progress func(percent float64, msg string)) (*core.FileManifest, error) {
+	pkg, err := openScenarioPackage(p)
+	if err != nil {
+		return nil, err
+	}
+	defer pkg.close()
+
+	names := append([]string(nil), pkg.files...)
+	sort.Strings(names)
+	m := &core.FileManifest{Files: make([]core.ManifestFile, 0, len(names))}
+	for i, name := range names {
+		if i > 0 && names[i-1] == name {
+			continue // ZIP 中重复的条目只记一次
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		crc, ok := pkg.crcs[name]
+		if !ok {
+			if crc, err = checksumFile(pkg, name); err != nil {
+				return nil, fmt.Errorf("checksum %s: %v", name, err)
+			}
+		}
+		size := uint64(pkg.sizes[name])
+		m.Files = append(m.Files, core.ManifestFile{Path: name, Size: size, CRC32: crc})
+		m.TotalSize += size
+		if progress != nil && i%1000 == 999 {
+			progress(float64(i+1)*100/float64(len(names)), "listing files")
+		}
+	}
+	m.FilesCount = len(m.Files)
+	return m, nil
+}
+
+func checksumFile(pkg *scenarioPackage, name string) (uint32, error) {
+	rc, err := pkg.open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+	h := crc32.NewIEEE()
+	if _, err := io.Copy(h, rc); err != nil {
+		return 0, err
+	}
+	return h.Sum32(), nil
+}
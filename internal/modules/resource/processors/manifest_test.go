@@ -0,0 +1,51 @@
+package processors
+
+import (
+	"context"
+	"encoding/json"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/liny/sim-hub/internal/modules/resource/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManifestBuilder(t *testing.T) {
+	files := map[string]string{
+		"demo/scenario.json":  demoScenario,
+		"demo/models/ddg.glb": "glTF",
+		"demo/readme.txt":     "hello",
+	}
+	outDir := t.TempDir()
+	out, err := ManifestBuilder{}.Process(context.Background(), core.ProcessorRequest{FilePath: writeZip(t, files), OutputDir: outDir}, func(core.ProgressEvent) {})
+	assert.NoError(t, err)
+	assert.Equal(t, core.ProcessorStatusSuccess, out.Status, out.Error)
+	assert.Equal(t, []core.RenditionSpec{{Path: "manifest.json", Role: "manifest", ContentType: "application/json"}}, out.Renditions)
+
+	raw, err := os.ReadFile(filepath.Join(outDir, "manifest.json"))
+	assert.NoError(t, err)
+	var m core.FileManifest
+	assert.NoError(t, json.Unmarshal(raw, &m))
+	assert.Equal(t, 3, m.FilesCount)
+	assert.EqualValues(t, len(demoScenario)+len("glTF")+len("hello"), m.TotalSize)
+	assert.Equal(t, core.ManifestFile{Path: "demo/models/ddg.glb", Size: 4, CRC32: crc32.ChecksumIEEE([]byte("glTF"))}, m.Files[0])
+	assert.Equal(t, "demo/readme.txt", m.Files[1].Path)
+	assert.Equal(t, "demo/scenario.json", m.Files[2].Path)
+
+	// Worker 解压后的目录得到相同的清单
+	dir := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		assert.NoError(t, os.WriteFile(p, []byte(content), 0o644))
+	}
+	fromDir, err := BuildManifest(context.Background(), dir, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, &m, fromDir)
+
+	out, err = ManifestBuilder{}.Process(context.Background(), core.ProcessorRequest{FilePath: filepath.Join(t.TempDir(), "missing.zip"), OutputDir: outDir}, func(core.ProgressEvent) {})
+	assert.NoError(t, err)
+	assert.Equal(t, core.ProcessorStatusFailed, out.Status)
+}
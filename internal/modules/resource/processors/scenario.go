@@ -0,0 +1,408 @@
+// Package processors 内置的进程内处理器，导入即注册到 Worker
+package processors
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/liny/sim-hub/internal/modules/resource/core"
+)
+
+// ScenarioInspectorVersion 想定包检查器版本，进程内处理器与 drivers 下的外部处理器共用
+const ScenarioInspectorVersion = "2.1.0"
+
+const (
+	scenarioConfigName     = "scenario.json"
+	maxScenarioConfigBytes = 16 << 20
+	maxListedEntities      = 500 // 元数据中列出的参与实体上限，完整数量见 entities_count
+	maxPackageIssues       = 20
+)
+
+func init() {
+	core.RegisterProcessor("scenario", ScenarioInspector{})
+}
+
+// ScenarioInspector 检查想定包 (ZIP 或解压后的目录) 的布局并解析 scenario.json
+type ScenarioInspector struct{}
+
+func (ScenarioInspector) Version() string {
+	return ScenarioInspectorVersion
+}
+
+func (ScenarioInspector) Process(ctx context.Context, req core.ProcessorRequest, progress func(core.ProgressEvent)) (*core.ProcessorOutput, error) {
+	meta, err := InspectScenario(req.FilePath, func(percent float64, msg string) {
+		progress(core.ProgressEvent{Percent: percent, Message: msg})
+	})
+	if err != nil {
+		return &core.ProcessorOutput{Status: core.ProcessorStatusFailed, Error: err.Error()}, nil
+	}
+	return &core.ProcessorOutput{Status: core.ProcessorStatusSuccess, Metadata: meta}, nil
+}
+
+// scenarioConfig scenario.json 的结构
+//
+//	{
+//	  "title": "红蓝对抗演练",
+//	  "engine": "simengine-3",
+//	  "duration": 5400,                  // 秒，或 "1h30m"
+//	  "terrain": "terrain/east-coast.tif", // 带扩展名的引用指向包内文件，否则为资源标识
+//	  "area": [119.5, 24.0, 122.0, 26.5],  // 可选，想定区域 [minLon, minLat, maxLon, maxLat]，用于空间检索
+//	  "entities": [
+//	    {"id": "blue-1", "name": "驱逐舰", "type": "ship", "side": "blue", "model": "models/ddg.glb"}
+//	  ]
+//	}
+type scenarioConfig struct {
+	Title    string           `json:"title"`
+	Engine   string           `json:"engine"`
+	Duration json.RawMessage  `json:"duration"`
+	Terrain  string           `json:"terrain"`
+	Area     []float64        `json:"area"`
+	Entities []scenarioEntity `json:"entities"`
+}
+
+type scenarioEntity struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Side  string `json:"side"`
+	Model string `json:"model"`
+}
+
+// PackageIssue 想定包中的一处问题
+type PackageIssue struct {
+	Path    string // 包内文件路径
+	Field   string // scenario.json 中的字段，如 entities[2].id
+	Message string
+}
+
+func (i PackageIssue) String() string {
+	loc := i.Path
+	if i.Field != "" {
+		loc += ": " + i.Field
+	}
+	if loc == "" {
+		return i.Message
+	}
+	return loc + ": " + i.Message
+}
+
+// PackageError 想定包不合法，列出发现的全部问题 (最多 maxPackageIssues 条)
+type PackageError struct {
+	Issues []PackageIssue
+}
+
+func (e *PackageError) Error() string {
+	parts := make([]string, len(e.Issues))
+	for i, issue := range e.Issues {
+		parts[i] = issue.String()
+	}
+	return "invalid scenario package: " + strings.Join(parts, "; ")
+}
+
+func (e *PackageError) add(p, field, format string, args ...any) {
+	if len(e.Issues) < maxPackageIssues {
+		e.Issues = append(e.Issues, PackageIssue{Path: p, Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+}
+
+// scenarioPackage 想定包的文件清单，屏蔽 ZIP 与目录的差异
+type scenarioPackage struct {
+	files []string // 以 / 分隔的包内路径，仅包含普通文件
+	sizes map[string]int64
+	crcs  map[string]uint32 // ZIP 中央目录记录的 CRC32，目录输入时为 nil
+	open  func(name string) (io.ReadCloser, error)
+	close func() error
+}
+
+// openScenarioPackage 打开 ZIP 文件，或 Worker 解压后的目录
+func openScenarioPackage(p string) (*scenarioPackage, error) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open package: %v", err)
+	}
+	if info.IsDir() {
+		pkg := &scenarioPackage{sizes: make(map[string]int64), close: func() error { return nil }}
+		root := os.DirFS(p)
+		err := fs.WalkDir(root, ".", func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.Type().IsRegular() {
+				info, err := d.Info()
+				if err != nil {
+					return err
+				}
+				pkg.files = append(pkg.files, name)
+				pkg.sizes[name] = info.Size()
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read package dir: %v", err)
+		}
+		pkg.open = func(name string) (io.ReadCloser, error) { return root.Open(name) }
+		return pkg, nil
+	}
+
+	r, err := zip.OpenReader(p)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open zip: %v", err)
+	}
+	pkg := &scenarioPackage{sizes: make(map[string]int64), crcs: make(map[string]uint32), close: r.Close}
+	entries := make(map[string]*zip.File)
+	for _, f := range r.File {
+		if f.Mode().IsRegular() {
+			name := strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(f.Name, `\`, "/")), "/")
+			pkg.files = append(pkg.files, name)
+			pkg.sizes[name] = int64(f.UncompressedSize64)
+			pkg.crcs[name] = f.CRC32
+			entries[name] = f
+		}
+	}
+	pkg.open = func(name string) (io.ReadCloser, error) {
+		f, ok := entries[name]
+		if !ok {
+			return nil, fs.ErrNotExist
+		}
+		return f.Open()
+	}
+	return pkg, nil
+}
+
+// InspectScenario 检查想定包并从 scenario.json 提取元数据，progress 可为 nil；
+// 包不合法时返回 *PackageError
+func InspectScenario(p string, progress func(percent float64, msg string)) (map[string]any, error) {
+	if progress == nil {
+		progress = func(float64, string) {}
+	}
+
+	progress(0, "opening package")
+	pkg, err := openScenarioPackage(p)
+	if err != nil {
+		return nil, err
+	}
+	defer pkg.close()
+
+	// 1. 布局：包内有且只有一个 scenario.json，其所在目录为想定根目录
+	progress(10, "checking layout")
+	perr := &PackageError{}
+	files := make(map[string]bool, len(pkg.files))
+	var configs []string
+	for _, name := range pkg.files {
+		files[name] = true
+		if path.Base(name) == scenarioConfigName {
+			configs = append(configs, name)
+		}
+	}
+	switch len(configs) {
+	case 0:
+		perr.add("", "", "%s not found", scenarioConfigName)
+		return nil, perr
+	case 1:
+	default:
+		sort.Strings(configs)
+		perr.add("", "", "multiple %s found: %s", scenarioConfigName, strings.Join(configs, ", "))
+		return nil, perr
+	}
+	configPath := configs[0]
+	root := path.Dir(configPath)
+
+	// 2. 解析 scenario.json
+	progress(30, "parsing "+scenarioConfigName)
+	cfg, err := readScenarioConfig(pkg, configPath)
+	if err != nil {
+		perr.add(configPath, "", "%v", err)
+		return nil, perr
+	}
+
+	// 3. 校验字段并收集引用
+	progress(60, "validating references")
+	if strings.TrimSpace(cfg.Title) == "" {
+		perr.add(configPath, "title", "required")
+	}
+	if strings.TrimSpace(cfg.Engine) == "" {
+		perr.add(configPath, "engine", "required")
+	}
+	duration, err := parseScenarioDuration(cfg.Duration)
+	if err != nil {
+		perr.add(configPath, "duration", "%v", err)
+	}
+
+	modelRefs, terrainRefs := newRefSet(), newRefSet()
+	checkRef := func(field, ref string, refs *refSet) {
+		if ref == "" {
+			return
+		}
+		if path.Ext(ref) == "" {
+			// 无扩展名的引用为平台中的资源标识
+			refs.add(ref)
+			return
+		}
+		rel := path.Clean(ref)
+		if path.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, "../") {
+			perr.add(configPath, field, "reference %q must be relative to the package", ref)
+			return
+		}
+		if !files[path.Join(root, rel)] {
+			perr.add(configPath, field, "referenced file %q not found in package", ref)
+			return
+		}
+		refs.add(rel)
+	}
+	checkRef("terrain", cfg.Terrain, terrainRefs)
+	if cfg.Area != nil && !validArea(cfg.Area) {
+		perr.add(configPath, "area", "expected [minLon, minLat, maxLon, maxLat] in WGS84 degrees")
+	}
+
+	seen := make(map[string]bool, len(cfg.Entities))
+	entities := make([]map[string]any, 0, min(len(cfg.Entities), maxListedEntities))
+	sides := newRefSet()
+	for i, e := range cfg.Entities {
+		field := fmt.Sprintf("entities[%d]", i)
+		switch {
+		case e.ID == "":
+			perr.add(configPath, field+".id", "required")
+		case seen[e.ID]:
+			perr.add(configPath, field+".id", "duplicate id %q", e.ID)
+		}
+		seen[e.ID] = true
+		checkRef(field+".model", e.Model, modelRefs)
+		if e.Side != "" {
+			sides.add(e.Side)
+		}
+		if len(entities) < maxListedEntities {
+			entity := map[string]any{"id": e.ID}
+			for k, v := range map[string]string{"name": e.Name, "type": e.Type, "side": e.Side, "model": e.Model} {
+				if v != "" {
+					entity[k] = v
+				}
+			}
+			entities = append(entities, entity)
+		}
+	}
+	if len(perr.Issues) > 0 {
+		return nil, perr
+	}
+
+	progress(100, "done")
+	meta := map[string]any{
+		"title":          cfg.Title,
+		"engine":         cfg.Engine,
+		"files_count":    len(pkg.files),
+		"has_config":     true,
+		"scenario_root":  root,
+		"entities_count": len(cfg.Entities),
+		"entities":       entities,
+		"sides":          sides.list(),
+		"model_refs":     modelRefs.list(),
+		"terrain_refs":   terrainRefs.list(),
+		"driver":         "scenario-inspector-v2",
+	}
+	if duration > 0 {
+		meta["duration_s"] = int64(duration / time.Second)
+	}
+	if cfg.Area != nil {
+		meta["bbox_wgs84"] = cfg.Area
+	}
+	if len(cfg.Entities) > maxListedEntities {
+		meta["entities_truncated"] = true
+	}
+	return meta, nil
+}
+
+// readScenarioConfig 读取并严格解析 scenario.json，错误信息带有出错位置
+func readScenarioConfig(pkg *scenarioPackage, name string) (*scenarioConfig, error) {
+	rc, err := pkg.open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, maxScenarioConfigBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxScenarioConfigBytes {
+		return nil, fmt.Errorf("larger than %d bytes", maxScenarioConfigBytes)
+	}
+
+	var cfg scenarioConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &syntaxErr):
+			line := bytes.Count(data[:syntaxErr.Offset], []byte("\n")) + 1
+			return nil, fmt.Errorf("invalid JSON at line %d: %v", line, syntaxErr)
+		case errors.As(err, &typeErr):
+			return nil, fmt.Errorf("field %s: expected %s, got %s", typeErr.Field, typeErr.Type, typeErr.Value)
+		}
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	return &cfg, nil
+}
+
+// parseScenarioDuration 时长可为秒数或 Go 时长字符串 ("1h30m")，未设置时返回 0
+func parseScenarioDuration(raw json.RawMessage) (time.Duration, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return 0, nil
+	}
+	var seconds float64
+	if err := json.Unmarshal(raw, &seconds); err == nil {
+		if seconds <= 0 {
+			return 0, fmt.Errorf("must be positive")
+		}
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return 0, fmt.Errorf("expected seconds or duration string")
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("must be positive")
+	}
+	return d, nil
+}
+
+// validArea 校验想定区域的经纬度范围 (不支持跨越 180° 经线)
+func validArea(a []float64) bool {
+	return len(a) == 4 && a[0] >= -180 && a[2] <= 180 && a[1] >= -90 && a[3] <= 90 && a[0] <= a[2] && a[1] <= a[3]
+}
+
+// refSet 去重并保持首次出现顺序的字符串集合
+type refSet struct {
+	seen  map[string]bool
+	items []string
+}
+
+func newRefSet() *refSet {
+	return &refSet{seen: make(map[string]bool)}
+}
+
+func (s *refSet) add(v string) {
+	if !s.seen[v] {
+		s.seen[v] = true
+		s.items = append(s.items, v)
+	}
+}
+
+func (s *refSet) list() []string {
+	if s.items == nil {
+		return []string{}
+	}
+	return s.items
+}
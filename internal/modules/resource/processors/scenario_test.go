@@ -0,0 +1,127 @@
+package processors
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/liny/sim-hub/internal/modules/resource/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeZip(t *testing.T, files map[string]string) string {
+	path := filepath.Join(t.TempDir(), "demo.zip")
+	f, err := os.Create(path)
+	assert.NoError(t, err)
+	zw := zip.NewWriter(f)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		assert.NoError(t, err)
+		w.Write([]byte(content))
+	}
+	assert.NoError(t, zw.Close())
+	assert.NoError(t, f.Close())
+	return path
+}
+
+const demoScenario = `{
+  "title": "Strait Exercise",
+  "engine": "simengine-3",
+  "duration": "1h30m",
+  "terrain": "terrain-east-coast",
+  "area": [119.5, 24.0, 122.0, 26.5],
+  "entities": [
+    {"id": "blue-1", "name": "DDG", "type": "ship", "side": "blue", "model": "models/ddg.glb"},
+    {"id": "red-1", "type": "aircraft", "side": "red", "model": "model-j10"}
+  ]
+}`
+
+func TestScenarioInspector(t *testing.T) {
+	path := writeZip(t, map[string]string{
+		"demo/scenario.json":   demoScenario,
+		"demo/models/ddg.glb":  "glTF",
+		"demo/terrain/hm.tif":  "II*",
+		"demo/scripts/init.py": "",
+	})
+
+	var events []core.ProgressEvent
+	out, err := ScenarioInspector{}.Process(context.Background(), core.ProcessorRequest{FilePath: path}, func(ev core.ProgressEvent) {
+		events = append(events, ev)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, core.ProcessorStatusSuccess, out.Status)
+	meta := out.Metadata
+	assert.Equal(t, "Strait Exercise", meta["title"])
+	assert.Equal(t, "simengine-3", meta["engine"])
+	assert.EqualValues(t, 5400, meta["duration_s"])
+	assert.Equal(t, 4, meta["files_count"])
+	assert.Equal(t, "demo", meta["scenario_root"])
+	assert.Equal(t, 2, meta["entities_count"])
+	assert.Equal(t, []string{"blue", "red"}, meta["sides"])
+	assert.Equal(t, []string{"models/ddg.glb", "model-j10"}, meta["model_refs"])
+	assert.Equal(t, []string{"terrain-east-coast"}, meta["terrain_refs"])
+	assert.Equal(t, []float64{119.5, 24.0, 122.0, 26.5}, meta["bbox_wgs84"])
+	assert.Equal(t, float64(100), events[len(events)-1].Percent)
+
+	// Worker 解压后的目录同样可以检查
+	dir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "models"), 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "scenario.json"), []byte(demoScenario), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "models", "ddg.glb"), []byte("glTF"), 0o644))
+	meta, err = InspectScenario(dir, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, ".", meta["scenario_root"])
+
+	out, err = ScenarioInspector{}.Process(context.Background(), core.ProcessorRequest{FilePath: filepath.Join(t.TempDir(), "missing.zip")}, func(core.ProgressEvent) {})
+	assert.NoError(t, err)
+	assert.Equal(t, core.ProcessorStatusFailed, out.Status)
+	assert.Contains(t, out.Error, "Failed to open package")
+}
+
+func TestScenarioInspectorMalformed(t *testing.T) {
+	cases := map[string]struct {
+		files  map[string]string
+		issues []string
+	}{
+		"missing config": {
+			files:  map[string]string{"readme.txt": ""},
+			issues: []string{"scenario.json not found"},
+		},
+		"multiple configs": {
+			files:  map[string]string{"a/scenario.json": "{}", "b/scenario.json": "{}"},
+			issues: []string{"multiple scenario.json found: a/scenario.json, b/scenario.json"},
+		},
+		"syntax error": {
+			files:  map[string]string{"scenario.json": "{\n  \"title\": \"x\",\n}"},
+			issues: []string{"scenario.json: invalid JSON at line 3: invalid character '}' looking for beginning of object key string"},
+		},
+		"invalid fields": {
+			files: map[string]string{"scenario.json": `{"title": "x", "duration": -5, "terrain": "../hm.tif", "area": [10, 5, 0, 0],
+				"entities": [{"id": "a", "model": "models/missing.glb"}, {"id": "a"}, {}]}`},
+			issues: []string{
+				"scenario.json: engine: required",
+				"scenario.json: duration: must be positive",
+				`scenario.json: terrain: reference "../hm.tif" must be relative to the package`,
+				"scenario.json: area: expected [minLon, minLat, maxLon, maxLat] in WGS84 degrees",
+				`scenario.json: entities[0].model: referenced file "models/missing.glb" not found in package`,
+				`scenario.json: entities[1].id: duplicate id "a"`,
+				"scenario.json: entities[2].id: required",
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := InspectScenario(writeZip(t, tc.files), nil)
+			var perr *PackageError
+			assert.True(t, errors.As(err, &perr))
+			var got []string
+			for _, issue := range perr.Issues {
+				got = append(got, issue.String())
+			}
+			assert.Equal(t, tc.issues, got)
+		})
+	}
+}
@@ -0,0 +1,795 @@
+package processors
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/liny/sim-hub/internal/modules/resource/core"
+)
+
+// ThumbnailGeneratorVersion 缩略图与预览生成器版本
+const ThumbnailGeneratorVersion = "1.0.0"
+
+const (
+	thumbnailMaxSide  = 256 // 缩略图长边像素，不放大
+	thumbnailFile     = "thumbnail.png"
+	fileTreeFile      = "tree.json"
+	maxTreeFiles      = 5000      // 文件树预览列出的文件上限，完整数量见 files_count
+	maxImagePixels    = 100 << 20 // 解码普通图片的像素上限
+	maxCoverBytes     = 32 << 20  // 包内封面图片的大小上限
+	maxRasterPixels   = 1 << 30   // 逐像素读取的栅格上限，更大的 GeoTIFF 需要内部概视图
+	maxTIFFChunkBytes = 256 << 20 // 单个条带/瓦片解压后的大小上限
+	maxOverviewIFDs   = 32
+)
+
+// 额外的 TIFF 标签
+const (
+	tagNewSubfileType  = 254
+	tagPhotometric     = 262
+	tagStripOffsets    = 273
+	tagRowsPerStrip    = 278
+	tagStripByteCounts = 279
+	tagPlanarConfig    = 284
+	tagPredictor       = 317
+	tagTileLength      = 323
+	tagTileOffsets     = 324
+	tagTileByteCounts  = 325
+
+	photometricPalette = 3
+)
+
+func init() {
+	core.RegisterProcessor("thumbnail", ThumbnailGenerator{})
+}
+
+// ThumbnailGenerator 为栅格输入 (GeoTIFF、PNG/JPEG/GIF) 生成 PNG 缩略图，
+// 为 ZIP 包或解压后的目录生成文件树预览，包内的封面图片同时作为缩略图
+type ThumbnailGenerator struct{}
+
+func (ThumbnailGenerator) Version() string {
+	return ThumbnailGeneratorVersion
+}
+
+func (ThumbnailGenerator) Process(ctx context.Context, req core.ProcessorRequest, progress func(core.ProgressEvent)) (*core.ProcessorOutput, error) {
+	failed := func(err error) (*core.ProcessorOutput, error) {
+		return &core.ProcessorOutput{Status: core.ProcessorStatusFailed, Error: err.Error()}, nil
+	}
+
+	progress(core.ProgressEvent{Percent: 0, Message: "detecting input"})
+	kind, err := detectPreviewInput(req.FilePath)
+	if err != nil {
+		return failed(err)
+	}
+
+	out := &core.ProcessorOutput{Status: core.ProcessorStatusSuccess}
+	var img image.Image
+	switch kind {
+	case previewPackage:
+		progress(core.ProgressEvent{Percent: 10, Message: "listing files"})
+		tree, cover, err := buildFileTree(req.FilePath)
+		if err != nil {
+			return failed(err)
+		}
+		data, err := json.Marshal(tree)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(filepath.Join(req.OutputDir, fileTreeFile), data, 0o644); err != nil {
+			return nil, err
+		}
+		out.Renditions = append(out.Renditions, core.RenditionSpec{Path: fileTreeFile, Role: "preview", ContentType: "application/json"})
+		if tree.Truncated {
+			out.Warnings = append(out.Warnings, fmt.Sprintf("file tree preview truncated to %d of %d files", maxTreeFiles, tree.FilesCount))
+		}
+		if cover != nil {
+			progress(core.ProgressEvent{Percent: 50, Message: "rendering cover"})
+			if img, err = decodeImage(cover); err != nil {
+				out.Warnings = append(out.Warnings, fmt.Sprintf("cover image skipped: %v", err))
+			}
+		}
+	case previewTIFF:
+		progress(core.ProgressEvent{Percent: 10, Message: "rendering raster"})
+		var warnings []string
+		img, warnings, err = renderGeoTIFF(ctx, req.FilePath)
+		if err != nil {
+			return failed(err)
+		}
+		out.Warnings = append(out.Warnings, warnings...)
+	case previewImage:
+		progress(core.ProgressEvent{Percent: 10, Message: "rendering image"})
+		img, err = decodeImage(func() (io.ReadCloser, error) { return os.Open(req.FilePath) })
+		if err != nil {
+			return failed(err)
+		}
+	}
+
+	if img != nil {
+		if err := writeThumbnail(filepath.Join(req.OutputDir, thumbnailFile), img); err != nil {
+			return nil, err
+		}
+		out.Renditions = append(out.Renditions, core.RenditionSpec{Path: thumbnailFile, Role: "thumbnail", ContentType: "image/png"})
+	}
+	progress(core.ProgressEvent{Percent: 100, Message: "done"})
+	return out, nil
+}
+
+type previewKind int
+
+const (
+	previewPackage previewKind = iota
+	previewTIFF
+	previewImage
+)
+
+// detectPreviewInput 按文件头判断输入类型，目录按解压后的包处理
+func detectPreviewInput(p string) (previewKind, error) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to open file: %v", err)
+	}
+	if info.IsDir() {
+		return previewPackage, nil
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to open file: %v", err)
+	}
+	defer f.Close()
+	head := make([]byte, 8)
+	n, _ := io.ReadFull(f, head)
+	head = head[:n]
+
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return previewPackage, nil
+	case bytes.HasPrefix(head, []byte("II*\x00")), bytes.HasPrefix(head, []byte("MM\x00*")),
+		bytes.HasPrefix(head, []byte("II+\x00")), bytes.HasPrefix(head, []byte("MM\x00+")):
+		return previewTIFF, nil
+	case bytes.HasPrefix(head, []byte("\x89PNG")), bytes.HasPrefix(head, []byte("\xff\xd8\xff")),
+		bytes.HasPrefix(head, []byte("GIF8")):
+		return previewImage, nil
+	}
+	return 0, errors.New("unsupported input for preview: expected GeoTIFF, PNG, JPEG, GIF or ZIP")
+}
+
+// decodeImage 先读取图片尺寸，像素数在上限内才完整解码
+func decodeImage(open func() (io.ReadCloser, error)) (image.Image, error) {
+	rc, err := open()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open image: %v", err)
+	}
+	cfg, _, err := image.DecodeConfig(rc)
+	rc.Close()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode image: %v", err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxImagePixels {
+		return nil, fmt.Errorf("image %dx%d exceeds preview limit", cfg.Width, cfg.Height)
+	}
+
+	if rc, err = open(); err != nil {
+		return nil, fmt.Errorf("Failed to open image: %v", err)
+	}
+	defer rc.Close()
+	img, _, err := image.Decode(rc)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode image: %v", err)
+	}
+	return img, nil
+}
+
+// thumbnailSize 按长边缩放到 thumbnailMaxSide，不放大
+func thumbnailSize(w, h int) (int, int) {
+	if w <= thumbnailMaxSide && h <= thumbnailMaxSide {
+		return w, h
+	}
+	scale := float64(thumbnailMaxSide) / float64(max(w, h))
+	return max(1, int(math.Round(float64(w)*scale))), max(1, int(math.Round(float64(h)*scale)))
+}
+
+// writeThumbnail 把图片按区域均值缩小后写为 PNG
+func writeThumbnail(p string, src image.Image) error {
+	b := src.Bounds()
+	w, h := thumbnailSize(b.Dx(), b.Dy())
+	img := src
+	if w != b.Dx() || h != b.Dy() {
+		img = resizeBox(src, w, h)
+	}
+	f, err := os.Create(p)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// resizeBox 区域均值缩小 (预乘 alpha 下求均值)，每个源像素只访问一次
+func resizeBox(src image.Image, w, h int) *image.RGBA {
+	b := src.Bounds()
+	sum := make([]uint64, w*h*4)
+	count := make([]uint64, w*h)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		ty := (y - b.Min.Y) * h / b.Dy()
+		for x := b.Min.X; x < b.Max.X; x++ {
+			i := ty*w + (x-b.Min.X)*w/b.Dx()
+			r, g, bl, a := src.At(x, y).RGBA()
+			sum[i*4] += uint64(r)
+			sum[i*4+1] += uint64(g)
+			sum[i*4+2] += uint64(bl)
+			sum[i*4+3] += uint64(a)
+			count[i]++
+		}
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i, n := range count {
+		if n == 0 {
+			continue
+		}
+		for c := 0; c < 4; c++ {
+			dst.Pix[i*4+c] = uint8(sum[i*4+c] / n >> 8)
+		}
+	}
+	return dst
+}
+
+// fileNode 文件树预览中的节点，目录的 size 与 files 为其下已列出文件的合计
+type fileNode struct {
+	Name     string      `json:"name"`
+	Type     string      `json:"type"` // dir 或 file
+	Size     int64       `json:"size"`
+	Files    int         `json:"files,omitempty"`
+	Children []*fileNode `json:"children,omitempty"`
+}
+
+// fileTree 文件树预览 (tree.json)
+type fileTree struct {
+	FilesCount int         `json:"files_count"`
+	TotalSize  int64       `json:"total_size"`
+	Truncated  bool        `json:"truncated,omitempty"`
+	Tree       []*fileNode `json:"tree"`
+}
+
+// coverNames 包内可作为缩略图的封面图片文件名 (不含扩展名)
+var coverNames = map[string]bool{"thumbnail": true, "preview": true, "cover": true}
+
+// buildFileTree 列出 ZIP 包或目录的文件树，并返回层级最浅的封面图片 (没有时为 nil)
+func buildFileTree(p string) (*fileTree, func() (io.ReadCloser, error), error) {
+	pkg, err := openScenarioPackage(p)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	files := append([]string(nil), pkg.files...)
+	sort.Strings(files)
+	tree := &fileTree{FilesCount: len(files), Tree: []*fileNode{}}
+	root := &fileNode{Type: "dir"}
+	dirs := map[string]*fileNode{"": root}
+	cover := ""
+	for i, name := range files {
+		size := pkg.sizes[name]
+		tree.TotalSize += size
+
+		ext := strings.ToLower(path.Ext(name))
+		base := strings.ToLower(strings.TrimSuffix(path.Base(name), path.Ext(name)))
+		if coverNames[base] && (ext == ".png" || ext == ".jpg" || ext == ".jpeg" || ext == ".gif") &&
+			(cover == "" || strings.Count(name, "/") < strings.Count(cover, "/")) {
+			cover = name
+		}
+
+		if i >= maxTreeFiles {
+			tree.Truncated = true
+			continue
+		}
+		parent := root
+		parts := strings.Split(name, "/")
+		for j := range parts[:len(parts)-1] {
+			dir := strings.Join(parts[:j+1], "/")
+			node, ok := dirs[dir]
+			if !ok {
+				node = &fileNode{Name: parts[j], Type: "dir"}
+				dirs[dir] = node
+				parent.Children = append(parent.Children, node)
+			}
+			parent = node
+		}
+		parent.Children = append(parent.Children, &fileNode{Name: parts[len(parts)-1], Type: "file", Size: size})
+	}
+	sortFileNodes(root)
+	if root.Children != nil {
+		tree.Tree = root.Children
+	}
+
+	// 封面在包关闭前读入内存，解码前仍会检查像素数
+	var open func() (io.ReadCloser, error)
+	if cover != "" && pkg.sizes[cover] <= maxCoverBytes {
+		rc, err := pkg.open(cover)
+		if err == nil {
+			data, err := io.ReadAll(io.LimitReader(rc, maxCoverBytes))
+			rc.Close()
+			if err == nil {
+				open = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(data)), nil }
+			}
+		}
+	}
+	return tree, open, pkg.close()
+}
+
+// sortFileNodes 目录在前、按名称排序，并汇总目录的大小与文件数
+func sortFileNodes(n *fileNode) {
+	for _, c := range n.Children {
+		if c.Type == "dir" {
+			sortFileNodes(c)
+			n.Files += c.Files
+		} else {
+			n.Files++
+		}
+		n.Size += c.Size
+	}
+	sort.Slice(n.Children, func(i, j int) bool {
+		a, b := n.Children[i], n.Children[j]
+		if a.Type != b.Type {
+			return a.Type == "dir"
+		}
+		return a.Name < b.Name
+	})
+}
+
+// rasterGrid 缩略图分辨率上各波段的像元均值
+type rasterGrid struct {
+	w, h, bands int
+	sum         []float64
+	count       []uint32
+}
+
+func (g *rasterGrid) mean(i, band int) float64 {
+	if g.count[i] == 0 {
+		return math.NaN()
+	}
+	return g.sum[i*g.bands+band] / float64(g.count[i])
+}
+
+// renderGeoTIFF 读取 GeoTIFF 像素生成缩略图：单波段高程渲染为晕渲叠加高程分层，
+// 8 位单波段为灰度，多波段取前三个波段为 RGB。存在内部概视图时读取不小于缩略图的最小一级
+func renderGeoTIFF(ctx context.Context, p string) (image.Image, []string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to open file: %v", err)
+	}
+	defer f.Close()
+
+	base, err := readTIFF(f)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to read TIFF: %v", err)
+	}
+	width, height := base.uint(tagImageWidth, 0), base.uint(tagImageLength, 0)
+	if width == 0 || height == 0 {
+		return nil, nil, fmt.Errorf("Failed to read TIFF: missing image dimensions")
+	}
+
+	t := pickOverview(f, base)
+	if w, h := t.uint(tagImageWidth, 0), t.uint(tagImageLength, 0); w*h > maxRasterPixels {
+		return nil, nil, fmt.Errorf("raster %dx%d too large for preview without internal overviews", w, h)
+	}
+	var nodata *float64
+	if v, err := strconv.ParseFloat(strings.TrimSpace(base.ascii(tagGDALNoData)), 64); err == nil {
+		nodata = &v
+	}
+	grid, err := readRasterGrid(ctx, f, t, nodata)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to read raster: %v", err)
+	}
+
+	var warnings []string
+	if t.uint(tagPhotometric, 1) == photometricPalette {
+		warnings = append(warnings, "palette colours ignored, rendered as grayscale")
+	}
+	format, bits := t.uint(tagSampleFormat, 1), t.uint(tagBitsPerSample, 1)
+	eightBit := format == 1 && bits == 8
+	switch {
+	case grid.bands >= 3:
+		return stretchImage(grid, []int{0, 1, 2}, eightBit), warnings, nil
+	case eightBit:
+		return stretchImage(grid, []int{0, 0, 0}, true), warnings, nil
+	}
+
+	// 单波段高程：像元大小换算为米，缺少地理参考时按像元为单位
+	cellX, cellY := 1.0, 1.0
+	keys := base.geoKeys()
+	if bbox, sx, sy, ok := modelExtent(base, float64(width), float64(height), keys[keyRasterType] == rasterPixelIsPoint); ok {
+		cellX, cellY = sx, sy
+		if keys[keyModelType] == modelTypeGeographic {
+			lat := (bbox[1] + bbox[3]) / 2 * math.Pi / 180
+			cellX, cellY = sx*111320*math.Cos(lat), sy*111320
+		}
+	} else {
+		warnings = append(warnings, "no georeferencing, hillshade uses pixel units")
+	}
+	cellX *= float64(width) / float64(grid.w)
+	cellY *= float64(height) / float64(grid.h)
+	return hillshade(grid, cellX, cellY), warnings, nil
+}
+
+// pickOverview 在 IFD 链中选择长边不小于缩略图尺寸的最小概视图，没有时使用全分辨率
+func pickOverview(r io.ReaderAt, base *tiffFile) *tiffFile {
+	best := base
+	bestPixels := base.uint(tagImageWidth, 0) * base.uint(tagImageLength, 0)
+	t := base
+	for i := 0; i < maxOverviewIFDs && t.next != 0; i++ {
+		next, err := readIFD(r, base.order, base.big, t.next)
+		if err != nil {
+			break
+		}
+		t = next
+		// 只接受缩小分辨率的影像 (bit 0)，跳过掩膜 (bit 2)
+		if kind := t.uint(tagNewSubfileType, 0); kind&1 == 0 || kind&4 != 0 {
+			continue
+		}
+		if t.uint(tagSamplesPerPixel, 1) != base.uint(tagSamplesPerPixel, 1) {
+			continue
+		}
+		w, h := t.uint(tagImageWidth, 0), t.uint(tagImageLength, 0)
+		if max(w, h) >= thumbnailMaxSide && w*h < bestPixels {
+			best, bestPixels = t, w*h
+		}
+	}
+	return best
+}
+
+// tiffLayout 像素数据的组织方式
+type tiffLayout struct {
+	width, height int
+	chunkW        int // 条带宽度为影像宽度
+	chunkH        int
+	across        int // 每行瓦片数，条带为 1
+	offsets       []uint64
+	counts        []uint64
+	spp           int
+	bytes         int // 每个样本的字节数
+	format        uint64
+	compression   uint64
+	predictor     uint64
+}
+
+func rasterLayout(t *tiffFile) (*tiffLayout, error) {
+	l := &tiffLayout{
+		width:       int(t.uint(tagImageWidth, 0)),
+		height:      int(t.uint(tagImageLength, 0)),
+		spp:         int(t.uint(tagSamplesPerPixel, 1)),
+		format:      t.uint(tagSampleFormat, 1),
+		compression: t.uint(tagCompression, 1),
+		predictor:   t.uint(tagPredictor, 1),
+	}
+	bits := t.uints(tagBitsPerSample)
+	if len(bits) == 0 {
+		bits = []uint64{1}
+	}
+	for _, b := range bits {
+		if b != bits[0] {
+			return nil, errors.New("mixed bits per sample not supported")
+		}
+	}
+	switch bits[0] {
+	case 8, 16, 32, 64:
+		l.bytes = int(bits[0] / 8)
+	default:
+		return nil, fmt.Errorf("%d-bit samples not supported", bits[0])
+	}
+	if l.spp < 1 || l.spp > 16 {
+		return nil, fmt.Errorf("invalid samples per pixel %d", l.spp)
+	}
+	if l.spp > 1 && t.uint(tagPlanarConfig, 1) != 1 {
+		return nil, errors.New("planar sample layout not supported")
+	}
+	switch l.compression {
+	case 1, 8, 32946, 32773:
+	default:
+		return nil, fmt.Errorf("compression %s not supported for preview", compressionName(l.compression))
+	}
+	switch l.predictor {
+	case 1, 2, 3:
+	default:
+		return nil, fmt.Errorf("predictor %d not supported", l.predictor)
+	}
+
+	if tw := int(t.uint(tagTileWidth, 0)); tw > 0 {
+		l.chunkW, l.chunkH = tw, int(t.uint(tagTileLength, 0))
+		l.offsets, l.counts = t.uints(tagTileOffsets), t.uints(tagTileByteCounts)
+		if l.chunkH > 0 {
+			l.across = (l.width + l.chunkW - 1) / l.chunkW
+		}
+	} else {
+		l.chunkW, l.chunkH = l.width, int(t.uint(tagRowsPerStrip, uint64(l.height)))
+		l.chunkH = min(l.chunkH, l.height)
+		l.offsets, l.counts = t.uints(tagStripOffsets), t.uints(tagStripByteCounts)
+		l.across = 1
+	}
+	if l.chunkW <= 0 || l.chunkH <= 0 || len(l.offsets) == 0 || len(l.offsets) != len(l.counts) {
+		return nil, errors.New("missing strip or tile layout")
+	}
+	if l.chunkW*l.chunkH*l.spp*l.bytes > maxTIFFChunkBytes {
+		return nil, errors.New("strip or tile too large")
+	}
+	return l, nil
+}
+
+// readRasterGrid 逐个条带/瓦片解码，把像元累加到缩略图网格，内存占用与影像大小无关
+func readRasterGrid(ctx context.Context, r io.ReaderAt, t *tiffFile, nodata *float64) (*rasterGrid, error) {
+	l, err := rasterLayout(t)
+	if err != nil {
+		return nil, err
+	}
+	gw, gh := thumbnailSize(l.width, l.height)
+	g := &rasterGrid{w: gw, h: gh, bands: min(l.spp, 3)}
+	g.sum = make([]float64, gw*gh*g.bands)
+	g.count = make([]uint32, gw*gh)
+
+	rowBytes := l.chunkW * l.spp * l.bytes
+	for i, off := range l.offsets {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		x0, y0 := (i%l.across)*l.chunkW, (i/l.across)*l.chunkH
+		if y0 >= l.height {
+			break
+		}
+		// 最后一个条带可能不足 RowsPerStrip 行，边缘瓦片超出影像的部分不读取
+		rows := min(l.chunkH, l.height-y0)
+		if l.counts[i] == 0 {
+			continue // GDAL 稀疏文件中未写入的瓦片视为无数据
+		}
+		if l.counts[i] > maxTIFFChunkBytes {
+			return nil, fmt.Errorf("chunk %d too large", i)
+		}
+		raw := make([]byte, l.counts[i])
+		if _, err := r.ReadAt(raw, int64(off)); err != nil {
+			return nil, fmt.Errorf("chunk %d: %w", i, err)
+		}
+		data, err := decompressChunk(raw, l.compression, rows*rowBytes)
+		if err != nil {
+			return nil, fmt.Errorf("chunk %d: %w", i, err)
+		}
+		if len(data) < rows*rowBytes {
+			return nil, fmt.Errorf("chunk %d: truncated data", i)
+		}
+
+		order := t.order
+		switch l.predictor {
+		case 2:
+			undoHorizontalPredictor(data[:rows*rowBytes], rowBytes, l.spp, l.bytes, order)
+		case 3:
+			data = undoFloatPredictor(data[:rows*rowBytes], rowBytes, l.spp, l.bytes)
+			order = binary.BigEndian // 浮点预测还原后为高字节在前
+		}
+
+		for y := 0; y < rows && y0+y < l.height; y++ {
+			gy := (y0 + y) * gh / l.height
+			for x := 0; x < l.chunkW && x0+x < l.width; x++ {
+				px := (y*l.chunkW + x) * l.spp
+				first := readSample(data, px, l.bytes, l.format, order)
+				if math.IsNaN(first) || math.IsInf(first, 0) || (nodata != nil && first == *nodata) {
+					continue
+				}
+				gi := gy*gw + (x0+x)*gw/l.width
+				g.sum[gi*g.bands] += first
+				for b := 1; b < g.bands; b++ {
+					g.sum[gi*g.bands+b] += readSample(data, px+b, l.bytes, l.format, order)
+				}
+				g.count[gi]++
+			}
+		}
+	}
+	return g, nil
+}
+
+// decompressChunk 解压条带/瓦片，最多保留 want 字节
+func decompressChunk(raw []byte, compression uint64, want int) ([]byte, error) {
+	switch compression {
+	case 8, 32946:
+		zr, err := zlib.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		data, err := io.ReadAll(io.LimitReader(zr, int64(want)))
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, err
+		}
+		return data, nil
+	case 32773:
+		return unpackBits(raw, want), nil
+	}
+	return raw, nil
+}
+
+// unpackBits PackBits 解码
+func unpackBits(src []byte, want int) []byte {
+	dst := make([]byte, 0, want)
+	for i := 0; i < len(src) && len(dst) < want; {
+		n := int(int8(src[i]))
+		i++
+		switch {
+		case n >= 0:
+			end := min(i+n+1, len(src))
+			dst = append(dst, src[i:end]...)
+			i = end
+		case n != -128 && i < len(src):
+			for k := 0; k < 1-n; k++ {
+				dst = append(dst, src[i])
+			}
+			i++
+		}
+	}
+	return dst
+}
+
+// undoHorizontalPredictor 还原整数水平差分 (Predictor=2)
+func undoHorizontalPredictor(data []byte, rowBytes, spp, size int, order binary.ByteOrder) {
+	for row := 0; row+rowBytes <= len(data); row += rowBytes {
+		buf := data[row : row+rowBytes]
+		for i := spp; i < rowBytes/size; i++ {
+			a, b := buf[i*size:], buf[(i-spp)*size:]
+			switch size {
+			case 1:
+				a[0] += b[0]
+			case 2:
+				order.PutUint16(a, order.Uint16(a)+order.Uint16(b))
+			case 4:
+				order.PutUint32(a, order.Uint32(a)+order.Uint32(b))
+			case 8:
+				order.PutUint64(a, order.Uint64(a)+order.Uint64(b))
+			}
+		}
+	}
+}
+
+// undoFloatPredictor 还原浮点预测 (Predictor=3)：逐字节差分，字节按高位在前分平面存放
+func undoFloatPredictor(data []byte, rowBytes, spp, size int) []byte {
+	out := make([]byte, len(data))
+	samples := rowBytes / size
+	for row := 0; row+rowBytes <= len(data); row += rowBytes {
+		buf := data[row : row+rowBytes]
+		for i := spp; i < rowBytes; i++ {
+			buf[i] += buf[i-spp]
+		}
+		dst := out[row : row+rowBytes]
+		for k := 0; k < samples; k++ {
+			for j := 0; j < size; j++ {
+				dst[k*size+j] = buf[j*samples+k]
+			}
+		}
+	}
+	return out
+}
+
+// readSample 读取第 i 个样本并转换为浮点数
+func readSample(data []byte, i, size int, format uint64, order binary.ByteOrder) float64 {
+	b := data[i*size:]
+	switch size {
+	case 1:
+		if format == 2 {
+			return float64(int8(b[0]))
+		}
+		return float64(b[0])
+	case 2:
+		if format == 2 {
+			return float64(int16(order.Uint16(b)))
+		}
+		return float64(order.Uint16(b))
+	case 4:
+		switch format {
+		case 2:
+			return float64(int32(order.Uint32(b)))
+		case 3:
+			return float64(math.Float32frombits(order.Uint32(b)))
+		}
+		return float64(order.Uint32(b))
+	default:
+		switch format {
+		case 2:
+			return float64(int64(order.Uint64(b)))
+		case 3:
+			return math.Float64frombits(order.Uint64(b))
+		}
+		return float64(order.Uint64(b))
+	}
+}
+
+// stretchImage 按波段线性拉伸到 0-255，8 位无符号数据保持原值；无数据的像元透明
+func stretchImage(g *rasterGrid, bands []int, eightBit bool) *image.NRGBA {
+	lo, hi := make([]float64, len(bands)), make([]float64, len(bands))
+	for k, b := range bands {
+		lo[k], hi[k] = 0, 255
+		if !eightBit {
+			lo[k], hi[k] = gridRange(g, b)
+		}
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, g.w, g.h))
+	for i := range g.count {
+		if g.count[i] == 0 {
+			continue
+		}
+		var c [3]uint8
+		for k, b := range bands {
+			c[k] = scaleByte(g.mean(i, b), lo[k], hi[k])
+		}
+		img.SetNRGBA(i%g.w, i/g.w, color.NRGBA{c[0], c[1], c[2], 255})
+	}
+	return img
+}
+
+// hillshade 按 Horn 算法计算晕渲 (光源方位 315°、高度 45°)，叠加归一化高程以便在平缓地区仍可分辨
+func hillshade(g *rasterGrid, cellX, cellY float64) *image.NRGBA {
+	const azimuth, altitude = 315.0, 45.0
+	zenith := (90 - altitude) * math.Pi / 180
+	az := (360 - azimuth + 90) * math.Pi / 180
+	lo, hi := gridRange(g, 0)
+
+	z := func(x, y int, center float64) float64 {
+		x, y = min(max(x, 0), g.w-1), min(max(y, 0), g.h-1)
+		if v := g.mean(y*g.w+x, 0); !math.IsNaN(v) {
+			return v
+		}
+		return center
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, g.w, g.h))
+	for y := 0; y < g.h; y++ {
+		for x := 0; x < g.w; x++ {
+			e := g.mean(y*g.w+x, 0)
+			if math.IsNaN(e) {
+				continue
+			}
+			a, b, c := z(x-1, y-1, e), z(x, y-1, e), z(x+1, y-1, e)
+			d, f := z(x-1, y, e), z(x+1, y, e)
+			gg, h, i := z(x-1, y+1, e), z(x, y+1, e), z(x+1, y+1, e)
+			dzdx := ((c + 2*f + i) - (a + 2*d + gg)) / (8 * cellX)
+			dzdy := ((gg + 2*h + i) - (a + 2*b + c)) / (8 * cellY)
+			slope := math.Atan(math.Hypot(dzdx, dzdy))
+			aspect := math.Atan2(dzdy, -dzdx)
+			shade := math.Cos(zenith)*math.Cos(slope) + math.Sin(zenith)*math.Sin(slope)*math.Cos(az-aspect)
+
+			v := 0.65*math.Max(shade, 0) + 0.35*float64(scaleByte(e, lo, hi))/255
+			img.SetNRGBA(x, y, color.NRGBA{uint8(v * 255), uint8(v * 255), uint8(v * 255), 255})
+		}
+	}
+	return img
+}
+
+// gridRange 波段均值的最小值与最大值
+func gridRange(g *rasterGrid, band int) (float64, float64) {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for i := range g.count {
+		if v := g.mean(i, band); !math.IsNaN(v) {
+			lo, hi = math.Min(lo, v), math.Max(hi, v)
+		}
+	}
+	return lo, hi
+}
+
+func scaleByte(v, lo, hi float64) uint8 {
+	if !(hi > lo) {
+		return 128
+	}
+	return uint8(math.Round(min(max((v-lo)/(hi-lo), 0), 1) * 255))
+}
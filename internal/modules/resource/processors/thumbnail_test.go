@@ -0,0 +1,216 @@
+package processors
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/liny/sim-hub/internal/modules/resource/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func runThumbnail(t *testing.T, input string) (*core.ProcessorOutput, string) {
+	outDir := t.TempDir()
+	out, err := ThumbnailGenerator{}.Process(context.Background(), core.ProcessorRequest{FilePath: input, OutputDir: outDir}, func(core.ProgressEvent) {})
+	assert.NoError(t, err)
+	return out, outDir
+}
+
+func readPNG(t *testing.T, p string) image.Image {
+	f, err := os.Open(p)
+	assert.NoError(t, err)
+	defer f.Close()
+	img, err := png.Decode(f)
+	assert.NoError(t, err)
+	return img
+}
+
+func TestThumbnailHillshade(t *testing.T) {
+	// 500x300 的 int16 高程，南北向山脊位于 x=250，左上角 50x50 为无数据；
+	// deflate 压缩、水平差分预测，每 100 行一个条带
+	const w, h, rowsPerStrip = 500, 300, 100
+	var data []byte
+	var offsets, counts []uint32
+	for s := 0; s < h/rowsPerStrip; s++ {
+		var strip bytes.Buffer
+		for y := s * rowsPerStrip; y < (s+1)*rowsPerStrip; y++ {
+			prev := int16(0)
+			for x := 0; x < w; x++ {
+				v := int16(1000 - 4*int(math.Abs(float64(x-250))))
+				if x < 50 && y < 50 {
+					v = -9999
+				}
+				binary.Write(&strip, binary.LittleEndian, v-prev)
+				prev = v
+			}
+		}
+		var z bytes.Buffer
+		zw := zlib.NewWriter(&z)
+		zw.Write(strip.Bytes())
+		zw.Close()
+		offsets = append(offsets, uint32(8+len(data)))
+		counts = append(counts, uint32(z.Len()))
+		data = append(data, z.Bytes()...)
+	}
+	path := writeTIFFData(t, []testTag{
+		{tagImageWidth, []uint32{w}},
+		{tagImageLength, []uint32{h}},
+		{tagBitsPerSample, []uint16{16}},
+		{tagSampleFormat, []uint16{2}},
+		{tagCompression, []uint16{8}},
+		{tagPredictor, []uint16{2}},
+		{tagStripOffsets, offsets},
+		{tagRowsPerStrip, []uint32{rowsPerStrip}},
+		{tagStripByteCounts, counts},
+		{tagModelPixelScale, []float64{30, 30, 0}},
+		{tagModelTiepoint, []float64{0, 0, 0, 500000, 3320000, 0}},
+		{tagGeoKeyDirectory, []uint16{1, 1, 0, 2, keyModelType, 0, 1, modelTypeProjected, keyProjectedType, 0, 1, 32650}},
+		{tagGDALNoData, "-9999"},
+	}, data)
+
+	out, outDir := runThumbnail(t, path)
+	assert.Equal(t, core.ProcessorStatusSuccess, out.Status, out.Error)
+	assert.Empty(t, out.Warnings)
+	assert.Equal(t, []core.RenditionSpec{{Path: "thumbnail.png", Role: "thumbnail", ContentType: "image/png"}}, out.Renditions)
+
+	img := readPNG(t, filepath.Join(outDir, "thumbnail.png"))
+	assert.Equal(t, image.Rect(0, 0, 256, 154), img.Bounds())
+	gray := func(x, y int) uint8 { return color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y }
+	// 光源在西北：西坡比东坡亮，无数据区域透明
+	assert.Greater(t, gray(60, 100), gray(200, 100))
+	_, _, _, a := img.At(5, 5).RGBA()
+	assert.Zero(t, a)
+}
+
+func TestThumbnailTiledFloat(t *testing.T) {
+	// 100x80 的 float32，64x64 瓦片，浮点预测 (Predictor=3)，不压缩
+	const w, h, tile = 100, 80, 64
+	value := func(x, y int) float32 { return float32(x) + 1000*float32(y) }
+	var data []byte
+	var offsets, counts []uint32
+	for ty := 0; ty < h; ty += tile {
+		for tx := 0; tx < w; tx += tile {
+			var chunk []byte
+			for y := ty; y < ty+tile; y++ {
+				// 每行按字节平面存放 (高位在前)，再逐字节差分
+				row := make([]byte, tile*4)
+				for x := tx; x < tx+tile; x++ {
+					var be [4]byte
+					binary.BigEndian.PutUint32(be[:], math.Float32bits(value(x, y)))
+					for j := 0; j < 4; j++ {
+						row[j*tile+x-tx] = be[j]
+					}
+				}
+				for i := len(row) - 1; i >= 1; i-- {
+					row[i] -= row[i-1]
+				}
+				chunk = append(chunk, row...)
+			}
+			offsets = append(offsets, uint32(8+len(data)))
+			counts = append(counts, uint32(len(chunk)))
+			data = append(data, chunk...)
+		}
+	}
+	path := writeTIFFData(t, []testTag{
+		{tagImageWidth, []uint32{w}},
+		{tagImageLength, []uint32{h}},
+		{tagBitsPerSample, []uint16{32}},
+		{tagSampleFormat, []uint16{3}},
+		{tagPredictor, []uint16{3}},
+		{tagTileWidth, []uint32{tile}},
+		{tagTileLength, []uint32{tile}},
+		{tagTileOffsets, offsets},
+		{tagTileByteCounts, counts},
+	}, data)
+
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	tf, err := readTIFF(f)
+	assert.NoError(t, err)
+	grid, err := readRasterGrid(context.Background(), f, tf, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, w, grid.w)
+	assert.Equal(t, h, grid.h)
+	for _, p := range [][2]int{{0, 0}, {63, 63}, {64, 0}, {99, 79}, {70, 65}} {
+		assert.Equal(t, float64(value(p[0], p[1])), grid.mean(p[1]*w+p[0], 0), "pixel %v", p)
+	}
+
+	out, _ := runThumbnail(t, path)
+	assert.Equal(t, core.ProcessorStatusSuccess, out.Status, out.Error)
+	assert.Equal(t, []string{"no georeferencing, hillshade uses pixel units"}, out.Warnings)
+}
+
+func TestThumbnailImageAndPackage(t *testing.T) {
+	// 左红右蓝的 600x300 PNG 缩小为 256x128
+	src := image.NewRGBA(image.Rect(0, 0, 600, 300))
+	for y := 0; y < 300; y++ {
+		for x := 0; x < 600; x++ {
+			c := color.RGBA{255, 0, 0, 255}
+			if x >= 300 {
+				c = color.RGBA{0, 0, 255, 255}
+			}
+			src.SetRGBA(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, src))
+	imgPath := filepath.Join(t.TempDir(), "photo.png")
+	assert.NoError(t, os.WriteFile(imgPath, buf.Bytes(), 0o644))
+
+	out, outDir := runThumbnail(t, imgPath)
+	assert.Equal(t, core.ProcessorStatusSuccess, out.Status, out.Error)
+	img := readPNG(t, filepath.Join(outDir, "thumbnail.png"))
+	assert.Equal(t, image.Rect(0, 0, 256, 128), img.Bounds())
+	assert.Equal(t, color.RGBA{255, 0, 0, 255}, color.RGBAModel.Convert(img.At(10, 64)))
+	assert.Equal(t, color.RGBA{0, 0, 255, 255}, color.RGBAModel.Convert(img.At(245, 64)))
+
+	// 想定包：文件树预览，根目录的 cover.png 作为缩略图
+	zipPath := writeZip(t, map[string]string{
+		"demo/scenario.json":      demoScenario,
+		"demo/models/ddg.glb":     "glTF",
+		"demo/models/a/cover.png": "not used, deeper than demo/cover.png",
+		"demo/cover.png":          buf.String(),
+		"demo/readme.txt":         "hello",
+	})
+	out, outDir = runThumbnail(t, zipPath)
+	assert.Equal(t, core.ProcessorStatusSuccess, out.Status, out.Error)
+	assert.Empty(t, out.Warnings)
+	assert.Equal(t, []core.RenditionSpec{
+		{Path: "tree.json", Role: "preview", ContentType: "application/json"},
+		{Path: "thumbnail.png", Role: "thumbnail", ContentType: "image/png"},
+	}, out.Renditions)
+
+	raw, err := os.ReadFile(filepath.Join(outDir, "tree.json"))
+	assert.NoError(t, err)
+	var tree fileTree
+	assert.NoError(t, json.Unmarshal(raw, &tree))
+	assert.Equal(t, 5, tree.FilesCount)
+	assert.False(t, tree.Truncated)
+	assert.Len(t, tree.Tree, 1)
+	demo := tree.Tree[0]
+	assert.Equal(t, "demo", demo.Name)
+	assert.Equal(t, 5, demo.Files)
+	assert.Equal(t, tree.TotalSize, demo.Size)
+	var names []string
+	for _, c := range demo.Children {
+		names = append(names, c.Type+":"+c.Name)
+	}
+	assert.Equal(t, []string{"dir:models", "file:cover.png", "file:readme.txt", "file:scenario.json"}, names)
+	assert.Equal(t, image.Rect(0, 0, 256, 128), readPNG(t, filepath.Join(outDir, "thumbnail.png")).Bounds())
+
+	txt := filepath.Join(t.TempDir(), "notes.txt")
+	assert.NoError(t, os.WriteFile(txt, []byte("plain text"), 0o644))
+	out, _ = runThumbnail(t, txt)
+	assert.Equal(t, core.ProcessorStatusFailed, out.Status)
+	assert.Contains(t, out.Error, "unsupported input for preview")
+}
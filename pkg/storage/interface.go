@@ -34,6 +34,8 @@ type BlobStore interface {
 	// 流式 IO (尽量避免直接读取 bytes，使用 Reader/Writer)
 	Put(ctx context.Context, bucket, key string, reader io.Reader, size int64, contentType string) error
 	Get(ctx context.Context, bucket, key string) (io.ReadCloser, error)
+	// GetRange 读取对象 [offset, offset+length) 范围内的字节，用于只读取大文件的局部 (如 ZIP 中央目录)
+	GetRange(ctx context.Context, bucket, key string, offset, length int64) (io.ReadCloser, error)
 
 	// 本地文件优化操作 (Zero-copy or optimized transfer)
 	DownloadFile(ctx context.Context, bucket, key, localPath string) error
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/liny/sim-hub/pkg/storage"
@@ -88,6 +89,17 @@ func (s *MinIOStore) Get(ctx context.Context, bucket, key string) (io.ReadCloser
 	return s.client.GetObject(ctx, bucket, key, minio.GetObjectOptions{})
 }
 
+func (s *MinIOStore) GetRange(ctx context.Context, bucket, key string, offset, length int64) (io.ReadCloser, error) {
+	if length <= 0 {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	opts := minio.GetObjectOptions{}
+	if err := opts.SetRange(offset, offset+length-1); err != nil {
+		return nil, err
+	}
+	return s.client.GetObject(ctx, bucket, key, opts)
+}
+
 func (s *MinIOStore) DownloadFile(ctx context.Context, bucket, key, localPath string) error {
 	// FGetObject 内部会处理并发下载和校验
 	return s.client.FGetObject(ctx, bucket, key, localPath, minio.GetObjectOptions{})